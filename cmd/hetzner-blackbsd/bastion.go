@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+// bastionKnownHosts is the known_hosts file of the jump host. Unlike the
+// per-build files next to it, it is kept across builds.
+const bastionKnownHosts = "bastion"
+
+// sshDialer returns the dialer build servers are reached through according
+// to the ssh section: the jump host, a proxy, or nil to connect directly. The
+// returned func releases the jump host's key; its connection is closed by the
+// command's container after the clients reached through it.
+func sshDialer(ctx context.Context, cfg *config.Config) (ssh.Dialer, func(), error) {
+	var proxy ssh.Dialer
+	if cfg.SSH.Proxy != "" {
+		dialer, err := ssh.NewProxyDialer(cfg.SSH.Proxy)
+		if err != nil {
+			return nil, nil, err
+		}
+		proxy = dialer
+	}
+
+	jumpCfg := cfg.SSH.ProxyJump
+	if jumpCfg.Host == "" {
+		return proxy, func() {}, nil
+	}
+
+	keys, err := bastionKeys(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostKeys, err := ssh.LoadHostKeys(filepath.Join(cfg.OutputDir, knownHostsSubdir, bastionKnownHosts))
+	if err != nil {
+		_ = keys.Close()
+		return nil, nil, err
+	}
+
+	jump := ssh.NewClientWithKeyPair(jumpCfg.Host, keys).
+		WithPort(jumpCfg.Port).
+		WithUser(jumpCfg.User).
+		WithHostKeys(hostKeys, ssh.PhaseBastion).
+		WithDialer(proxy)
+	return trackSSH(jump), func() { _ = keys.Close() }, nil
+}
+
+// bastionKeys returns the key for the jump host: ssh.proxy_jump.key_path
+// when set, otherwise the personal key.
+func bastionKeys(ctx context.Context, cfg *config.Config) (*ssh.KeyPair, error) {
+	if cfg.SSH.ProxyJump.KeyPath != "" {
+		return ssh.LoadKeyPairWithPassphrase(cfg.SSH.ProxyJump.KeyPath, readPassphrase)
+	}
+	return personalKeys(ctx, cfg)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/boottest"
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/customize"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+const (
+	bootTestReportFile  = "boot-test.xml"
+	reportDirPermission = 0o750
+)
+
+var (
+	bootTestImageID int64
+	bootTestRawPath string
+	bootTestReport  string
+)
+
+func newBootTestCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "boot-test"
+	cmd.Short = "Boot a built image on a fresh server and verify it"
+	cmd.RunE = runBootTest
+	cmd.Flags().Int64Var(&bootTestImageID, "image", 0, "published image snapshot ID to boot")
+	cmd.Flags().StringVar(&bootTestRawPath, "raw", "",
+		"local raw image (.raw.xz) to write to the server in rescue mode")
+	cmd.Flags().StringVar(&bootTestReport, "report", "", "JUnit XML report path (default <output_dir>/boot-test.xml)")
+	cmd.MarkFlagsOneRequired("image", "raw")
+	cmd.MarkFlagsMutuallyExclusive("image", "raw")
+	return &cmd
+}
+
+func runBootTest(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if err = checkBootTestKeys(cfg); err != nil {
+		return err
+	}
+
+	keys, err := personalKeys(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = keys.Close() }()
+
+	dialer, closeDialer, err := sshDialer(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDialer()
+
+	return bootTest(cmd.Context(), cmd.OutOrStdout(), cfg, keys, dialer, boottest.Source{
+		RawImagePath: bootTestRawPath,
+		ImageID:      bootTestImageID,
+	})
+}
+
+// checkBootTestKeys rejects ephemeral build keys: they are deleted with the
+// build that created them, so the only key a built image authorizes that
+// the test can still log in with is the operator's own.
+func checkBootTestKeys(cfg *config.Config) error {
+	if cfg.SSHKeys.Ephemeral {
+		return errors.New("boot test needs ssh_keys.ephemeral: false, as the image only authorizes the personal key")
+	}
+	return nil
+}
+
+// bootTest boots source on a throwaway server, runs the default checks for
+// the configured branding and security tools, and writes the JUnit report.
+// keys must be authorized by the image.
+func bootTest(
+	ctx context.Context,
+	out io.Writer,
+	cfg *config.Config,
+	keys *ssh.KeyPair,
+	dialer ssh.Dialer,
+	source boottest.Source,
+) error {
+	buildID := hcloud.NewBuildID()
+	hostKeys, err := buildHostKeys(cfg, buildID)
+	if err != nil {
+		return err
+	}
+
+	client := progressClient(cfg)
+	opts, err := newBuildCreateOpts(ctx, client, cfg, buildID, keys)
+	if err != nil {
+		return err
+	}
+
+	checks := boottest.DefaultChecks(cfg.Branding, securityTools(cfg))
+	tester := boottest.New(client, keys).WithHostKeys(hostKeys).WithLogin(netbsdLogin(cfg)).WithDialer(dialer)
+	report, err := tester.Run(ctx, opts, source, checks)
+	if err != nil {
+		return err
+	}
+
+	reportPath := bootTestReport
+	if reportPath == "" {
+		reportPath = filepath.Join(cfg.OutputDir, bootTestReportFile)
+	}
+
+	if err = writeBootTestReport(reportPath, report); err != nil {
+		return err
+	}
+
+	return printBootTestSummary(out, report, reportPath)
+}
+
+// securityTools returns the configured security_tools, or the default set
+// when none are configured.
+func securityTools(cfg *config.Config) []string {
+	if len(cfg.SecurityTools) > 0 {
+		return cfg.SecurityTools
+	}
+	return customize.DefaultSecurityTools()
+}
+
+func writeBootTestReport(path string, report *boottest.Report) error {
+	if err := os.MkdirAll(filepath.Dir(path), reportDirPermission); err != nil {
+		return fmt.Errorf("create report dir: %w", err)
+	}
+
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("create report: %w", err)
+	}
+
+	return errors.Join(report.WriteJUnit(file), file.Close())
+}
+
+// printBootTestSummary prints the outcome of each check and returns an error
+// when any of them failed or was skipped.
+func printBootTestSummary(output io.Writer, report *boottest.Report, reportPath string) error {
+	for _, result := range report.Results {
+		status := "ok"
+		switch {
+		case result.Skipped:
+			status = "skipped"
+		case result.Failure != "":
+			status = "FAIL: " + result.Failure
+		}
+
+		if _, err := fmt.Fprintf(output, "  %s... %s\n", result.Name, status); err != nil {
+			return err
+		}
+	}
+
+	failures, skipped := report.Failures(), report.Skipped()
+	passed := len(report.Results) - failures - skipped
+	if _, err := fmt.Fprintf(output, "\nBoot test: %d passed, %d failed, %d skipped. Report: %s\n",
+		passed, failures, skipped, reportPath); err != nil {
+		return err
+	}
+
+	if !report.Passed() {
+		return fmt.Errorf("boot test failed: %d failed, %d skipped", failures, skipped)
+	}
+	return nil
+}
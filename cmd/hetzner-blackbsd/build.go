@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/basecache"
+	"github.com/omarluq/hetzner-blackbsd/internal/build"
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+)
+
+func newBuildCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "build"
+	cmd.Short = "Build BlackBSD image"
+	cmd.Long = `Build provisions an ephemeral server, installs NetBSD from rescue mode, or boots
+the cached base snapshot when base_cache.enabled is set and one matches, customizes
+it natively and downloads the disk image and ISO to output_dir. The server is
+always destroyed afterwards.`
+	cmd.RunE = runBuild
+	return &cmd
+}
+
+func runBuild(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	keys, err := buildKeys(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = keys.Close() }()
+
+	dialer, closeDialer, err := sshDialer(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDialer()
+
+	buildID := hcloud.NewBuildID()
+	hostKeys, err := buildHostKeys(cfg, buildID)
+	if err != nil {
+		return err
+	}
+
+	client := progressClient(cfg)
+	opts, err := newBuildCreateOpts(cmd.Context(), client, cfg, buildID, keys)
+	if err != nil {
+		return err
+	}
+
+	base := basecache.New(client, keys, cfg.NetBSDVersion, cfg.NetBSDArch).
+		WithConsoleCapture(filepath.Join(cfg.OutputDir, consoleSubdir)).
+		WithHostKeys(hostKeys).
+		WithDialer(dialer).
+		WithLogDir(filepath.Join(cfg.OutputDir, logsSubdir))
+	if cfg.Volumes.Cache {
+		base.WithCacheVolume(cfg.Volumes.CacheSizeGB)
+	}
+
+	builder := build.New(client, base, keys).
+		WithHostKeys(hostKeys).
+		WithLogin(netbsdLogin(cfg)).
+		WithDialer(dialer)
+	configureBuilder(builder, cfg)
+
+	result, err := builder.Run(cmd.Context(), opts, &build.Opts{
+		Branding:  cfg.Branding,
+		OutputDir: cfg.OutputDir,
+		Packages:  securityTools(cfg),
+		Raw:       cfg.OutputRaw,
+		ISO:       cfg.OutputISO,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printBuildResult(cmd.OutOrStdout(), buildID, result)
+}
+
+// configureBuilder enables the cached base snapshot and the volumes cfg asks for.
+func configureBuilder(builder *build.Builder, cfg *config.Config) {
+	if cfg.BaseCache.Enabled {
+		builder.WithCachedBase()
+	}
+	if cfg.Volumes.Cache {
+		builder.WithCacheVolume(cfg.Volumes.CacheSizeGB)
+	}
+	if cfg.Volumes.Artifacts {
+		builder.WithArtifactsVolume(cfg.Volumes.ArtifactsSizeGB)
+	}
+}
+
+// printBuildResult lists the downloaded artifacts with their checksums.
+func printBuildResult(output io.Writer, buildID string, result *build.Result) error {
+	source := "fresh install"
+	if result.FromSnapshot {
+		source = "cached base snapshot"
+	}
+
+	if _, err := fmt.Fprintf(output, "Build %s finished from %s.\n", buildID, source); err != nil {
+		return err
+	}
+
+	for _, artifact := range result.Artifacts {
+		if _, err := fmt.Fprintf(output, "  %s  sha256:%s\n", artifact.Path, artifact.SHA256); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/basecache"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+)
+
+// logsSubdir is where per-stage logs land inside the output directory.
+const logsSubdir = "logs"
+
+var cacheKeep int
+
+func newCacheCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "cache"
+	cmd.Short = "Manage cached NetBSD base snapshots"
+	cmd.AddCommand(newCacheListCmd(), newCachePruneCmd(), newCacheRebuildCmd())
+	return &cmd
+}
+
+func newCacheListCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "list"
+	cmd.Short = "List cached base snapshots"
+	cmd.RunE = runCacheList
+	return &cmd
+}
+
+func newCachePruneCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "prune"
+	cmd.Short = "Delete base snapshots beyond the retention count"
+	cmd.RunE = runCachePrune
+	cmd.Flags().IntVar(&cacheKeep, "keep", 0, "snapshots to keep per version/arch/layout (default from config)")
+	return &cmd
+}
+
+func newCacheRebuildCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "rebuild"
+	cmd.Short = "Install NetBSD on a fresh server and snapshot it as the cached base"
+	cmd.RunE = runCacheRebuild
+	return &cmd
+}
+
+func runCacheList(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	client := hcloud.NewClient(cfg.HCloudToken)
+	images, err := client.ListBaseSnapshots(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if len(images) == 0 {
+		slog.Info("No cached base snapshots found.")
+		return nil
+	}
+
+	return printSnapshots(cmd.OutOrStdout(), images)
+}
+
+func runCachePrune(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	keep := cfg.BaseCache.Keep
+	if cacheKeep > 0 {
+		keep = cacheKeep
+	}
+
+	client := hcloud.NewClient(cfg.HCloudToken)
+	cache := basecache.New(client, nil, cfg.NetBSDVersion, cfg.NetBSDArch)
+
+	pruned, err := cache.Prune(cmd.Context(), keep)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(cmd.OutOrStdout(), "Pruned %d base snapshot(s).\n", len(pruned))
+	return err
+}
+
+func runCacheRebuild(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	keys, err := buildKeys(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = keys.Close() }()
+
+	dialer, closeDialer, err := sshDialer(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDialer()
+
+	buildID := hcloud.NewBuildID()
+	hostKeys, err := buildHostKeys(cfg, buildID)
+	if err != nil {
+		return err
+	}
+
+	client := progressClient(cfg)
+	opts, err := newBuildCreateOpts(cmd.Context(), client, cfg, buildID, keys)
+	if err != nil {
+		return err
+	}
+
+	cache := basecache.New(client, keys, cfg.NetBSDVersion, cfg.NetBSDArch).
+		WithConsoleCapture(filepath.Join(cfg.OutputDir, consoleSubdir)).
+		WithHostKeys(hostKeys).
+		WithDialer(dialer).
+		WithLogDir(filepath.Join(cfg.OutputDir, logsSubdir))
+	if cfg.Volumes.Cache {
+		cache.WithCacheVolume(cfg.Volumes.CacheSizeGB)
+	}
+	if cfg.Pool.Enabled {
+		cache.WithPool(cfg.Pool.IdleTimeout)
+	}
+	image, err := cache.Rebuild(cmd.Context(), opts)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(cmd.OutOrStdout(), "Base snapshot %d created for %s.\n",
+		image.ID, cache.Key().String()); err != nil {
+		return err
+	}
+
+	_, err = cache.Prune(cmd.Context(), cfg.BaseCache.Keep)
+	return err
+}
+
+func printSnapshots(output io.Writer, images []*hcloudsdk.Image) error {
+	tabWriter := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
+
+	if _, err := fmt.Fprintln(tabWriter, "ID\tVERSION\tARCH\tLAYOUT\tSTATUS\tCREATED"); err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		key := hcloud.BaseKeyOf(image)
+		if _, err := fmt.Fprintf(tabWriter, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			image.ID, key.Version, key.Arch, key.LayoutHash, image.Status,
+			image.Created.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(output, "\nFound %d base snapshot(s).\n", len(images))
+	return err
+}
@@ -2,10 +2,17 @@ package main_test
 
 import (
 	"bytes"
+	"context"
 	"net"
 	"testing"
+	"time"
 
 	blackbsd "github.com/omarluq/hetzner-blackbsd/cmd/hetzner-blackbsd"
+	"github.com/omarluq/hetzner-blackbsd/internal/boottest"
+	"github.com/omarluq/hetzner-blackbsd/internal/build"
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/customize"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/stretchr/testify/assert"
@@ -36,8 +43,12 @@ func TestPrintServers(t *testing.T) {
 		var ipv4_1 hcloudsdk.ServerPublicNetIPv4
 		ipv4_1.IP = net.ParseIP("1.2.3.4")
 
+		var ipv6_1 hcloudsdk.ServerPublicNetIPv6
+		ipv6_1.IP = net.ParseIP("2001:db8:1:2::")
+
 		var publicNet1 hcloudsdk.ServerPublicNet
 		publicNet1.IPv4 = ipv4_1
+		publicNet1.IPv6 = ipv6_1
 
 		var srv1 hcloudsdk.Server
 		srv1.ID = 1
@@ -71,6 +82,8 @@ func TestPrintServers(t *testing.T) {
 		assert.Contains(t, output, "blackbsd-builder-456")
 		assert.Contains(t, output, "1.2.3.4")
 		assert.Contains(t, output, "5.6.7.8")
+		assert.Contains(t, output, "IPv6")
+		assert.Contains(t, output, "2001:db8:1:2::1")
 		assert.Contains(t, output, "yes")
 		assert.Contains(t, output, "no")
 		assert.Contains(t, output, "Found 2 BlackBSD server(s)")
@@ -99,6 +112,40 @@ func TestPrintServers(t *testing.T) {
 	})
 }
 
+func TestPrintPoolServers(t *testing.T) {
+	t.Parallel()
+
+	var idle hcloudsdk.Server
+	idle.ID = 1
+	idle.Name = "blackbsd-pool-a1"
+	idle.Status = hcloudsdk.ServerStatusOff
+	idle.Labels = map[string]string{
+		bsdhcloud.RoleLabelKey:      bsdhcloud.RolePool,
+		bsdhcloud.ExpiresAtLabelKey: "1767225600",
+	}
+
+	var busy hcloudsdk.Server
+	busy.ID = 2
+	busy.Name = "blackbsd-pool-b2"
+	busy.Status = hcloudsdk.ServerStatusRunning
+	busy.Labels = map[string]string{
+		bsdhcloud.RoleLabelKey:    bsdhcloud.RolePool,
+		bsdhcloud.BuildIDLabelKey: "b2build",
+	}
+
+	buf := new(bytes.Buffer)
+	err := blackbsd.PrintPoolServersForTest(buf, []*hcloudsdk.Server{&idle, &busy})
+
+	require.NoError(t, err)
+	output := buf.String()
+
+	assert.Contains(t, output, "IDLE UNTIL")
+	assert.Contains(t, output, "idle")
+	assert.Contains(t, output, time.Unix(1767225600, 0).Format(time.RFC3339))
+	assert.Contains(t, output, "b2build")
+	assert.Contains(t, output, "Found 2 warm pool server(s)")
+}
+
 func TestRootCommandSetup(t *testing.T) {
 	t.Parallel()
 
@@ -109,6 +156,31 @@ func TestRootCommandSetup(t *testing.T) {
 	assert.NotEmpty(t, cmd.Long)
 }
 
+func TestBuildCommandSetup(t *testing.T) {
+	t.Parallel()
+
+	cmd := blackbsd.NewBuildCmdForTest()
+
+	assert.Equal(t, "build", cmd.Use)
+	assert.NotEmpty(t, cmd.Short)
+	assert.NotNil(t, cmd.RunE)
+}
+
+func TestPrintBuildResult(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	result := &build.Result{
+		Artifacts:    []build.Artifact{{Path: "output/blackbsd.iso", SHA256: "abc123"}},
+		FromSnapshot: true,
+	}
+
+	require.NoError(t, blackbsd.PrintBuildResultForTest(buf, "1a2b3c4d5e", result))
+
+	assert.Equal(t, "Build 1a2b3c4d5e finished from cached base snapshot.\n"+
+		"  output/blackbsd.iso  sha256:abc123\n", buf.String())
+}
+
 func TestDestroyCommandSetup(t *testing.T) {
 	t.Parallel()
 
@@ -128,3 +200,222 @@ func TestStatusCommandSetup(t *testing.T) {
 	assert.NotEmpty(t, cmd.Short)
 	assert.NotNil(t, cmd.RunE)
 }
+
+func TestCacheCommandSetup(t *testing.T) {
+	t.Parallel()
+
+	cmd := blackbsd.NewCacheCmdForTest()
+
+	assert.Equal(t, "cache", cmd.Use)
+	assert.NotEmpty(t, cmd.Short)
+
+	names := make([]string, 0, len(cmd.Commands()))
+	for _, sub := range cmd.Commands() {
+		names = append(names, sub.Name())
+	}
+	assert.ElementsMatch(t, []string{"list", "prune", "rebuild"}, names)
+}
+
+func TestPrintSnapshots(t *testing.T) {
+	t.Parallel()
+
+	var image hcloudsdk.Image
+	image.ID = 99
+	image.Status = hcloudsdk.ImageStatusAvailable
+	image.Labels = map[string]string{
+		"blackbsd-netbsd-version": "10.1",
+		"blackbsd-arch":           "amd64",
+		"blackbsd-layout":         "abcdef123456",
+	}
+
+	buf := new(bytes.Buffer)
+	err := blackbsd.PrintSnapshotsForTest(buf, []*hcloudsdk.Image{&image})
+
+	require.NoError(t, err)
+	output := buf.String()
+	assert.Contains(t, output, "99")
+	assert.Contains(t, output, "10.1")
+	assert.Contains(t, output, "amd64")
+	assert.Contains(t, output, "abcdef123456")
+	assert.Contains(t, output, "Found 1 base snapshot(s)")
+}
+
+func TestPrintProgress(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	progress := blackbsd.PrintProgressForTest(buf)
+	progress(bsdhcloud.Progress{Resource: "action", Command: "create_image", Status: "running", ID: 7, Percent: 40})
+	progress(bsdhcloud.Progress{Resource: "server", Command: "", Status: "starting", ID: 42, Percent: 0})
+
+	assert.Equal(t, "create_image: running 40%\nserver 42: starting\n", buf.String())
+}
+
+func TestReapCommandSetup(t *testing.T) {
+	t.Parallel()
+
+	cmd := blackbsd.NewReapCmdForTest()
+
+	assert.Equal(t, "reap", cmd.Use)
+	assert.NotEmpty(t, cmd.Short)
+	assert.NotNil(t, cmd.Flags().Lookup("dry-run"))
+}
+
+func TestConsoleCommandSetup(t *testing.T) {
+	t.Parallel()
+
+	cmd := blackbsd.NewConsoleCmdForTest()
+
+	assert.Equal(t, "console", cmd.Name())
+	assert.NotEmpty(t, cmd.Short)
+	assert.NotNil(t, cmd.Flags().Lookup("dir"))
+	require.Error(t, cmd.Args(cmd, []string{}))
+	require.NoError(t, cmd.Args(cmd, []string{"42"}))
+}
+
+func TestPublishCommandSetup(t *testing.T) {
+	t.Parallel()
+
+	cmd := blackbsd.NewPublishCmdForTest()
+
+	assert.Equal(t, "publish", cmd.Name())
+	assert.NotEmpty(t, cmd.Short)
+	assert.NotNil(t, cmd.Flags().Lookup("checksum"))
+	assert.NotNil(t, cmd.Flags().Lookup("keep"))
+	require.Error(t, cmd.Args(cmd, []string{}))
+}
+
+func TestTunnelCommandSetup(t *testing.T) {
+	t.Parallel()
+
+	cmd := blackbsd.NewTunnelCmdForTest()
+
+	assert.Equal(t, "tunnel", cmd.Name())
+	assert.NotEmpty(t, cmd.Short)
+	assert.NotNil(t, cmd.Flags().ShorthandLookup("L"))
+	assert.NotNil(t, cmd.Flags().ShorthandLookup("R"))
+	assert.NotNil(t, cmd.Flags().Lookup("rescue"))
+	require.Error(t, cmd.Args(cmd, []string{}))
+	require.NoError(t, cmd.Args(cmd, []string{"blackbsd-builder-1a2b3c4d5e"}))
+}
+
+func TestParseForwardSpec(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		spec   string
+		listen string
+		target string
+	}{
+		{spec: "5900:127.0.0.1:5900", listen: "127.0.0.1:5900", target: "127.0.0.1:5900"},
+		{spec: "0.0.0.0:8080:localhost:80", listen: "0.0.0.0:8080", target: "localhost:80"},
+		{spec: "*:8080:localhost:80", listen: ":8080", target: "localhost:80"},
+		{spec: "[::1]:4444:[fe80::1]:4445", listen: "[::1]:4444", target: "[fe80::1]:4445"},
+	}
+
+	for _, testCase := range tests {
+		listen, target, err := blackbsd.ParseForwardSpecForTest(testCase.spec)
+		require.NoError(t, err, testCase.spec)
+		assert.Equal(t, testCase.listen, listen, testCase.spec)
+		assert.Equal(t, testCase.target, target, testCase.spec)
+	}
+
+	for _, spec := range []string{"5900", "5900:host", "a:b:c:d:e", "port:host:22", "22:host:99999"} {
+		_, _, err := blackbsd.ParseForwardSpecForTest(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestBootTestCommandSetup(t *testing.T) {
+	t.Parallel()
+
+	cmd := blackbsd.NewBootTestCmdForTest()
+
+	assert.Equal(t, "boot-test", cmd.Use)
+	assert.NotEmpty(t, cmd.Short)
+	assert.NotNil(t, cmd.Flags().Lookup("image"))
+	assert.NotNil(t, cmd.Flags().Lookup("raw"))
+	assert.NotNil(t, cmd.Flags().Lookup("report"))
+}
+
+func TestBootTestConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Defaults()
+	require.Error(t, blackbsd.CheckBootTestKeysForTest(&cfg))
+	assert.Equal(t, customize.DefaultSecurityTools(), blackbsd.SecurityToolsForTest(&cfg))
+
+	cfg.SSHKeys.Ephemeral = false
+	cfg.SecurityTools = []string{"nmap"}
+	require.NoError(t, blackbsd.CheckBootTestKeysForTest(&cfg))
+	assert.Equal(t, []string{"nmap"}, blackbsd.SecurityToolsForTest(&cfg))
+}
+
+func TestPrintBootTestSummary(t *testing.T) {
+	t.Parallel()
+
+	t.Run("passes when every check passed", func(t *testing.T) {
+		t.Parallel()
+
+		report := &boottest.Report{Timestamp: time.Now(), Name: "boot", Results: []boottest.Result{
+			{Name: "boot", Failure: "", Duration: time.Second, Skipped: false},
+			{Name: "hostname", Failure: "", Duration: time.Second, Skipped: false},
+		}}
+		buf := new(bytes.Buffer)
+
+		require.NoError(t, blackbsd.PrintBootTestForTest(buf, report, "out/boot-test.xml"))
+		assert.Contains(t, buf.String(), "  hostname... ok")
+		assert.Contains(t, buf.String(), "Boot test: 2 passed, 0 failed, 0 skipped. Report: out/boot-test.xml")
+	})
+
+	t.Run("fails on failed or skipped checks", func(t *testing.T) {
+		t.Parallel()
+
+		report := &boottest.Report{Timestamp: time.Now(), Name: "boot", Results: []boottest.Result{
+			{Name: "boot", Failure: "host not ready", Duration: time.Second, Skipped: false},
+			{Name: "hostname", Failure: "", Duration: 0, Skipped: true},
+		}}
+		buf := new(bytes.Buffer)
+
+		err := blackbsd.PrintBootTestForTest(buf, report, "out/boot-test.xml")
+
+		require.Error(t, err)
+		assert.Contains(t, buf.String(), "  boot... FAIL: host not ready")
+		assert.Contains(t, buf.String(), "  hostname... skipped")
+	})
+}
+
+func TestReapResources(t *testing.T) {
+	t.Parallel()
+
+	t.Run("dry run lists resources and cost", func(t *testing.T) {
+		t.Parallel()
+
+		expiresAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		expired := []bsdhcloud.ExpiredResource{
+			{ExpiresAt: expiresAt, Kind: bsdhcloud.KindServer, Name: "blackbsd-builder-a", ID: 1, HourlyCost: 0.0119},
+			{ExpiresAt: expiresAt, Kind: bsdhcloud.KindServer, Name: "blackbsd-builder-b", ID: 2, HourlyCost: 0.0238},
+			{ExpiresAt: expiresAt, Kind: bsdhcloud.KindFirewall, Name: "blackbsd-builder-a", ID: 7, HourlyCost: 0},
+		}
+
+		buf := new(bytes.Buffer)
+		err := blackbsd.ReapResourcesForTest(context.Background(), buf, expired, true)
+
+		require.NoError(t, err)
+		output := buf.String()
+		assert.Contains(t, output, "Would reap 3 expired BlackBSD resource(s)")
+		assert.Contains(t, output, "server blackbsd-builder-a (1), expired 2026-01-02T03:04:05Z... would remove")
+		assert.Contains(t, output, "Would reclaim 2 server(s), 1 firewall(s).")
+		assert.Contains(t, output, "Hourly cost that would be saved: €0.0357")
+	})
+
+	t.Run("reports nothing to reap", func(t *testing.T) {
+		t.Parallel()
+
+		buf := new(bytes.Buffer)
+		err := blackbsd.ReapResourcesForTest(context.Background(), buf, nil, false)
+
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "No expired BlackBSD resources.")
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+)
+
+// consoleSubdir is where console screenshots land inside the output directory.
+const consoleSubdir = "console"
+
+var consoleDir string
+
+func newConsoleCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "console <server-id>"
+	cmd.Short = "Save a screenshot of a build server's VNC console"
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.RunE = runConsole
+	cmd.Flags().StringVar(&consoleDir, "dir", "", "directory for screenshots (default <output_dir>/console)")
+	return &cmd
+}
+
+func runConsole(cmd *cobra.Command, args []string) error {
+	serverID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse server id %q: %w", args[0], err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	client := hcloud.NewClient(cfg.HCloudToken)
+	found, err := client.GetServer(cmd.Context(), serverID)
+	if err != nil {
+		return err
+	}
+
+	server, ok := found.Get()
+	if !ok {
+		return fmt.Errorf("server %d not found", serverID)
+	}
+
+	dir := consoleDir
+	if dir == "" {
+		dir = filepath.Join(cfg.OutputDir, consoleSubdir)
+	}
+
+	paths, err := client.CaptureConsole(cmd.Context(), server, &hcloud.ConsoleCaptureOpts{
+		Dir:      dir,
+		Shots:    1,
+		Interval: 0,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if _, err = fmt.Fprintln(cmd.OutOrStdout(), path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/di"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+// container holds the services of the running command. It is created by the
+// first loadConfig, once --config is parsed, and shut down when the command
+// finishes, which closes the SSH clients tracked in it.
+var container *di.Container
+
+func init() {
+	cobra.OnFinalize(shutdownContainer)
+}
+
+// loadConfig returns the configuration from the command's container,
+// creating the container for cfgFile on first use.
+func loadConfig() (*config.Config, error) {
+	if container == nil {
+		created, err := di.NewContainer(cfgFile)
+		if err != nil {
+			return nil, err
+		}
+		container = created
+	}
+
+	cfgSvc, err := di.Invoke[*di.ConfigService](container)
+	if err != nil {
+		return nil, err
+	}
+	return cfgSvc.Config, nil
+}
+
+// trackSSH hands client to the container, which closes it at shutdown.
+func trackSSH(client *ssh.Client) *ssh.Client {
+	return di.MustInvoke[*di.SSHService](container).Track(client)
+}
+
+func shutdownContainer() {
+	if container == nil {
+		return
+	}
+
+	if err := container.Shutdown(); err != nil {
+		slog.Warn("shutdown failed", "error", err)
+	}
+	container = nil
+}
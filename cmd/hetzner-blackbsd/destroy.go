@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
+	"time"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 
-	"github.com/omarluq/hetzner-blackbsd/internal/config"
 	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
 )
 
@@ -21,7 +23,7 @@ func newDestroyCmd() *cobra.Command {
 }
 
 func runDestroy(cmd *cobra.Command, _ []string) error {
-	cfg, err := config.Load(cfgFile)
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
@@ -34,10 +36,38 @@ func runDestroy(cmd *cobra.Command, _ []string) error {
 
 	if len(servers) == 0 {
 		slog.Info("No BlackBSD servers to destroy.")
-		return nil
+	} else if destroyErr := destroyServers(cmd.OutOrStdout(), client, cmd, servers); destroyErr != nil {
+		return destroyErr
+	}
+
+	firewalls, err := client.ListFirewalls(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("list firewalls: %w", err)
 	}
 
-	return destroyServers(cmd.OutOrStdout(), client, cmd, servers)
+	orphaned := hcloud.OrphanedFirewalls(firewalls, time.Now())
+	if err = destroyOrphans(cmd, "firewall", firewallOrphans(client, orphaned)); err != nil {
+		return err
+	}
+
+	return destroyOrphanedSSHKeys(cmd, client)
+}
+
+// destroyOrphanedSSHKeys removes the per-build keys of expired builds. The
+// servers are listed again, as teardown may have failed for some of them.
+func destroyOrphanedSSHKeys(cmd *cobra.Command, client *hcloud.Client) error {
+	servers, err := client.ListServers(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("list servers: %w", err)
+	}
+
+	sshKeys, err := client.ListSSHKeys(cmd.Context(), hcloud.BuildIDLabelKey)
+	if err != nil {
+		return fmt.Errorf("list ssh keys: %w", err)
+	}
+
+	orphaned := hcloud.OrphanedSSHKeys(sshKeys, servers, time.Now())
+	return destroyOrphans(cmd, "SSH key", sshKeyOrphans(client, orphaned))
 }
 
 func destroyServers(
@@ -70,7 +100,7 @@ func destroySingleServer(
 		return writeErr
 	}
 
-	deleted, delErr := client.DeleteServer(cmd.Context(), server)
+	deleted, delErr := client.TeardownServer(cmd.Context(), server)
 	if delErr != nil {
 		_, writeErr := fmt.Fprintf(output, "error: %v\n", delErr)
 		return writeErr
@@ -84,3 +114,63 @@ func destroySingleServer(
 	_, writeErr := fmt.Fprintln(output, msg)
 	return writeErr
 }
+
+// orphan is a leftover blackbsd resource that destroy removes.
+type orphan struct {
+	remove func(context.Context) (bool, error)
+	name   string
+	id     int64
+}
+
+func firewallOrphans(client *hcloud.Client, firewalls []*hcloudsdk.Firewall) []orphan {
+	return lo.Map(firewalls, func(firewall *hcloudsdk.Firewall, _ int) orphan {
+		return orphan{
+			remove: func(ctx context.Context) (bool, error) { return client.DeleteFirewall(ctx, firewall) },
+			name:   firewall.Name,
+			id:     firewall.ID,
+		}
+	})
+}
+
+func sshKeyOrphans(client *hcloud.Client, sshKeys []*hcloudsdk.SSHKey) []orphan {
+	return lo.Map(sshKeys, func(sshKey *hcloudsdk.SSHKey, _ int) orphan {
+		return orphan{
+			remove: func(ctx context.Context) (bool, error) { return client.DeleteSSHKey(ctx, sshKey) },
+			name:   sshKey.Name,
+			id:     sshKey.ID,
+		}
+	})
+}
+
+func destroyOrphans(cmd *cobra.Command, kind string, orphans []orphan) error {
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	output := cmd.OutOrStdout()
+	_, writeErr := fmt.Fprintf(output, "Removing %d orphaned BlackBSD %s(s)...\n", len(orphans), kind)
+	if writeErr != nil {
+		return writeErr
+	}
+
+	for _, leftover := range orphans {
+		if _, writeErr := fmt.Fprintf(output, "  %s (%d)... ", leftover.name, leftover.id); writeErr != nil {
+			return writeErr
+		}
+
+		msg := "removed"
+		deleted, delErr := leftover.remove(cmd.Context())
+		switch {
+		case delErr != nil:
+			msg = fmt.Sprintf("error: %v", delErr)
+		case !deleted:
+			msg = "not found (skipped)"
+		}
+
+		if _, writeErr := fmt.Fprintln(output, msg); writeErr != nil {
+			return writeErr
+		}
+	}
+
+	return nil
+}
@@ -1,9 +1,30 @@
 package main
 
 var (
-	NewRootCmdForTest    = newRootCmd
-	NewVersionCmdForTest = newVersionCmd
-	NewStatusCmdForTest  = newStatusCmd
-	NewDestroyCmdForTest = newDestroyCmd
-	PrintServersForTest  = printServers
+	NewRootCmdForTest        = newRootCmd
+	NewBuildCmdForTest       = newBuildCmd
+	PrintBuildResultForTest  = printBuildResult
+	NewVersionCmdForTest     = newVersionCmd
+	NewStatusCmdForTest      = newStatusCmd
+	NewDestroyCmdForTest     = newDestroyCmd
+	PrintServersForTest      = printServers
+	PrintPoolServersForTest  = printPoolServers
+	NewCacheCmdForTest       = newCacheCmd
+	PrintSnapshotsForTest    = printSnapshots
+	NewReapCmdForTest        = newReapCmd
+	ReapResourcesForTest     = reapResources
+	NewConsoleCmdForTest     = newConsoleCmd
+	NewPublishCmdForTest     = newPublishCmd
+	NewTunnelCmdForTest      = newTunnelCmd
+	NewBootTestCmdForTest    = newBootTestCmd
+	PrintBootTestForTest     = printBootTestSummary
+	CheckBootTestKeysForTest = checkBootTestKeys
+	SecurityToolsForTest     = securityTools
+	PrintProgressForTest     = printProgress
 )
+
+// ParseForwardSpecForTest returns the listen and target addresses of spec.
+func ParseForwardSpecForTest(spec string) (string, string, error) {
+	forward, err := parseForwardSpec(spec)
+	return forward.listen, forward.target, err
+}
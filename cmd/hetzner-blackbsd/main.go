@@ -21,12 +21,33 @@ func newRootCmd() *cobra.Command {
 	cmd.Use = "hetzner-blackbsd"
 	cmd.Short = "BlackBSD ISO build pipeline on Hetzner Cloud"
 	cmd.Long = `BlackBSD builds NetBSD-based security ISO images on Hetzner Cloud ephemeral servers.`
-	cmd.Example = `  # List build servers
+	cmd.Example = `  # Build the image and ISO into output_dir
+  hetzner-blackbsd build
+
+  # List build servers
   hetzner-blackbsd status
 
   # Destroy orphaned build servers
   hetzner-blackbsd destroy
 
+  # Preview resources whose TTL has expired
+  hetzner-blackbsd reap --dry-run
+
+  # Save a screenshot of a build server's console
+  hetzner-blackbsd console 12345
+
+  # Snapshot a finished build server as a bootable image
+  hetzner-blackbsd publish 12345 --checksum <sha256>
+
+  # Reach a build server's VNC display without opening firewall ports
+  hetzner-blackbsd tunnel 12345 --rescue -L 5900:127.0.0.1:5900
+
+  # Boot-test a published image and write a JUnit report
+  hetzner-blackbsd boot-test --image 67890
+
+  # Rebuild the cached NetBSD base snapshot
+  hetzner-blackbsd cache rebuild
+
   # Show version
   hetzner-blackbsd version`
 	cmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", defaultConfigFile, "config file path")
@@ -36,8 +57,15 @@ func newRootCmd() *cobra.Command {
 var rootCmd = newRootCmd()
 
 func init() {
+	rootCmd.AddCommand(newBuildCmd())
 	rootCmd.AddCommand(newStatusCmd())
 	rootCmd.AddCommand(newDestroyCmd())
+	rootCmd.AddCommand(newCacheCmd())
+	rootCmd.AddCommand(newReapCmd())
+	rootCmd.AddCommand(newConsoleCmd())
+	rootCmd.AddCommand(newPublishCmd())
+	rootCmd.AddCommand(newTunnelCmd())
+	rootCmd.AddCommand(newBootTestCmd())
 	rootCmd.AddCommand(newVersionCmd())
 }
 
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/netbsd"
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+const (
+	sshKeyName       = "blackbsd"
+	serverNamePrefix = "blackbsd-builder-"
+	knownHostsSubdir = "known_hosts"
+
+	// passphraseEnv supplies the passphrase of an encrypted ssh_key_path
+	// without prompting for it.
+	passphraseEnv = "BLACKBSD_SSH_PASSPHRASE"
+)
+
+// buildKeys returns the key pair used to reach build servers: a fresh in-memory
+// key when ephemeral keys are enabled, otherwise the configured personal key.
+// The caller closes the key pair.
+func buildKeys(ctx context.Context, cfg *config.Config) (*ssh.KeyPair, error) {
+	if !cfg.SSHKeys.Ephemeral {
+		return personalKeys(ctx, cfg)
+	}
+
+	keys, err := ssh.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.SSHKeys.ExportPath != "" {
+		if exportErr := keys.Export(cfg.SSHKeys.ExportPath); exportErr != nil {
+			return nil, exportErr
+		}
+		slog.Warn("ephemeral build key exported to disk", "path", cfg.SSHKeys.ExportPath)
+	}
+
+	return keys, nil
+}
+
+// progressClient returns a Hetzner client that prints the progress of its
+// waits, such as for a server to be created, rebuilt or snapshotted, to
+// stderr.
+func progressClient(cfg *config.Config) *hcloud.Client {
+	return hcloud.NewClient(cfg.HCloudToken).WithProgress(printProgress(os.Stderr))
+}
+
+// printProgress writes each progress update to out on its own line, such as
+// "create_image: running 40%" for an action or "server 42: starting".
+func printProgress(out io.Writer) hcloud.ProgressFunc {
+	return func(progress hcloud.Progress) {
+		if progress.Command == "" {
+			_, _ = fmt.Fprintf(out, "%s %d: %s\n", progress.Resource, progress.ID, progress.Status)
+			return
+		}
+		_, _ = fmt.Fprintf(out, "%s: %s %d%%\n", progress.Command, progress.Status, progress.Percent)
+	}
+}
+
+// personalKeys returns the operator's own key: the ssh-agent key matching
+// ssh_key_path when ssh_keys.agent is set, otherwise the key file itself.
+func personalKeys(ctx context.Context, cfg *config.Config) (*ssh.KeyPair, error) {
+	if cfg.SSHKeys.Agent {
+		return ssh.LoadAgentKeyPair(ctx, os.Getenv(ssh.AgentSocketEnv), cfg.SSHKeyPath)
+	}
+	return ssh.LoadKeyPairWithPassphrase(cfg.SSHKeyPath, readPassphrase)
+}
+
+// readPassphrase returns the passphrase of an encrypted key from
+// BLACKBSD_SSH_PASSPHRASE or, when stdin is a terminal, by prompting for it.
+func readPassphrase(keyPath string) (secret.Secret, error) {
+	if phrase := os.Getenv(passphraseEnv); phrase != "" {
+		return secret.New(phrase), nil
+	}
+
+	fd := int(os.Stdin.Fd()) //nolint:gosec // File descriptors fit in an int.
+	if !term.IsTerminal(fd) {
+		return secret.Secret{}, fmt.Errorf("%s is not set and stdin is not a terminal", passphraseEnv)
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", keyPath)
+	phrase, err := term.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return secret.Secret{}, fmt.Errorf("read passphrase: %w", err)
+	}
+	return secret.New(string(phrase)), nil
+}
+
+// netbsdLogin returns the login of the NetBSD phase, which runs commands as
+// root through ssh_users.escalation unless it is root. The rescue system is
+// always entered as root.
+func netbsdLogin(cfg *config.Config) runner.Login {
+	return runner.Login{User: cfg.SSHUsers.NetBSD, Escalation: runner.Escalation(cfg.SSHUsers.Escalation)}
+}
+
+// buildHostKeys returns the known hosts store of the build identified by
+// buildID, kept in <output_dir>/known_hosts/<build-id> so that later commands
+// against the same build verify the same host keys.
+func buildHostKeys(cfg *config.Config, buildID string) (*ssh.HostKeys, error) {
+	if buildID == "" {
+		return ssh.NewHostKeys(), nil
+	}
+	return ssh.LoadHostKeys(filepath.Join(cfg.OutputDir, knownHostsSubdir, buildID))
+}
+
+// newBuildCreateOpts prepares server creation options for the build identified
+// by buildID: it registers the SSH key and, when enabled, creates the per-build
+// firewall restricting SSH to the operator. Anything already created for the
+// build is cleaned up again on failure. When reap.before_build is set, expired
+// resources from earlier builds are swept first. Server types whose CPU
+// architecture does not match netbsd_arch are rejected before anything is created.
+func newBuildCreateOpts(
+	ctx context.Context,
+	client *hcloud.Client,
+	cfg *config.Config,
+	buildID string,
+	keys *ssh.KeyPair,
+) (*hcloud.CreateOpts, error) {
+	if cfg.Reap.BeforeBuild {
+		if err := reapExpired(ctx, io.Discard, client, false); err != nil {
+			slog.Warn("pre-build reap failed", "error", err)
+		}
+	}
+
+	serverArch := netbsd.ServerArch(cfg.NetBSDArch)
+	if err := client.CheckServerTypeArch(ctx, cfg.ServerTypePreferences(), serverArch); err != nil {
+		return nil, err
+	}
+
+	opts, err := prepareBuild(ctx, client, cfg, buildID, keys)
+	if err != nil {
+		return nil, errors.Join(err, client.CleanupBuild(context.WithoutCancel(ctx), buildID))
+	}
+	return opts, nil
+}
+
+func prepareBuild(
+	ctx context.Context,
+	client *hcloud.Client,
+	cfg *config.Config,
+	buildID string,
+	keys *ssh.KeyPair,
+) (*hcloud.CreateOpts, error) {
+	labels := hcloud.WithExpiry(hcloud.BuildLabels(buildID), time.Now().Add(cfg.Reap.TTL))
+	name := serverNamePrefix + buildID
+
+	sshKeyID, err := registerBuildKey(ctx, client, cfg, name, labels, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &hcloud.CreateOpts{
+		Labels:      labels,
+		Name:        name,
+		ServerType:  cfg.ServerType,
+		Image:       cfg.Image,
+		Location:    cfg.Location,
+		SSHKeyIDs:   []int64{sshKeyID},
+		FirewallIDs: nil,
+		Placements:  hcloud.Placements(cfg.ServerTypePreferences(), cfg.LocationPreferences()),
+		ImageID:     0,
+		DisableIPv4: !cfg.Network.IPv4,
+	}
+
+	if !cfg.Firewall.Enabled {
+		return opts, nil
+	}
+
+	echoURL := hcloud.DefaultIPEchoURL
+	if !cfg.Network.IPv4 {
+		echoURL = hcloud.DefaultIPv6EchoURL
+	}
+
+	cidrs, err := hcloud.OperatorCIDRs(ctx, cfg.Firewall.AllowedCIDRs, echoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	firewall, err := client.CreateFirewall(ctx, &hcloud.FirewallOpts{
+		Labels:      labels,
+		Name:        name,
+		SourceCIDRs: cidrs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts.FirewallIDs = []int64{firewall.ID}
+	return opts, nil
+}
+
+// registerBuildKey uploads the build's public key and returns its Hetzner ID.
+// Ephemeral keys are registered under the build's name and labels so teardown
+// can delete them; a personal key is shared across builds and kept.
+func registerBuildKey(
+	ctx context.Context,
+	client *hcloud.Client,
+	cfg *config.Config,
+	name string,
+	labels map[string]string,
+	keys *ssh.KeyPair,
+) (int64, error) {
+	if cfg.SSHKeys.Ephemeral {
+		sshKey, err := client.CreateSSHKey(ctx, name, keys.AuthorizedKey(), labels)
+		if err != nil {
+			return 0, err
+		}
+		return sshKey.ID, nil
+	}
+
+	sshKey, err := client.EnsureSSHKey(ctx, sshKeyName, keys.AuthorizedKey())
+	if err != nil {
+		return 0, fmt.Errorf("register ssh key: %w", err)
+	}
+	return sshKey.ID, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/boottest"
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/publish"
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+var (
+	publishChecksum string
+	publishKeep     int
+)
+
+func newPublishCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "publish <server-id|name>"
+	cmd.Short = "Snapshot a finished build server as a reusable BlackBSD image"
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.RunE = runPublish
+	cmd.Flags().StringVar(&publishChecksum, "checksum", "", "SHA-256 of the extracted image to record on the snapshot")
+	cmd.Flags().IntVar(&publishKeep, "keep", -1, "image snapshots to keep per version/arch (default from config)")
+	return &cmd
+}
+
+func runPublish(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if err = checkPublishKeys(cfg); err != nil {
+		return err
+	}
+
+	// Publishing wipes host keys and logs off the disk, so only build servers
+	// are accepted: FindServer rejects any other server in the project.
+	client := progressClient(cfg)
+	found, err := client.FindServer(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	server, ok := found.Get()
+	if !ok {
+		return fmt.Errorf("server %s not found", args[0])
+	}
+
+	keys, err := personalKeys(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = keys.Close() }()
+
+	dialer, closeDialer, err := sshDialer(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDialer()
+
+	return publishAndTest(cmd.Context(), cmd.OutOrStdout(), cfg, client, server, keys, dialer)
+}
+
+// checkPublishKeys rejects configs whose keys cannot reach an existing build
+// server or, with deploy_test_vm, the boot test server.
+func checkPublishKeys(cfg *config.Config) error {
+	// Ephemeral keys die with the build that created them, so reaching an
+	// existing server needs the operator's own key.
+	if cfg.SSHKeyPath == "" && !cfg.SSHKeys.Agent {
+		return errors.New("publish needs ssh_key_path or ssh_keys.agent to reach an existing build server")
+	}
+
+	if cfg.DeployTestVM {
+		return checkBootTestKeys(cfg)
+	}
+	return nil
+}
+
+// publishAndTest publishes server and, with deploy_test_vm, boot-tests the
+// new image.
+func publishAndTest(
+	ctx context.Context,
+	out io.Writer,
+	cfg *config.Config,
+	client *hcloud.Client,
+	server *hcloudsdk.Server,
+	keys *ssh.KeyPair,
+	dialer ssh.Dialer,
+) error {
+	// The host key baked into the image is generated here rather than by
+	// NetBSD, so the build knows it before any server boots the image.
+	var hostKey *ssh.KeyPair
+	if cfg.Publish.PinHostKey {
+		var err error
+		if hostKey, err = ssh.GenerateKeyPair(); err != nil {
+			return err
+		}
+	}
+
+	image, err := publishServer(ctx, cfg, client, server, keys, dialer, hostKey)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(out, "Published image snapshot %d (%s).\n", image.ID, image.Description); err != nil {
+		return err
+	}
+
+	if !cfg.DeployTestVM {
+		return nil
+	}
+
+	source := boottest.Source{HostKey: nil, RawImagePath: "", ImageID: image.ID}
+	if hostKey != nil {
+		source.HostKey = hostKey.PublicKey()
+	}
+	return bootTest(ctx, out, cfg, keys, dialer, source)
+}
+
+// publishServer connects to server as the NetBSD login and publishes it. A
+// non-nil hostKey is installed on the server and pinned in the build's known
+// hosts store once the image has been published.
+func publishServer(
+	ctx context.Context,
+	cfg *config.Config,
+	client *hcloud.Client,
+	server *hcloudsdk.Server,
+	keys *ssh.KeyPair,
+	dialer ssh.Dialer,
+	hostKey *ssh.KeyPair,
+) (*hcloudsdk.Image, error) {
+	hostKeys, err := buildHostKeys(cfg, server.Labels[hcloud.BuildIDLabelKey])
+	if err != nil {
+		return nil, err
+	}
+
+	sshClient := serverClient(cfg, server, keys, dialer, hostKeys, ssh.PhaseNetBSD)
+
+	keep := cfg.Publish.Keep
+	if publishKeep >= 0 {
+		keep = publishKeep
+	}
+
+	exec := netbsdLogin(cfg).Escalate(sshClient)
+	image, err := publish.New(client, cfg.NetBSDVersion, cfg.NetBSDArch).Publish(ctx, exec, server, &publish.Opts{
+		HostKey:  hostKey,
+		BuildID:  server.Labels[hcloud.BuildIDLabelKey],
+		Checksum: publishChecksum,
+		Keep:     keep,
+	})
+	if err != nil || hostKey == nil {
+		return image, err
+	}
+
+	return image, hostKeys.Pin(hcloud.ServerAddress(server), ssh.PhaseNetBSD, hostKey.PublicKey())
+}
+
+// serverClient connects to a build server as the ssh_users login of phase,
+// verifying its host key against hostKeys, the known hosts store of the build
+// that created it. The client is closed when the command's container shuts
+// down.
+func serverClient(
+	cfg *config.Config,
+	server *hcloudsdk.Server,
+	keys *ssh.KeyPair,
+	dialer ssh.Dialer,
+	hostKeys *ssh.HostKeys,
+	phase ssh.Phase,
+) *ssh.Client {
+	user := cfg.SSHUsers.NetBSD
+	if phase == ssh.PhaseRescue {
+		user = runner.RootUser
+	}
+
+	sshClient := ssh.NewClientWithKeyPair(hcloud.ServerAddress(server), keys).WithUser(user).WithDialer(dialer)
+	return trackSSH(sshClient.WithHostKeys(hostKeys, phase))
+}
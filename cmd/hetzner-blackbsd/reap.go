@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+)
+
+var reapDryRun bool
+
+// reapOrder lists resource kinds in the order they are reaped and summarized.
+var reapOrder = []hcloud.ResourceKind{
+	hcloud.KindServer,
+	hcloud.KindVolume,
+	hcloud.KindFirewall,
+	hcloud.KindSSHKey,
+	hcloud.KindSnapshot,
+}
+
+func newReapCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "reap"
+	cmd.Short = "Delete BlackBSD resources whose TTL has expired"
+	cmd.RunE = runReap
+	cmd.Flags().BoolVar(&reapDryRun, "dry-run", false, "list expired resources without deleting them")
+	return &cmd
+}
+
+func runReap(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	client := hcloud.NewClient(cfg.HCloudToken)
+	return reapExpired(cmd.Context(), cmd.OutOrStdout(), client, reapDryRun)
+}
+
+// reapExpired deletes every expired blackbsd resource and reports what was reclaimed.
+func reapExpired(ctx context.Context, output io.Writer, client *hcloud.Client, dryRun bool) error {
+	expired, err := client.ListExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	return reapResources(ctx, output, expired, dryRun)
+}
+
+func reapResources(ctx context.Context, output io.Writer, expired []hcloud.ExpiredResource, dryRun bool) error {
+	if len(expired) == 0 {
+		_, err := fmt.Fprintln(output, "No expired BlackBSD resources.")
+		return err
+	}
+
+	verb := "Reaping"
+	if dryRun {
+		verb = "Would reap"
+	}
+	if _, err := fmt.Fprintf(output, "%s %d expired BlackBSD resource(s)...\n", verb, len(expired)); err != nil {
+		return err
+	}
+
+	reclaimed := make(map[hcloud.ResourceKind]int)
+	var hourlyCost float64
+
+	for i := range expired {
+		resource := &expired[i]
+		if _, err := fmt.Fprintf(output, "  %s %s (%d), expired %s... ", resource.Kind, resource.Name,
+			resource.ID, resource.ExpiresAt.Format(time.RFC3339)); err != nil {
+			return err
+		}
+
+		msg, counted := reapResource(ctx, resource, dryRun)
+		if counted {
+			reclaimed[resource.Kind]++
+			hourlyCost += resource.HourlyCost
+		}
+
+		if _, err := fmt.Fprintln(output, msg); err != nil {
+			return err
+		}
+	}
+
+	return printReapSummary(output, reclaimed, hourlyCost, dryRun)
+}
+
+// reapResource removes a single resource unless dryRun is set. It returns the
+// status to print and whether the resource counts as reclaimed.
+func reapResource(ctx context.Context, resource *hcloud.ExpiredResource, dryRun bool) (string, bool) {
+	if dryRun {
+		return "would remove", true
+	}
+
+	deleted, err := resource.Remove(ctx)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("error: %v", err), false
+	case !deleted:
+		return "not found (skipped)", false
+	default:
+		return "removed", true
+	}
+}
+
+func printReapSummary(
+	output io.Writer,
+	reclaimed map[hcloud.ResourceKind]int,
+	hourlyCost float64,
+	dryRun bool,
+) error {
+	counts := make([]string, 0, len(reapOrder))
+	for _, kind := range reapOrder {
+		if reclaimed[kind] > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s(s)", reclaimed[kind], kind))
+		}
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "nothing")
+	}
+
+	verb, saved := "Reclaimed", "saved"
+	if dryRun {
+		verb, saved = "Would reclaim", "that would be saved"
+	}
+
+	_, err := fmt.Fprintf(output, "\n%s %s.\nHourly cost %s: €%.4f\n",
+		verb, strings.Join(counts, ", "), saved, hourlyCost)
+	return err
+}
@@ -5,24 +5,25 @@ import (
 	"io"
 	"log/slog"
 	"text/tabwriter"
+	"time"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 
-	"github.com/omarluq/hetzner-blackbsd/internal/config"
 	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
 )
 
 func newStatusCmd() *cobra.Command {
 	var cmd cobra.Command
 	cmd.Use = "status"
-	cmd.Short = "Show BlackBSD build servers"
+	cmd.Short = "Show BlackBSD build and warm pool servers"
 	cmd.RunE = runStatus
 	return &cmd
 }
 
 func runStatus(cmd *cobra.Command, _ []string) error {
-	cfg, err := config.Load(cfgFile)
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
@@ -38,13 +39,32 @@ func runStatus(cmd *cobra.Command, _ []string) error {
 		return nil
 	}
 
-	return printServers(cmd.OutOrStdout(), servers)
+	pool, builds := lo.FilterReject(servers, func(server *hcloudsdk.Server, _ int) bool {
+		return hcloud.IsPoolServer(server)
+	})
+
+	if len(builds) > 0 {
+		if err = printServers(cmd.OutOrStdout(), builds); err != nil {
+			return err
+		}
+	}
+
+	if len(pool) == 0 {
+		return nil
+	}
+
+	if len(builds) > 0 {
+		if _, err = fmt.Fprintln(cmd.OutOrStdout()); err != nil {
+			return err
+		}
+	}
+	return printPoolServers(cmd.OutOrStdout(), pool)
 }
 
 func printServers(output io.Writer, servers []*hcloudsdk.Server) error {
 	tabWriter := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
 
-	if _, err := fmt.Fprintln(tabWriter, "ID\tNAME\tSTATUS\tIPv4\tRESCUE"); err != nil {
+	if _, err := fmt.Fprintln(tabWriter, "ID\tNAME\tSTATUS\tIPv4\tIPv6\tRESCUE"); err != nil {
 		return err
 	}
 
@@ -59,8 +79,13 @@ func printServers(output io.Writer, servers []*hcloudsdk.Server) error {
 			ipv4 = server.PublicNet.IPv4.IP.String()
 		}
 
-		if _, err := fmt.Fprintf(tabWriter, "%d\t%s\t%s\t%s\t%s\n",
-			server.ID, server.Name, server.Status, ipv4, rescue); err != nil {
+		ipv6 := ""
+		if ip := hcloud.IPv6Address(server); ip != nil {
+			ipv6 = ip.String()
+		}
+
+		if _, err := fmt.Fprintf(tabWriter, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			server.ID, server.Name, server.Status, ipv4, ipv6, rescue); err != nil {
 			return err
 		}
 	}
@@ -72,3 +97,37 @@ func printServers(output io.Writer, servers []*hcloudsdk.Server) error {
 	_, err := fmt.Fprintf(output, "\nFound %d BlackBSD server(s).\n", len(servers))
 	return err
 }
+
+// printPoolServers lists warm pool servers with the build using each one, or
+// the time an idle server will be destroyed.
+func printPoolServers(output io.Writer, servers []*hcloudsdk.Server) error {
+	tabWriter := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
+
+	if _, err := fmt.Fprintln(tabWriter, "ID\tNAME\tSTATUS\tBUILD\tIDLE UNTIL"); err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		buildID, busy := hcloud.PoolServerBusy(server)
+		if !busy {
+			buildID = "idle"
+		}
+
+		idleUntil := ""
+		if expiresAt, ok := hcloud.ExpiresAt(server.Labels); ok && !busy {
+			idleUntil = expiresAt.Format(time.RFC3339)
+		}
+
+		if _, err := fmt.Fprintf(tabWriter, "%d\t%s\t%s\t%s\t%s\n",
+			server.ID, server.Name, server.Status, buildID, idleUntil); err != nil {
+			return err
+		}
+	}
+
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(output, "\nFound %d warm pool server(s).\n", len(servers))
+	return err
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+// defaultBindAddress is where a forward listens when its spec names no
+// address, as with ssh -L and -R.
+const defaultBindAddress = "127.0.0.1"
+
+var (
+	tunnelLocal  []string
+	tunnelRemote []string
+	tunnelRescue bool
+)
+
+// errBadForward is wrapped when a --local or --remote spec cannot be parsed.
+var errBadForward = errors.New("want [bind_address:]port:host:hostport")
+
+// forwardSpec is one port forward: connections to listen are passed to target.
+type forwardSpec struct {
+	listen string
+	target string
+}
+
+func newTunnelCmd() *cobra.Command {
+	var cmd cobra.Command
+	cmd.Use = "tunnel <server-id|name>"
+	cmd.Short = "Forward ports to and from a build server over SSH"
+	cmd.Long = `Forward ports over the build server's SSH connection until interrupted, so services
+such as the QEMU monitor, VNC or an artifact server are reachable without opening firewall ports.
+Specs follow ssh -L and -R: [bind_address:]port:host:hostport, binding 127.0.0.1 by default.`
+	cmd.Example = `  # Reach the installer's VNC display while the server is in rescue mode
+  hetzner-blackbsd tunnel 12345 --rescue -L 5900:127.0.0.1:5900
+
+  # Let the build server fetch from a local HTTP server on its port 8080
+  hetzner-blackbsd tunnel blackbsd-builder-1a2b3c4d5e -R 8080:127.0.0.1:8000`
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.RunE = runTunnel
+	cmd.Flags().StringArrayVarP(&tunnelLocal, "local", "L", nil, "forward a local port to the server (repeatable)")
+	cmd.Flags().StringArrayVarP(&tunnelRemote, "remote", "R", nil, "forward a server port to this host (repeatable)")
+	cmd.Flags().BoolVar(&tunnelRescue, "rescue", false, "connect to the rescue system instead of installed NetBSD")
+	return &cmd
+}
+
+func runTunnel(cmd *cobra.Command, args []string) error {
+	local, err := parseForwardSpecs(tunnelLocal)
+	if err != nil {
+		return err
+	}
+	remote, err := parseForwardSpecs(tunnelRemote)
+	if err != nil {
+		return err
+	}
+	if len(local)+len(remote) == 0 {
+		return errors.New("tunnel needs at least one --local or --remote forward")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// As for publish, only the operator's own key reaches an existing server.
+	if cfg.SSHKeyPath == "" && !cfg.SSHKeys.Agent {
+		return errors.New("tunnel needs ssh_key_path or ssh_keys.agent to reach an existing build server")
+	}
+
+	sshClient, closeClient, err := tunnelClient(cmd.Context(), cfg, args[0])
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	forwards, err := startForwards(cmd.Context(), cmd.OutOrStdout(), sshClient, local, remote)
+	defer func() {
+		for _, forward := range forwards {
+			_ = forward.Close()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	return waitForwards(cmd.Context(), forwards)
+}
+
+// tunnelClient connects to the build server ref names, by ID or name. The
+// returned func closes what the client was reached through; the client
+// itself is closed by the command's container.
+func tunnelClient(ctx context.Context, cfg *config.Config, ref string) (*ssh.Client, func(), error) {
+	found, err := hcloud.NewClient(cfg.HCloudToken).FindServer(ctx, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server, ok := found.Get()
+	if !ok {
+		return nil, nil, fmt.Errorf("server %s not found", ref)
+	}
+
+	hostKeys, err := buildHostKeys(cfg, server.Labels[hcloud.BuildIDLabelKey])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := personalKeys(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialer, closeDialer, err := sshDialer(ctx, cfg)
+	if err != nil {
+		_ = keys.Close()
+		return nil, nil, err
+	}
+
+	phase := ssh.PhaseNetBSD
+	if tunnelRescue {
+		phase = ssh.PhaseRescue
+	}
+
+	sshClient := serverClient(cfg, server, keys, dialer, hostKeys, phase)
+	return sshClient, func() {
+		closeDialer()
+		_ = keys.Close()
+	}, nil
+}
+
+// startForwards starts the local and remote forwards, reporting each on out.
+// The forwards started before a failure are returned for closing.
+func startForwards(
+	ctx context.Context,
+	out io.Writer,
+	sshClient *ssh.Client,
+	local, remote []forwardSpec,
+) ([]*ssh.Forward, error) {
+	forwards := make([]*ssh.Forward, 0, len(local)+len(remote))
+	for _, spec := range local {
+		forward, err := sshClient.ForwardLocal(ctx, spec.listen, spec.target)
+		if err != nil {
+			return forwards, err
+		}
+		forwards = append(forwards, forward)
+
+		_, err = fmt.Fprintf(out, "Forwarding local %s to %s on the server.\n", forward.Addr(), spec.target)
+		if err != nil {
+			return forwards, err
+		}
+	}
+
+	for _, spec := range remote {
+		forward, err := sshClient.ForwardRemote(ctx, spec.listen, spec.target)
+		if err != nil {
+			return forwards, err
+		}
+		forwards = append(forwards, forward)
+
+		_, err = fmt.Fprintf(out, "Forwarding server %s to local %s.\n", forward.Addr(), spec.target)
+		if err != nil {
+			return forwards, err
+		}
+	}
+
+	return forwards, nil
+}
+
+// waitForwards blocks until ctx is canceled, or fails when a forward stops
+// on its own, as remote forwards do when the connection drops.
+func waitForwards(ctx context.Context, forwards []*ssh.Forward) error {
+	stopped := make(chan net.Addr, len(forwards))
+	for _, forward := range forwards {
+		go func() {
+			select {
+			case <-forward.Done():
+				stopped <- forward.Addr()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case addr := <-stopped:
+		return fmt.Errorf("forward on %s stopped", addr)
+	}
+}
+
+func parseForwardSpecs(specs []string) ([]forwardSpec, error) {
+	parsed := make([]forwardSpec, 0, len(specs))
+	for _, spec := range specs {
+		forward, err := parseForwardSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, forward)
+	}
+	return parsed, nil
+}
+
+// parseForwardSpec parses ssh's [bind_address:]port:host:hostport. IPv6
+// addresses are written in brackets.
+func parseForwardSpec(spec string) (forwardSpec, error) {
+	fields := splitForwardSpec(spec)
+
+	bind := defaultBindAddress
+	switch len(fields) {
+	case 3:
+	case 4:
+		bind, fields = fields[0], fields[1:]
+		if bind == "*" {
+			bind = ""
+		}
+	default:
+		return forwardSpec{listen: "", target: ""}, fmt.Errorf("parse forward %q: %w", spec, errBadForward)
+	}
+
+	for _, port := range []string{fields[0], fields[2]} {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return forwardSpec{listen: "", target: ""}, fmt.Errorf("parse forward %q: bad port %q: %w",
+				spec, port, errBadForward)
+		}
+	}
+
+	return forwardSpec{
+		listen: net.JoinHostPort(bind, fields[0]),
+		target: net.JoinHostPort(fields[1], fields[2]),
+	}, nil
+}
+
+// splitForwardSpec splits spec at colons outside brackets and strips the
+// brackets.
+func splitForwardSpec(spec string) []string {
+	var fields []string
+	var field strings.Builder
+	bracketed := false
+
+	for _, char := range spec {
+		switch {
+		case char == '[':
+			bracketed = true
+		case char == ']':
+			bracketed = false
+		case char == ':' && !bracketed:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteRune(char)
+		}
+	}
+	return append(fields, field.String())
+}
@@ -0,0 +1,302 @@
+// Package basecache builds and reuses Hetzner snapshots of a clean NetBSD install.
+package basecache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/netbsd"
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/omarluq/hetzner-blackbsd/internal/staging"
+)
+
+const (
+	// InstallDevice is the disk NetBSD is installed onto inside rescue mode.
+	InstallDevice = "/dev/sda"
+
+	isoDir = "/tmp"
+
+	consoleShots    = 3
+	consoleInterval = 5 * time.Second
+	consoleTimeout  = time.Minute
+)
+
+// Cache looks up, creates and prunes cached NetBSD base snapshots.
+type Cache struct {
+	client     *hcloud.Client
+	keys       *ssh.KeyPair
+	hostKeys   *ssh.HostKeys
+	dialer     ssh.Dialer
+	version    string
+	arch       string
+	consoleDir string
+	logDir     string
+	cacheGB    int
+	poolIdle   time.Duration
+}
+
+// New creates a Cache for the given NetBSD version and architecture.
+// keys authenticate to the servers provisioned by Rebuild.
+func New(client *hcloud.Client, keys *ssh.KeyPair, version, arch string) *Cache {
+	return &Cache{
+		client:     client,
+		keys:       keys,
+		hostKeys:   ssh.NewHostKeys(),
+		dialer:     nil,
+		version:    version,
+		arch:       arch,
+		consoleDir: "",
+		logDir:     "",
+		cacheGB:    0,
+		poolIdle:   0,
+	}
+}
+
+// WithConsoleCapture saves VNC console screenshots into dir when a Rebuild
+// stage times out, which is the only way to see why a server never came up.
+func (c *Cache) WithConsoleCapture(dir string) *Cache {
+	c.consoleDir = dir
+	return c
+}
+
+// WithHostKeys verifies the rescue system's host key against the build's
+// known hosts store instead of a private in-memory one.
+func (c *Cache) WithHostKeys(store *ssh.HostKeys) *Cache {
+	c.hostKeys = store
+	return c
+}
+
+// WithDialer reaches servers through dialer, such as a jump host or proxy.
+func (c *Cache) WithDialer(dialer ssh.Dialer) *Cache {
+	c.dialer = dialer
+	return c
+}
+
+// WithLogDir writes the output of long-running stages, such as the QEMU
+// install, to per-stage log files in dir.
+func (c *Cache) WithLogDir(dir string) *Cache {
+	c.logDir = dir
+	return c
+}
+
+// WithCacheVolume keeps downloaded install media on the location's shared
+// cache volume, created with sizeGB on first use, instead of the rescue tmpfs.
+func (c *Cache) WithCacheVolume(sizeGB int) *Cache {
+	c.cacheGB = sizeGB
+	return c
+}
+
+// WithPool makes Rebuild reuse a warm pool server, reset with the Hetzner
+// rebuild action, and return it to the pool for idle instead of deleting it.
+func (c *Cache) WithPool(idle time.Duration) *Cache {
+	c.poolIdle = idle
+	return c
+}
+
+// Key returns the snapshot key for the configured version, arch and disk layout.
+func (c *Cache) Key() hcloud.BaseKey {
+	installer := netbsd.New(nil, c.version, c.arch)
+	return hcloud.BaseKey{
+		Version:    c.version,
+		Arch:       c.arch,
+		LayoutHash: installer.LayoutHash(InstallDevice),
+	}
+}
+
+// Resolve points opts at a cached base snapshot when one exists.
+// It returns true when the caller can skip the rescue-mode install.
+func (c *Cache) Resolve(ctx context.Context, opts *hcloud.CreateOpts) (bool, error) {
+	key := c.Key()
+
+	found, err := c.client.FindBaseSnapshot(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	image, ok := found.Get()
+	if !ok {
+		slog.Info("no cached base snapshot", "key", key.String())
+		return false, nil
+	}
+
+	opts.ImageID = image.ID
+	slog.Info("using cached base snapshot", "key", key.String(), "image_id", image.ID)
+	return true, nil
+}
+
+// Rebuild provisions a server with opts, installs NetBSD from rescue mode,
+// snapshots the result as the base for Key, and always tears the server down,
+// or returns it to the warm pool when WithPool is set.
+func (c *Cache) Rebuild(ctx context.Context, opts *hcloud.CreateOpts) (image *hcloudsdk.Image, err error) {
+	server, err := c.acquire(ctx, opts)
+	if err != nil {
+		buildID := opts.Labels[hcloud.BuildIDLabelKey]
+		return nil, errors.Join(err, c.client.CleanupBuild(context.WithoutCancel(ctx), buildID))
+	}
+
+	defer func() {
+		if teardownErr := c.release(context.WithoutCancel(ctx), server); teardownErr != nil {
+			slog.Error("teardown failed", "server_id", server.ID, "error", teardownErr)
+			if err == nil {
+				err = teardownErr
+			}
+		}
+	}()
+
+	if err = c.Install(ctx, server, opts.SSHKeyIDs); err != nil {
+		return nil, err
+	}
+
+	if err = c.client.PowerOffServer(ctx, server); err != nil {
+		return nil, err
+	}
+
+	err = c.client.WaitForServerStatus(ctx, server.ID, hcloudsdk.ServerStatusOff,
+		hcloud.WithWaitTimeout(hcloud.PowerOffTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.client.SaveBaseSnapshot(ctx, server, c.Key())
+}
+
+// Prune deletes base snapshots beyond the newest keep per key and returns them.
+func (c *Cache) Prune(ctx context.Context, keep int) ([]*hcloudsdk.Image, error) {
+	images, err := c.client.ListBaseSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := hcloud.SnapshotsToPrune(images, keep)
+	for _, image := range pruned {
+		if _, delErr := c.client.DeleteImage(ctx, image); delErr != nil {
+			return nil, delErr
+		}
+	}
+
+	return pruned, nil
+}
+
+func (c *Cache) acquire(ctx context.Context, opts *hcloud.CreateOpts) (*hcloudsdk.Server, error) {
+	if c.poolIdle > 0 {
+		return c.client.AcquirePoolServer(ctx, opts)
+	}
+	return c.client.CreateServer(ctx, opts)
+}
+
+func (c *Cache) release(ctx context.Context, server *hcloudsdk.Server) error {
+	if c.poolIdle > 0 {
+		return c.client.ReleasePoolServer(ctx, server, c.poolIdle)
+	}
+	_, err := c.client.TeardownServer(ctx, server)
+	return err
+}
+
+// captureConsole saves console screenshots when err is a stage timeout.
+func (c *Cache) captureConsole(ctx context.Context, server *hcloudsdk.Server, err error) {
+	if c.consoleDir == "" || !isStageTimeout(err) {
+		return
+	}
+
+	captureCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), consoleTimeout)
+	defer cancel()
+
+	_, captureErr := c.client.CaptureConsole(captureCtx, server, &hcloud.ConsoleCaptureOpts{
+		Dir:      c.consoleDir,
+		Shots:    consoleShots,
+		Interval: consoleInterval,
+	})
+	if captureErr != nil {
+		slog.Warn("console capture failed", "server_id", server.ID, "error", captureErr)
+	}
+}
+
+func isStageTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ssh.ErrNotReady)
+}
+
+// Install installs NetBSD onto InstallDevice of a freshly created server from
+// rescue mode, entered with the SSH keys sshKeyIDs. The server is left in
+// rescue mode; the caller disables it and resets the server to boot NetBSD.
+// When a stage times out, console screenshots are saved as for Rebuild.
+func (c *Cache) Install(ctx context.Context, server *hcloudsdk.Server, sshKeyIDs []int64) error {
+	err := c.install(ctx, server, sshKeyIDs)
+	if err != nil {
+		c.captureConsole(ctx, server, err)
+	}
+	return err
+}
+
+func (c *Cache) install(ctx context.Context, server *hcloudsdk.Server, sshKeyIDs []int64) error {
+	if err := c.client.WaitForServerStatus(ctx, server.ID, hcloudsdk.ServerStatusRunning); err != nil {
+		return err
+	}
+
+	rootPassword, err := c.client.EnterRescue(ctx, server, hcloud.WithRescueSSHKeys(sshKeyIDs))
+	if err != nil {
+		return err
+	}
+
+	address := hcloud.ServerAddress(server)
+	if err = c.hostKeys.Expect(address, ssh.PhaseRescue); err != nil {
+		return err
+	}
+
+	sshClient := ssh.NewClientWithKeyPair(address, c.keys).
+		WithDialer(c.dialer).
+		WithHostKeys(c.hostKeys, ssh.PhaseRescue).
+		WithPasswordFallback(rootPassword)
+	defer ssh.CloseQuietly(sshClient)
+	if err := sshClient.WaitForReady(ctx); err != nil {
+		return err
+	}
+
+	installer := netbsd.New(sshClient, c.version, c.arch).WithLogDir(c.logDir)
+	if c.cacheGB > 0 {
+		return c.installFromCache(ctx, server, sshClient, installer)
+	}
+
+	isoPath, err := installer.DownloadISO(ctx, isoDir)
+	if err != nil {
+		return err
+	}
+
+	return installer.InstallViaQEMU(ctx, isoPath, InstallDevice)
+}
+
+// installFromCache mounts the cache volume in rescue, downloads the install
+// media there unless an earlier build already did, and installs from it.
+func (c *Cache) installFromCache(
+	ctx context.Context,
+	server *hcloudsdk.Server,
+	exec runner.Runner,
+	installer *netbsd.Installer,
+) error {
+	volume, err := c.client.AttachCacheVolume(ctx, server, c.cacheGB)
+	if err != nil {
+		return err
+	}
+
+	if err = staging.MountRescue(ctx, exec, volume.LinuxDevice, staging.CacheMount); err != nil {
+		return err
+	}
+
+	defer func() {
+		if unmountErr := staging.Unmount(context.WithoutCancel(ctx), exec, staging.CacheMount); unmountErr != nil {
+			slog.Warn("unmount cache volume failed", "server_id", server.ID, "error", unmountErr)
+		}
+	}()
+
+	isoPath, err := installer.EnsureISO(ctx, staging.ISOCacheDir)
+	if err != nil {
+		return err
+	}
+
+	return installer.InstallViaQEMU(ctx, isoPath, InstallDevice)
+}
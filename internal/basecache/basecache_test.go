@@ -0,0 +1,75 @@
+package basecache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/basecache"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newImagesServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, _ *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusOK)
+			_, writeErr := writer.Write([]byte(body))
+			require.NoError(t, writeErr)
+		}))
+}
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	cache := basecache.New(hcloud.NewClient("token"), nil, "10.1", "amd64")
+	key := cache.Key()
+
+	assert.Equal(t, "10.1", key.Version)
+	assert.Equal(t, "amd64", key.Arch)
+	assert.Len(t, key.LayoutHash, 12)
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	t.Run("points create options at cached snapshot", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := newImagesServer(t, `{"images": [{"id": 77, "type": "snapshot", "status": "available"}]}`)
+		defer testServer.Close()
+
+		client := hcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		cache := basecache.New(client, nil, "10.1", "amd64")
+
+		var opts hcloud.CreateOpts
+		hit, err := cache.Resolve(context.Background(), &opts)
+
+		require.NoError(t, err)
+		assert.True(t, hit)
+		assert.Equal(t, int64(77), opts.ImageID)
+	})
+
+	t.Run("leaves options untouched on miss", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := newImagesServer(t, `{"images": []}`)
+		defer testServer.Close()
+
+		client := hcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		cache := basecache.New(client, nil, "10.1", "amd64")
+
+		var opts hcloud.CreateOpts
+		hit, err := cache.Resolve(context.Background(), &opts)
+
+		require.NoError(t, err)
+		assert.False(t, hit)
+		assert.Zero(t, opts.ImageID)
+	})
+}
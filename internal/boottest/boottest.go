@@ -0,0 +1,212 @@
+// Package boottest verifies a built BlackBSD image by booting it on a fresh
+// Hetzner server and running assertions against it over SSH.
+package boottest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+const (
+	// InstallDevice is the disk the raw image is written to in rescue mode.
+	InstallDevice = "/dev/sda"
+
+	rawImageRemotePath = "/tmp/blackbsd.raw.xz"
+	reportName         = "blackbsd-boot-test"
+)
+
+// Source selects what the test server boots. ImageID boots a published
+// snapshot directly; otherwise RawImagePath, a local blackbsd.raw.xz, is
+// uploaded and written to the disk from rescue mode. HostKey, when set, is
+// the host key the image was published with and the only one accepted from
+// the booted image; otherwise its first key is trusted.
+type Source struct {
+	HostKey      gossh.PublicKey
+	RawImagePath string
+	ImageID      int64
+}
+
+// Tester boots built images on throwaway servers and checks them.
+type Tester struct {
+	client   *hcloud.Client
+	keys     *ssh.KeyPair
+	hostKeys *ssh.HostKeys
+	netbsd   runner.Login
+	dialer   ssh.Dialer
+}
+
+// New creates a Tester. keys authenticate to the rescue system and must also
+// be authorized by the booted image.
+func New(client *hcloud.Client, keys *ssh.KeyPair) *Tester {
+	return &Tester{
+		client:   client,
+		keys:     keys,
+		hostKeys: ssh.NewHostKeys(),
+		netbsd:   runner.RootLogin(),
+		dialer:   nil,
+	}
+}
+
+// WithDialer reaches the test server through dialer, such as a jump host or
+// proxy.
+func (t *Tester) WithDialer(dialer ssh.Dialer) *Tester {
+	t.dialer = dialer
+	return t
+}
+
+// WithLogin sets the user the test logs in as on the booted image. The checks
+// run as that user; rescue mode is always entered as root.
+func (t *Tester) WithLogin(netbsd runner.Login) *Tester {
+	t.netbsd = netbsd
+	return t
+}
+
+// WithHostKeys verifies the test server's host keys against the build's known
+// hosts store instead of a private in-memory one.
+func (t *Tester) WithHostKeys(store *ssh.HostKeys) *Tester {
+	t.hostKeys = store
+	return t
+}
+
+// Run creates a server with opts, boots source on it and runs checks once SSH
+// is reachable. When the image never becomes reachable the boot is recorded as
+// a failure and every check as skipped. The test server is always destroyed,
+// and the build's firewall and SSH key are cleaned up when it cannot be created.
+// The returned error covers infrastructure failures only; failed checks are
+// reported through the Report.
+func (t *Tester) Run(
+	ctx context.Context,
+	opts *hcloud.CreateOpts,
+	source Source,
+	checks []Check,
+) (report *Report, err error) {
+	if source.ImageID != 0 {
+		opts.ImageID = source.ImageID
+	}
+
+	server, err := t.client.CreateServer(ctx, opts)
+	if err != nil {
+		buildID := opts.Labels[hcloud.BuildIDLabelKey]
+		return nil, errors.Join(err, t.client.CleanupBuild(context.WithoutCancel(ctx), buildID))
+	}
+
+	defer func() {
+		if _, teardownErr := t.client.TeardownServer(context.WithoutCancel(ctx), server); teardownErr != nil {
+			slog.Error("test server teardown failed", "server_id", server.ID, "error", teardownErr)
+			if err == nil {
+				err = teardownErr
+			}
+		}
+	}()
+
+	if err = t.boot(ctx, server, source, opts.SSHKeyIDs); err != nil {
+		return nil, err
+	}
+
+	report = &Report{Timestamp: time.Now(), Name: reportName, Results: nil}
+
+	address := hcloud.ServerAddress(server)
+	if err = t.expectHostKey(address, source.HostKey); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	sshClient := ssh.NewClientWithKeyPair(address, t.keys).
+		WithUser(t.netbsd.User).
+		WithDialer(t.dialer).
+		WithHostKeys(t.hostKeys, ssh.PhaseNetBSD)
+	defer ssh.CloseQuietly(sshClient)
+	if readyErr := sshClient.WaitForReady(ctx); readyErr != nil {
+		report.Results = append([]Result{{
+			Name: "boot", Failure: readyErr.Error(), Duration: time.Since(started), Skipped: false,
+		}}, SkipChecks(checks)...)
+		return report, nil
+	}
+
+	report.Results = append([]Result{{Name: "boot", Failure: "", Duration: time.Since(started), Skipped: false}},
+		RunChecks(ctx, sshClient, checks)...)
+	return report, nil
+}
+
+// expectHostKey pins the host key the image was published with or, without
+// one, trusts the key the image generates on first boot.
+func (t *Tester) expectHostKey(address string, key gossh.PublicKey) error {
+	if key != nil {
+		return t.hostKeys.Pin(address, ssh.PhaseNetBSD, key)
+	}
+	return t.hostKeys.Expect(address, ssh.PhaseNetBSD)
+}
+
+// boot waits for the server and, for raw images, writes the image to its
+// disk from rescue mode and reboots into it.
+func (t *Tester) boot(ctx context.Context, server *hcloudsdk.Server, source Source, sshKeyIDs []int64) error {
+	if err := t.client.WaitForServerStatus(ctx, server.ID, hcloudsdk.ServerStatusRunning); err != nil {
+		return err
+	}
+
+	if source.ImageID != 0 {
+		return nil
+	}
+
+	rootPassword, err := t.client.EnterRescue(ctx, server, hcloud.WithRescueSSHKeys(sshKeyIDs))
+	if err != nil {
+		return err
+	}
+
+	address := hcloud.ServerAddress(server)
+	if err = t.hostKeys.Expect(address, ssh.PhaseRescue); err != nil {
+		return err
+	}
+
+	rescue := ssh.NewClientWithKeyPair(address, t.keys).
+		WithDialer(t.dialer).
+		WithHostKeys(t.hostKeys, ssh.PhaseRescue).
+		WithPasswordFallback(rootPassword)
+	defer ssh.CloseQuietly(rescue)
+	if err = rescue.WaitForReady(ctx); err != nil {
+		return err
+	}
+
+	if err = t.writeRawImage(ctx, rescue, source.RawImagePath); err != nil {
+		return err
+	}
+
+	if err = t.client.DisableRescue(ctx, server); err != nil {
+		return err
+	}
+
+	if err = t.client.ResetServer(ctx, server); err != nil {
+		return err
+	}
+
+	return t.client.WaitForServerStatus(ctx, server.ID, hcloudsdk.ServerStatusRunning)
+}
+
+// writeRawImage uploads the local raw image at path through rescue and
+// writes it to InstallDevice.
+func (t *Tester) writeRawImage(ctx context.Context, rescue *ssh.Client, path string) error {
+	if err := rescue.UploadFile(ctx, path, rawImageRemotePath); err != nil {
+		return err
+	}
+
+	result, err := rescue.Exec(ctx, fmt.Sprintf("xz -dc %s | dd of=%s bs=4M conv=fsync",
+		ssh.EscapeShellArg(rawImageRemotePath), ssh.EscapeShellArg(InstallDevice)))
+	if err != nil {
+		return fmt.Errorf("write raw image: %w", err)
+	}
+
+	if !result.Success() {
+		return fmt.Errorf("write raw image: exit code %d: %s", result.ExitCode, result.Stderr)
+	}
+	return nil
+}
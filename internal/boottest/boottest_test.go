@@ -0,0 +1,177 @@
+package boottest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/boottest"
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRunner struct {
+	results  map[string]ssh.CommandResult
+	commands []string
+}
+
+func (runner *mockRunner) Exec(_ context.Context, command string) (ssh.CommandResult, error) {
+	runner.commands = append(runner.commands, command)
+
+	if result, found := runner.results[command]; found {
+		return result, nil
+	}
+
+	return ssh.CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, nil
+}
+
+func testBranding() config.Branding {
+	return config.Branding{Hostname: "blackbsd", MOTD: "Welcome to BlackBSD", DefaultUser: "security"}
+}
+
+func TestDefaultChecks(t *testing.T) {
+	t.Parallel()
+
+	checks := boottest.DefaultChecks(testBranding(), []string{"nmap", "tcpdump"})
+
+	names := make([]string, 0, len(checks))
+	for _, check := range checks {
+		names = append(names, check.Name)
+	}
+
+	assert.Equal(t, []string{"hostname", "motd", "default user", "package nmap", "package tcpdump", "network"}, names)
+	assert.Equal(t, `test "$(hostname)" = 'blackbsd'`, checks[0].Command)
+	assert.Equal(t, "printf %s 'Welcome to BlackBSD' | cmp -s - /etc/motd", checks[1].Command)
+	assert.Equal(t, "id 'security'", checks[2].Command)
+	assert.Equal(t, "pkg_info -e 'nmap'", checks[3].Command)
+}
+
+func TestRunChecks(t *testing.T) {
+	t.Parallel()
+
+	runner := &mockRunner{
+		results: map[string]ssh.CommandResult{
+			"pkg_info -e 'nmap'": {Stdout: "", Stderr: "not installed", ExitCode: 1},
+		},
+		commands: nil,
+	}
+	checks := boottest.DefaultChecks(testBranding(), []string{"nmap"})
+
+	results := boottest.RunChecks(context.Background(), runner, checks)
+
+	require.Len(t, results, len(checks))
+	assert.Len(t, runner.commands, len(checks), "a failure must not stop later checks")
+	assert.True(t, results[0].Passed())
+	assert.False(t, results[3].Passed())
+	assert.Contains(t, results[3].Failure, "exited 1: not installed")
+	assert.True(t, results[4].Passed())
+}
+
+func TestWriteJUnit(t *testing.T) {
+	t.Parallel()
+
+	report := &boottest.Report{
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Name:      "blackbsd-boot-test",
+		Results: append([]boottest.Result{
+			{Name: "boot", Failure: "", Duration: 2 * time.Second, Skipped: false},
+			{Name: "hostname", Failure: "exited 1", Duration: time.Second, Skipped: false},
+		}, boottest.SkipChecks([]boottest.Check{{Name: "motd", Command: "true"}})...),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJUnit(&buf))
+
+	var parsed struct {
+		Suites []struct {
+			Name  string `xml:"name,attr"`
+			Cases []struct {
+				Failure *struct {
+					Message string `xml:"message,attr"`
+				} `xml:"failure"`
+				Skipped *struct{} `xml:"skipped"`
+				Name    string    `xml:"name,attr"`
+			} `xml:"testcase"`
+			Tests    int     `xml:"tests,attr"`
+			Failures int     `xml:"failures,attr"`
+			Skipped  int     `xml:"skipped,attr"`
+			Time     float64 `xml:"time,attr"`
+		} `xml:"testsuite"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &parsed))
+
+	require.Len(t, parsed.Suites, 1)
+	suite := parsed.Suites[0]
+	assert.Equal(t, "blackbsd-boot-test", suite.Name)
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.InDelta(t, 3.0, suite.Time, 1e-9)
+	assert.Nil(t, suite.Cases[0].Failure)
+	require.NotNil(t, suite.Cases[1].Failure)
+	assert.Equal(t, "exited 1", suite.Cases[1].Failure.Message)
+	assert.NotNil(t, suite.Cases[2].Skipped)
+	assert.False(t, report.Passed())
+}
+
+func TestRunCleansUpWhenCreateFails(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			writer.Header().Set("Content-Type", "application/json")
+			switch {
+			case request.Method == http.MethodPost:
+				writer.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = writer.Write([]byte(`{"error": {"code": "invalid_input", "message": "bad image"}}`))
+			case request.Method == http.MethodDelete:
+				deleted = append(deleted, request.URL.Path)
+				writer.WriteHeader(http.StatusNoContent)
+			case strings.HasSuffix(request.URL.Path, "/ssh_keys"):
+				_, _ = writer.Write([]byte(`{"ssh_keys": [{"id": 5, "name": "blackbsd-builder-b1"}]}`))
+			case strings.HasSuffix(request.URL.Path, "/firewalls"):
+				_, _ = writer.Write([]byte(`{"firewalls": [{"id": 7, "name": "blackbsd-builder-b1"}]}`))
+			}
+		}))
+	defer testServer.Close()
+
+	client := hcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+	opts := &hcloud.CreateOpts{
+		Labels:      hcloud.BuildLabels("b1"),
+		Name:        "blackbsd-builder-b1",
+		ServerType:  "cpx31",
+		Image:       "ubuntu-24.04",
+		Location:    "fsn1",
+		SSHKeyIDs:   []int64{5},
+		FirewallIDs: []int64{7},
+		Placements:  nil,
+		ImageID:     0,
+		DisableIPv4: false,
+	}
+	source := boottest.Source{HostKey: nil, RawImagePath: "", ImageID: 99}
+
+	_, err := boottest.New(client, nil).Run(context.Background(), opts, source, nil)
+
+	require.Error(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"/ssh_keys/5", "/firewalls/7"}, deleted)
+}
@@ -0,0 +1,90 @@
+package boottest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+// Check is a single assertion run on the booted test server. It passes when
+// Command exits zero.
+type Check struct {
+	Name    string
+	Command string
+}
+
+// Result is the outcome of one Check. Failure is empty when the check passed;
+// Skipped checks were never run because the server did not boot.
+type Result struct {
+	Name     string
+	Failure  string
+	Duration time.Duration
+	Skipped  bool
+}
+
+// Passed reports whether the check ran and succeeded.
+func (r Result) Passed() bool {
+	return r.Failure == "" && !r.Skipped
+}
+
+// DefaultChecks returns the assertions for an image built with branding and
+// packages: hostname, MOTD, default user, each package, and a default route.
+// The MOTD must match /etc/motd as a whole, as customize writes it.
+func DefaultChecks(branding config.Branding, packages []string) []Check {
+	checks := []Check{
+		{Name: "hostname", Command: fmt.Sprintf(`test "$(hostname)" = %s`, ssh.EscapeShellArg(branding.Hostname))},
+		{Name: "motd", Command: fmt.Sprintf("printf %%s %s | cmp -s - /etc/motd", ssh.EscapeShellArg(branding.MOTD))},
+		{Name: "default user", Command: "id " + ssh.EscapeShellArg(branding.DefaultUser)},
+	}
+
+	for _, pkg := range packages {
+		checks = append(checks, Check{Name: "package " + pkg, Command: "pkg_info -e " + ssh.EscapeShellArg(pkg)})
+	}
+
+	return append(checks, Check{
+		Name:    "network",
+		Command: "route -n get default >/dev/null 2>&1 || route -n get -inet6 default >/dev/null 2>&1",
+	})
+}
+
+// RunChecks runs every check through exec and records the results. A failing
+// check does not stop the remaining ones.
+func RunChecks(ctx context.Context, exec runner.Runner, checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, runCheck(ctx, exec, check))
+	}
+	return results
+}
+
+// SkipChecks records every check as skipped.
+func SkipChecks(checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, Result{Name: check.Name, Failure: "", Duration: 0, Skipped: true})
+	}
+	return results
+}
+
+func runCheck(ctx context.Context, exec runner.Runner, check Check) Result {
+	started := time.Now()
+	result := Result{Name: check.Name, Failure: "", Duration: 0, Skipped: false}
+
+	output, err := exec.Exec(ctx, check.Command)
+	result.Duration = time.Since(started)
+
+	switch {
+	case err != nil:
+		result.Failure = err.Error()
+	case !output.Success():
+		result.Failure = fmt.Sprintf("%s: exited %d: %s",
+			check.Command, output.ExitCode, strings.TrimSpace(output.Stderr+output.Stdout))
+	}
+
+	return result
+}
@@ -0,0 +1,116 @@
+package boottest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Report collects the results of one boot test run.
+type Report struct {
+	Timestamp time.Time
+	Name      string
+	Results   []Result
+}
+
+// Failures returns the number of checks that ran and failed.
+func (r *Report) Failures() int {
+	failures := 0
+	for _, result := range r.Results {
+		if result.Failure != "" {
+			failures++
+		}
+	}
+	return failures
+}
+
+// Skipped returns the number of checks that never ran.
+func (r *Report) Skipped() int {
+	skipped := 0
+	for _, result := range r.Results {
+		if result.Skipped {
+			skipped++
+		}
+	}
+	return skipped
+}
+
+// Passed reports whether every check ran and succeeded.
+func (r *Report) Passed() bool {
+	return r.Failures() == 0 && r.Skipped() == 0
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+}
+
+type junitTestCase struct {
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the report as JUnit XML, one testcase per check.
+func (r *Report) WriteJUnit(output io.Writer) error {
+	suite := junitTestSuite{
+		Name:      r.Name,
+		Timestamp: r.Timestamp.UTC().Format(time.RFC3339),
+		Cases:     make([]junitTestCase, 0, len(r.Results)),
+		Tests:     len(r.Results),
+		Failures:  r.Failures(),
+		Skipped:   r.Skipped(),
+		Time:      0,
+	}
+
+	for _, result := range r.Results {
+		testCase := junitTestCase{
+			Failure:   nil,
+			Skipped:   nil,
+			Name:      result.Name,
+			ClassName: r.Name,
+			Time:      result.Duration.Seconds(),
+		}
+		if result.Failure != "" {
+			testCase.Failure = &junitFailure{Message: result.Failure}
+		}
+		if result.Skipped {
+			testCase.Skipped = &struct{}{}
+		}
+		suite.Time += testCase.Time
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	if _, err := io.WriteString(output, xml.Header); err != nil {
+		return fmt.Errorf("write junit report: %w", err)
+	}
+
+	var suites junitTestSuites
+	suites.Suites = []junitTestSuite{suite}
+
+	encoder := xml.NewEncoder(output)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return fmt.Errorf("write junit report: %w", err)
+	}
+
+	_, err := io.WriteString(output, "\n")
+	return err
+}
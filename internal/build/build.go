@@ -0,0 +1,475 @@
+// Package build runs the BlackBSD image build on an ephemeral Hetzner server:
+// NetBSD is installed from rescue mode or booted from a cached base snapshot,
+// customized natively, and extracted as disk image and ISO from rescue mode.
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/basecache"
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/customize"
+	"github.com/omarluq/hetzner-blackbsd/internal/extract"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/netbsd"
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/omarluq/hetzner-blackbsd/internal/staging"
+)
+
+const (
+	// RawImageName and ISOName are the artifact file names in the output
+	// directory.
+	RawImageName = "blackbsd.raw.xz"
+	ISOName      = "blackbsd.iso"
+
+	stagingDir          = "/tmp"
+	isoMountPoint       = "/mnt/netbsd"
+	outputDirPermission = 0o750
+)
+
+// Opts configures what a build customizes and produces. Packages are
+// installed with pkg_add; Raw and ISO select the artifacts written to
+// OutputDir.
+type Opts struct {
+	Branding  config.Branding
+	OutputDir string
+	Packages  []string
+	Raw       bool
+	ISO       bool
+}
+
+// Artifact is an image downloaded to the output directory, with the SHA256
+// checksum it was verified against.
+type Artifact struct {
+	Path   string
+	SHA256 string
+}
+
+// Result describes a finished build. FromSnapshot is true when the server
+// booted a cached base snapshot instead of installing NetBSD.
+type Result struct {
+	Artifacts    []Artifact
+	FromSnapshot bool
+}
+
+// Builder runs builds on throwaway servers.
+type Builder struct {
+	client      *hcloud.Client
+	base        *basecache.Cache
+	keys        *ssh.KeyPair
+	hostKeys    *ssh.HostKeys
+	dialer      ssh.Dialer
+	netbsd      runner.Login
+	cached      bool
+	cacheGB     int
+	artifactsGB int
+}
+
+// volumes are the Hetzner volumes attached to a build server, nil when not
+// enabled. The cache is attached first, so on NetBSD it is the first volume
+// and the artifacts volume follows it.
+type volumes struct {
+	cache     *hcloudsdk.Volume
+	artifacts *hcloudsdk.Volume
+}
+
+// New creates a Builder. base installs NetBSD when no cached base snapshot is
+// used; keys authenticate to the rescue system and the installed NetBSD.
+func New(client *hcloud.Client, base *basecache.Cache, keys *ssh.KeyPair) *Builder {
+	return &Builder{
+		client:      client,
+		base:        base,
+		keys:        keys,
+		hostKeys:    ssh.NewHostKeys(),
+		dialer:      nil,
+		netbsd:      runner.RootLogin(),
+		cached:      false,
+		cacheGB:     0,
+		artifactsGB: 0,
+	}
+}
+
+// WithCachedBase boots the newest cached base snapshot matching base's
+// version, arch and disk layout when there is one, skipping the install.
+func (b *Builder) WithCachedBase() *Builder {
+	b.cached = true
+	return b
+}
+
+// WithCacheVolume attaches the location's cache volume of sizeGB to the build
+// server. pkgin keeps the binary packages it downloads there, so later builds
+// reuse them.
+func (b *Builder) WithCacheVolume(sizeGB int) *Builder {
+	b.cacheGB = sizeGB
+	return b
+}
+
+// WithArtifactsVolume creates a per-build artifacts volume of sizeGB, mounted
+// at staging.ArtifactsMount in NetBSD and in rescue, where the artifacts are
+// written instead of the tmpfs-backed rescue root.
+func (b *Builder) WithArtifactsVolume(sizeGB int) *Builder {
+	b.artifactsGB = sizeGB
+	return b
+}
+
+// WithDialer reaches the build server through dialer, such as a jump host or
+// proxy.
+func (b *Builder) WithDialer(dialer ssh.Dialer) *Builder {
+	b.dialer = dialer
+	return b
+}
+
+// WithLogin sets the user the build logs in as on the installed NetBSD.
+// Customization runs as root through the login's escalation; rescue mode is
+// always entered as root.
+func (b *Builder) WithLogin(netbsd runner.Login) *Builder {
+	b.netbsd = netbsd
+	return b
+}
+
+// WithHostKeys verifies the build server's host keys against the build's
+// known hosts store instead of a private in-memory one.
+func (b *Builder) WithHostKeys(store *ssh.HostKeys) *Builder {
+	b.hostKeys = store
+	return b
+}
+
+// Run creates a build server with createOpts, brings up NetBSD on it,
+// customizes it and downloads the artifacts selected by opts. The server is
+// always destroyed with its volumes detached, and the build's firewall and SSH
+// key are cleaned up when it cannot be created.
+func (b *Builder) Run(ctx context.Context, createOpts *hcloud.CreateOpts, opts *Opts) (result *Result, err error) {
+	server, fromSnapshot, err := b.create(ctx, createOpts)
+	if err != nil {
+		buildID := createOpts.Labels[hcloud.BuildIDLabelKey]
+		return nil, errors.Join(err, b.client.CleanupBuild(context.WithoutCancel(ctx), buildID))
+	}
+
+	defer func() {
+		if _, teardownErr := b.client.TeardownServer(context.WithoutCancel(ctx), server); teardownErr != nil {
+			slog.Error("build server teardown failed", "server_id", server.ID, "error", teardownErr)
+			if err == nil {
+				err = teardownErr
+			}
+		}
+	}()
+
+	attached, err := b.attachVolumes(ctx, server, createOpts.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.boot(ctx, server, createOpts.SSHKeyIDs, fromSnapshot); err != nil {
+		return nil, err
+	}
+
+	if err = b.customize(ctx, server, attached, opts); err != nil {
+		return nil, err
+	}
+
+	artifacts, err := b.extract(ctx, server, attached, createOpts.SSHKeyIDs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Artifacts: artifacts, FromSnapshot: fromSnapshot}, nil
+}
+
+// create points createOpts at a cached base snapshot when enabled and one
+// exists, and creates the build server. It reports whether the server boots
+// the snapshot.
+func (b *Builder) create(ctx context.Context, createOpts *hcloud.CreateOpts) (*hcloudsdk.Server, bool, error) {
+	fromSnapshot := false
+	if b.cached {
+		hit, err := b.base.Resolve(ctx, createOpts)
+		if err != nil {
+			return nil, false, err
+		}
+		fromSnapshot = hit
+	}
+
+	server, err := b.client.CreateServer(ctx, createOpts)
+	if err != nil {
+		return nil, false, err
+	}
+	return server, fromSnapshot, nil
+}
+
+// attachVolumes attaches the enabled volumes to server, the cache before the
+// artifacts volume. The artifacts volume carries the build's labels so it is
+// reaped with the build.
+func (b *Builder) attachVolumes(
+	ctx context.Context,
+	server *hcloudsdk.Server,
+	labels map[string]string,
+) (*volumes, error) {
+	var attached volumes
+	if b.cacheGB > 0 {
+		volume, err := b.client.AttachCacheVolume(ctx, server, b.cacheGB)
+		if err != nil {
+			return nil, err
+		}
+		attached.cache = volume
+	}
+
+	if b.artifactsGB > 0 {
+		volume, err := b.client.CreateArtifactsVolume(ctx, server, labels, b.artifactsGB)
+		if err != nil {
+			return nil, err
+		}
+		attached.artifacts = volume
+	}
+
+	return &attached, nil
+}
+
+// boot waits for the server and, unless it booted a cached base snapshot,
+// installs NetBSD from rescue mode and resets the server into it.
+func (b *Builder) boot(ctx context.Context, server *hcloudsdk.Server, sshKeyIDs []int64, fromSnapshot bool) error {
+	if fromSnapshot {
+		return b.client.WaitForServerStatus(ctx, server.ID, hcloudsdk.ServerStatusRunning)
+	}
+
+	if err := b.base.Install(ctx, server, sshKeyIDs); err != nil {
+		return err
+	}
+
+	if err := b.client.DisableRescue(ctx, server); err != nil {
+		return err
+	}
+
+	if err := b.client.ResetServer(ctx, server); err != nil {
+		return err
+	}
+
+	return b.client.WaitForServerStatus(ctx, server.ID, hcloudsdk.ServerStatusRunning)
+}
+
+// customize logs in to the installed NetBSD and applies branding, networking
+// and packages as root. An IPv6-only server gets its static IPv6 address
+// configured so it can reach the package mirrors. The artifacts volume is
+// mounted for the duration as scratch space.
+func (b *Builder) customize(ctx context.Context, server *hcloudsdk.Server, attached *volumes, opts *Opts) error {
+	address := hcloud.ServerAddress(server)
+	if err := b.hostKeys.Expect(address, ssh.PhaseNetBSD); err != nil {
+		return err
+	}
+
+	sshClient := ssh.NewClientWithKeyPair(address, b.keys).
+		WithUser(b.netbsd.User).
+		WithDialer(b.dialer).
+		WithHostKeys(b.hostKeys, ssh.PhaseNetBSD)
+	defer ssh.CloseQuietly(sshClient)
+	if err := sshClient.WaitForReady(ctx); err != nil {
+		return err
+	}
+
+	exec := b.netbsd.Escalate(sshClient)
+	if attached.artifacts != nil {
+		device := netbsd.VolumeDevice(b.base.Key().Arch, attached.index(attached.artifacts))
+		if err := staging.MountNetBSD(ctx, exec, device, staging.ArtifactsMount); err != nil {
+			return err
+		}
+		defer unmount(ctx, exec, server, staging.ArtifactsMount)
+	}
+
+	customizer := customize.New(exec)
+	if err := customizer.ApplyBranding(ctx, opts.Branding); err != nil {
+		return err
+	}
+
+	if err := customizer.ConfigureNetworking(ctx); err != nil {
+		return err
+	}
+
+	if server.PublicNet.IPv4.IP == nil {
+		if err := customizer.ConfigureIPv6(ctx, address); err != nil {
+			return err
+		}
+	}
+
+	return b.installPackages(ctx, exec, server, attached, customizer, opts.Packages)
+}
+
+// installPackages installs packages with pkg_add, or with pkgin through the
+// cache volume when one is attached, so binaries downloaded by earlier builds
+// are not fetched again.
+func (b *Builder) installPackages(
+	ctx context.Context,
+	exec runner.Runner,
+	server *hcloudsdk.Server,
+	attached *volumes,
+	customizer *customize.Customizer,
+	packages []string,
+) error {
+	if attached.cache == nil {
+		return customizer.InstallPackages(ctx, packages)
+	}
+
+	device := netbsd.VolumeDevice(b.base.Key().Arch, attached.index(attached.cache))
+	if err := staging.MountNetBSD(ctx, exec, device, staging.CacheMount); err != nil {
+		return err
+	}
+	defer unmount(ctx, exec, server, staging.CacheMount)
+
+	if err := customizer.UsePackageCache(ctx, staging.PackageCacheDir); err != nil {
+		return err
+	}
+	defer func() {
+		if err := customizer.ReleasePackageCache(context.WithoutCancel(ctx)); err != nil {
+			slog.Warn("release package cache failed", "server_id", server.ID, "error", err)
+		}
+	}()
+
+	return customizer.InstallCachedPackages(ctx, packages)
+}
+
+// index returns volume's position among the attached volumes, which is its
+// NetBSD volume index.
+func (v *volumes) index(volume *hcloudsdk.Volume) int {
+	if volume == v.artifacts && v.cache != nil {
+		return 1
+	}
+	return 0
+}
+
+// unmount unmounts mountPoint, logging a failure: the volume is detached at
+// teardown either way.
+func unmount(ctx context.Context, exec runner.Runner, server *hcloudsdk.Server, mountPoint string) {
+	if err := staging.Unmount(context.WithoutCancel(ctx), exec, mountPoint); err != nil {
+		slog.Warn("unmount volume failed", "server_id", server.ID, "mount_point", mountPoint, "error", err)
+	}
+}
+
+// extract reboots the server into rescue mode, writes the selected artifacts
+// from its disk and downloads them to opts.OutputDir.
+func (b *Builder) extract(
+	ctx context.Context,
+	server *hcloudsdk.Server,
+	attached *volumes,
+	sshKeyIDs []int64,
+	opts *Opts,
+) ([]Artifact, error) {
+	rootPassword, err := b.client.EnterRescue(ctx, server, hcloud.WithRescueSSHKeys(sshKeyIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	address := hcloud.ServerAddress(server)
+	if err = b.hostKeys.Expect(address, ssh.PhaseRescue); err != nil {
+		return nil, err
+	}
+
+	rescue := ssh.NewClientWithKeyPair(address, b.keys).
+		WithDialer(b.dialer).
+		WithHostKeys(b.hostKeys, ssh.PhaseRescue).
+		WithPasswordFallback(rootPassword)
+	defer ssh.CloseQuietly(rescue)
+	if err = rescue.WaitForReady(ctx); err != nil {
+		return nil, err
+	}
+
+	return b.writeArtifacts(ctx, server, rescue, attached, opts)
+}
+
+// writeArtifacts writes the selected artifacts on the rescue system and
+// downloads them. They are staged on the artifacts volume when there is one,
+// and in /tmp otherwise.
+func (b *Builder) writeArtifacts(
+	ctx context.Context,
+	server *hcloudsdk.Server,
+	rescue *ssh.Client,
+	attached *volumes,
+	opts *Opts,
+) ([]Artifact, error) {
+	if err := os.MkdirAll(opts.OutputDir, outputDirPermission); err != nil {
+		return nil, fmt.Errorf("create output dir: %w", err)
+	}
+
+	dir := stagingDir
+	if attached.artifacts != nil {
+		if err := staging.MountRescue(ctx, rescue, attached.artifacts.LinuxDevice, staging.ArtifactsMount); err != nil {
+			return nil, err
+		}
+		defer unmount(ctx, rescue, server, staging.ArtifactsMount)
+		dir = staging.ArtifactsMount
+	}
+
+	extractor := extract.New(rescue, basecache.InstallDevice).WithArch(b.base.Key().Arch)
+	var artifacts []Artifact
+	if opts.Raw {
+		remote := path.Join(dir, RawImageName)
+		if err := extractor.ExtractRawImage(ctx, remote); err != nil {
+			return nil, err
+		}
+
+		artifact, err := download(ctx, extractor, rescue, remote, opts.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	if opts.ISO {
+		artifact, isoErr := extractISO(ctx, extractor, rescue, dir, opts.OutputDir)
+		if isoErr != nil {
+			return nil, isoErr
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts, nil
+}
+
+// extractISO builds the ISO in dir from the disk's root filesystem, mounted
+// read-only at isoMountPoint, and downloads it.
+func extractISO(
+	ctx context.Context,
+	extractor *extract.Extractor,
+	rescue *ssh.Client,
+	dir, outputDir string,
+) (Artifact, error) {
+	result, err := rescue.Exec(ctx, "mkdir -p "+ssh.EscapeShellArg(isoMountPoint))
+	if err != nil {
+		return Artifact{}, fmt.Errorf("create iso mount point: %w", err)
+	}
+	if !result.Success() {
+		return Artifact{}, fmt.Errorf("create iso mount point: exit code %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	remote := path.Join(dir, ISOName)
+	if err = extractor.ExtractISO(ctx, isoMountPoint, remote); err != nil {
+		return Artifact{}, err
+	}
+
+	return download(ctx, extractor, rescue, remote, outputDir)
+}
+
+// download fetches the remote artifact into outputDir, verified against its
+// remote checksum.
+func download(
+	ctx context.Context,
+	extractor *extract.Extractor,
+	rescue *ssh.Client,
+	remote, outputDir string,
+) (Artifact, error) {
+	local := filepath.Join(outputDir, path.Base(remote))
+
+	var opts ssh.DownloadOpts
+	sum, err := extractor.Download(ctx, rescue, remote, local, opts)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	slog.Info("artifact downloaded", "path", local, "sha256", sum)
+	return Artifact{Path: local, SHA256: sum}, nil
+}
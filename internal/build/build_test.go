@@ -0,0 +1,129 @@
+package build_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/basecache"
+	"github.com/omarluq/hetzner-blackbsd/internal/build"
+	"github.com/omarluq/hetzner-blackbsd/internal/config"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createFailure records what a build asked of a Hetzner API that refuses to
+// create its server.
+type createFailure struct {
+	image   string
+	lookups int
+	deleted []string
+	mu      sync.Mutex
+}
+
+// failingCreateAPI serves one cached base snapshot, rejects server creation
+// and records the image asked for and the resources deleted afterwards.
+func failingCreateAPI(t *testing.T) (*hcloud.Client, *createFailure) {
+	t.Helper()
+
+	var failure createFailure
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			failure.mu.Lock()
+			defer failure.mu.Unlock()
+
+			writer.Header().Set("Content-Type", "application/json")
+			switch {
+			case request.Method == http.MethodPost:
+				var body map[string]any
+				assert.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+				failure.image = fmt.Sprint(body["image"])
+				writer.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = writer.Write([]byte(`{"error": {"code": "invalid_input", "message": "bad image"}}`))
+			case request.Method == http.MethodDelete:
+				failure.deleted = append(failure.deleted, request.URL.Path)
+				writer.WriteHeader(http.StatusNoContent)
+			case strings.HasSuffix(request.URL.Path, "/images"):
+				failure.lookups++
+				_, _ = writer.Write([]byte(`{"images": [{"id": 77, "type": "snapshot", "status": "available"}]}`))
+			case strings.HasSuffix(request.URL.Path, "/ssh_keys"):
+				_, _ = writer.Write([]byte(`{"ssh_keys": [{"id": 5, "name": "blackbsd-builder-b1"}]}`))
+			case strings.HasSuffix(request.URL.Path, "/firewalls"):
+				_, _ = writer.Write([]byte(`{"firewalls": [{"id": 7, "name": "blackbsd-builder-b1"}]}`))
+			}
+		}))
+	t.Cleanup(testServer.Close)
+
+	return hcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL)), &failure
+}
+
+func createOpts() *hcloud.CreateOpts {
+	return &hcloud.CreateOpts{
+		Labels:      hcloud.BuildLabels("b1"),
+		Name:        "blackbsd-builder-b1",
+		ServerType:  "cpx31",
+		Image:       "ubuntu-24.04",
+		Location:    "fsn1",
+		SSHKeyIDs:   []int64{5},
+		FirewallIDs: []int64{7},
+		Placements:  nil,
+		ImageID:     0,
+		DisableIPv4: false,
+	}
+}
+
+func buildOpts() *build.Opts {
+	return &build.Opts{
+		Branding:  config.Branding{Hostname: "", MOTD: "", DefaultUser: ""},
+		OutputDir: "",
+		Packages:  nil,
+		Raw:       true,
+		ISO:       true,
+	}
+}
+
+func TestRunCreatesServer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("boots the cached base snapshot", func(t *testing.T) {
+		t.Parallel()
+
+		client, failure := failingCreateAPI(t)
+		base := basecache.New(client, nil, "10.1", "amd64")
+		opts := createOpts()
+
+		_, err := build.New(client, base, nil).WithCachedBase().Run(context.Background(), opts, buildOpts())
+
+		require.Error(t, err)
+		assert.Equal(t, int64(77), opts.ImageID)
+		failure.mu.Lock()
+		defer failure.mu.Unlock()
+		assert.Equal(t, "77", failure.image)
+		assert.ElementsMatch(t, []string{"/ssh_keys/5", "/firewalls/7"}, failure.deleted)
+	})
+
+	t.Run("installs without looking up a snapshot unless enabled", func(t *testing.T) {
+		t.Parallel()
+
+		client, failure := failingCreateAPI(t)
+		base := basecache.New(client, nil, "10.1", "amd64")
+		opts := createOpts()
+
+		_, err := build.New(client, base, nil).Run(context.Background(), opts, buildOpts())
+
+		require.Error(t, err)
+		assert.Zero(t, opts.ImageID)
+		failure.mu.Lock()
+		defer failure.mu.Unlock()
+		assert.Equal(t, "ubuntu-24.04", failure.image)
+		assert.Zero(t, failure.lookups)
+		assert.ElementsMatch(t, []string{"/ssh_keys/5", "/firewalls/7"}, failure.deleted)
+	})
+}
@@ -1,17 +1,36 @@
 // Package config defines the configuration model for blackbsd.
 package config
 
+import "time"
+
 // Config is the root configuration for blackbsd.
 type Config struct {
-	Branding       Branding `yaml:"branding"`
-	HCloudToken    string   `yaml:"hcloud_token"`
-	SSHKeyPath     string   `yaml:"ssh_key_path"`
-	ServerType     string   `yaml:"server_type"`
-	Location       string   `yaml:"location"`
-	Image          string   `yaml:"image"`
-	OutputISO      bool     `yaml:"output_iso"`
-	OutputRaw      bool     `yaml:"output_raw"`
-	BuildDiskImage bool     `yaml:"build_disk_image"`
+	Branding       Branding  `yaml:"branding"`
+	Firewall       Firewall  `yaml:"firewall"`
+	Network        Network   `yaml:"network"`
+	SSHKeys        SSHKeys   `yaml:"ssh_keys"`
+	SSHUsers       SSHUsers  `yaml:"ssh_users"`
+	SSH            SSH       `yaml:"ssh"`
+	HCloudToken    string    `yaml:"hcloud_token"`
+	SSHKeyPath     string    `yaml:"ssh_key_path"`
+	ServerType     string    `yaml:"server_type"`
+	Location       string    `yaml:"location"`
+	ServerTypes    []string  `yaml:"server_types"`
+	Locations      []string  `yaml:"locations"`
+	SecurityTools  []string  `yaml:"security_tools"`
+	Image          string    `yaml:"image"`
+	NetBSDVersion  string    `yaml:"netbsd_version"`
+	NetBSDArch     string    `yaml:"netbsd_arch"`
+	OutputDir      string    `yaml:"output_dir"`
+	BaseCache      BaseCache `yaml:"base_cache"`
+	Reap           Reap      `yaml:"reap"`
+	Publish        Publish   `yaml:"publish"`
+	Volumes        Volumes   `yaml:"volumes"`
+	Pool           Pool      `yaml:"pool"`
+	OutputISO      bool      `yaml:"output_iso"`
+	OutputRaw      bool      `yaml:"output_raw"`
+	BuildDiskImage bool      `yaml:"build_disk_image"`
+	DeployTestVM   bool      `yaml:"deploy_test_vm"`
 }
 
 // Branding holds the customization settings for the built image.
@@ -21,6 +40,103 @@ type Branding struct {
 	DefaultUser string `yaml:"default_user"`
 }
 
+// Firewall holds the per-build SSH firewall settings.
+// When AllowedCIDRs is empty the operator's public IP is detected at build time.
+type Firewall struct {
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+	Enabled      bool     `yaml:"enabled"`
+}
+
+// Network controls the public networking of build servers. With IPv4 disabled
+// servers are IPv6-only and reached on the ::1 address of their /64.
+type Network struct {
+	IPv4 bool `yaml:"ipv4"`
+}
+
+// SSHKeys controls how the build authenticates to its servers.
+// Ephemeral keys are generated in memory per build and deleted at teardown;
+// ExportPath, when set, writes the private key to disk for debugging. Agent
+// makes the personal key come from ssh-agent instead of ssh_key_path, which
+// then only selects the agent key by its .pub file.
+type SSHKeys struct {
+	ExportPath string `yaml:"export_path"`
+	Ephemeral  bool   `yaml:"ephemeral"`
+	Agent      bool   `yaml:"agent"`
+}
+
+// SSHUsers sets the login user of each phase: the Hetzner rescue system,
+// which only allows root and is always entered as root, and the installed
+// NetBSD. A NetBSD user other than root runs commands as root through
+// Escalation, doas or sudo, which must not ask for a password.
+type SSHUsers struct {
+	Rescue     string `yaml:"rescue"`
+	NetBSD     string `yaml:"netbsd"`
+	Escalation string `yaml:"escalation"`
+}
+
+// SSH controls how build servers are reached. With ProxyJump set every
+// connection is tunnelled through that bastion host. Proxy, a socks5:// or
+// http:// URL, carries the connection to the bastion, or to the servers
+// directly without one.
+type SSH struct {
+	ProxyJump ProxyJump `yaml:"proxy_jump"`
+	Proxy     string    `yaml:"proxy"`
+}
+
+// ProxyJump is a bastion host. Without KeyPath it is reached with the
+// personal key: ssh-agent when ssh_keys.agent is set, else ssh_key_path.
+type ProxyJump struct {
+	Host    string `yaml:"host"`
+	User    string `yaml:"user"`
+	KeyPath string `yaml:"key_path"`
+	Port    int    `yaml:"port"`
+}
+
+// BaseCache controls caching of the post-install NetBSD base as a snapshot.
+// Enabled makes build boot a matching snapshot instead of installing NetBSD.
+// Keep is the number of snapshots retained per version, arch and layout.
+type BaseCache struct {
+	Enabled bool `yaml:"enabled"`
+	Keep    int  `yaml:"keep"`
+}
+
+// Reap controls expiry of the resources created for a build. Each one is
+// labelled to expire TTL after creation; BeforeBuild reaps expired resources
+// before provisioning a new build.
+type Reap struct {
+	TTL         time.Duration `yaml:"ttl"`
+	BeforeBuild bool          `yaml:"before_build"`
+}
+
+// Publish controls the publish command, which snapshots the finished disk as
+// a bootable image on Hetzner. Keep is the number of image snapshots retained
+// per version and arch; 0 disables pruning. PinHostKey installs a host key
+// generated by the build into the image and pins it, instead of letting each
+// server created from the image generate its own.
+type Publish struct {
+	Keep       int  `yaml:"keep"`
+	PinHostKey bool `yaml:"pin_host_key"`
+}
+
+// Volumes controls Hetzner volumes attached to build servers. Artifacts adds a
+// per-build volume that stages output images and survives teardown until it
+// is reaped; Cache reuses one volume per location for NetBSD install media
+// and pkgsrc binaries. Sizes are in GB.
+type Volumes struct {
+	ArtifactsSizeGB int  `yaml:"artifacts_size_gb"`
+	CacheSizeGB     int  `yaml:"cache_size_gb"`
+	Artifacts       bool `yaml:"artifacts"`
+	Cache           bool `yaml:"cache"`
+}
+
+// Pool keeps a warm build server between builds. Instead of creating and
+// deleting a server per build it is reset with the Hetzner rebuild action, and
+// it is destroyed once it has sat idle for IdleTimeout.
+type Pool struct {
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	Enabled     bool          `yaml:"enabled"`
+}
+
 // Defaults returns a Config populated with sensible default values.
 func Defaults() Config {
 	return Config{
@@ -28,14 +144,87 @@ func Defaults() Config {
 		SSHKeyPath:     "",
 		ServerType:     "cpx31",
 		Location:       "fsn1",
+		ServerTypes:    nil,
+		Locations:      nil,
+		SecurityTools:  nil,
 		Image:          "ubuntu-24.04",
+		NetBSDVersion:  "10.1",
+		NetBSDArch:     "amd64",
+		OutputDir:      "./output",
 		OutputISO:      true,
 		OutputRaw:      false,
 		BuildDiskImage: true,
+		DeployTestVM:   false,
 		Branding: Branding{
 			Hostname:    "blackbsd",
 			MOTD:        "Welcome to BlackBSD",
 			DefaultUser: "security",
 		},
+		Firewall: Firewall{
+			AllowedCIDRs: nil,
+			Enabled:      true,
+		},
+		Network: Network{
+			IPv4: true,
+		},
+		SSHKeys: SSHKeys{
+			ExportPath: "",
+			Ephemeral:  true,
+			Agent:      false,
+		},
+		SSH: SSH{
+			ProxyJump: ProxyJump{
+				Host:    "",
+				User:    "",
+				KeyPath: "",
+				Port:    22,
+			},
+			Proxy: "",
+		},
+		SSHUsers: SSHUsers{
+			Rescue:     "root",
+			NetBSD:     "root",
+			Escalation: "doas",
+		},
+		BaseCache: BaseCache{
+			Enabled: false,
+			Keep:    1,
+		},
+		Reap: Reap{
+			TTL:         6 * time.Hour,
+			BeforeBuild: false,
+		},
+		Publish: Publish{
+			Keep:       3,
+			PinHostKey: true,
+		},
+		Pool: Pool{
+			IdleTimeout: time.Hour,
+			Enabled:     false,
+		},
+		Volumes: Volumes{
+			ArtifactsSizeGB: 20,
+			CacheSizeGB:     20,
+			Artifacts:       false,
+			Cache:           false,
+		},
+	}
+}
+
+// ServerTypePreferences returns server_types in order, or server_type alone when
+// no preference list is configured.
+func (c *Config) ServerTypePreferences() []string {
+	if len(c.ServerTypes) > 0 {
+		return c.ServerTypes
+	}
+	return []string{c.ServerType}
+}
+
+// LocationPreferences returns locations in order, or location alone when no
+// preference list is configured.
+func (c *Config) LocationPreferences() []string {
+	if len(c.Locations) > 0 {
+		return c.Locations
 	}
+	return []string{c.Location}
 }
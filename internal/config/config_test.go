@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/omarluq/hetzner-blackbsd/internal/config"
 	"github.com/stretchr/testify/assert"
@@ -76,6 +77,18 @@ func TestLoad(t *testing.T) {
 		assert.True(t, cfg.OutputISO)
 	})
 
+	t.Run("parses reap ttl duration", func(t *testing.T) {
+		t.Parallel()
+
+		keyPath := writeSSHKey(t)
+		configPath := writeConfigFile(t, validConfigYAML(keyPath)+"reap:\n  ttl: 90m\n  before_build: true\n")
+
+		cfg, err := config.Load(configPath)
+		require.NoError(t, err)
+		assert.Equal(t, 90*time.Minute, cfg.Reap.TTL)
+		assert.True(t, cfg.Reap.BeforeBuild)
+	})
+
 	t.Run("error for missing file", func(t *testing.T) {
 		t.Parallel()
 
@@ -117,6 +130,21 @@ func TestDefaults(t *testing.T) {
 	assert.Equal(t, "cpx31", cfg.ServerType)
 	assert.Equal(t, "fsn1", cfg.Location)
 	assert.Equal(t, "ubuntu-24.04", cfg.Image)
+	assert.Equal(t, "10.1", cfg.NetBSDVersion)
+	assert.Equal(t, "amd64", cfg.NetBSDArch)
+	assert.Equal(t, "./output", cfg.OutputDir)
+	assert.False(t, cfg.BaseCache.Enabled)
+	assert.Equal(t, 1, cfg.BaseCache.Keep)
+	assert.Equal(t, 6*time.Hour, cfg.Reap.TTL)
+	assert.False(t, cfg.Reap.BeforeBuild)
+	assert.Equal(t, 3, cfg.Publish.Keep)
+	assert.True(t, cfg.Publish.PinHostKey)
+	assert.False(t, cfg.Volumes.Artifacts)
+	assert.False(t, cfg.Volumes.Cache)
+	assert.Equal(t, 20, cfg.Volumes.CacheSizeGB)
+	assert.True(t, cfg.SSHKeys.Ephemeral)
+	assert.True(t, cfg.Network.IPv4)
+	assert.Empty(t, cfg.SSHKeys.ExportPath)
 	assert.True(t, cfg.OutputISO)
 	assert.False(t, cfg.OutputRaw)
 	assert.True(t, cfg.BuildDiskImage)
@@ -149,16 +177,105 @@ func TestValidateRequiredFields(t *testing.T) {
 		assert.Contains(t, err.Error(), "hcloud_token")
 	})
 
-	t.Run("empty ssh_key_path fails", func(t *testing.T) {
+	t.Run("empty ssh_key_path fails without ephemeral keys", func(t *testing.T) {
 		t.Parallel()
 
 		cfg := config.Defaults()
 		cfg.HCloudToken = testToken
+		cfg.SSHKeys.Ephemeral = false
 		err := config.Validate(&cfg)
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "ssh_key_path")
 	})
 
+	t.Run("empty ssh_key_path passes with ephemeral keys", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		assert.NoError(t, config.Validate(&cfg))
+	})
+
+	t.Run("empty ssh_key_path passes with ssh-agent", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeys.Ephemeral = false
+		cfg.SSHKeys.Agent = true
+		assert.NoError(t, config.Validate(&cfg))
+	})
+
+	t.Run("unknown ssh_users.escalation fails", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHUsers.Escalation = "su"
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ssh_users.escalation")
+	})
+
+	t.Run("ssh_users.rescue must be root", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHUsers.Rescue = "blackbsd"
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ssh_users.rescue")
+	})
+
+	t.Run("ssh.proxy must be a supported URL", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.Firewall.AllowedCIDRs = []string{"198.51.100.7/32"}
+		cfg.SSH.Proxy = "ftp://proxy.example.com:21"
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ssh.proxy")
+
+		cfg.SSH.Proxy = "socks5://proxy.example.com:1080"
+		assert.NoError(t, config.Validate(&cfg))
+	})
+
+	t.Run("ssh.proxy_jump needs a user and a key", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.Firewall.AllowedCIDRs = []string{"198.51.100.7/32"}
+		cfg.SSH.ProxyJump.Host = "bastion.example.com"
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ssh.proxy_jump.user")
+
+		cfg.SSH.ProxyJump.User = "jump"
+		err = config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ssh.proxy_jump.key_path")
+
+		cfg.SSHKeys.Agent = true
+		assert.NoError(t, config.Validate(&cfg))
+	})
+
+	t.Run("ssh.proxy_jump needs allowed_cidrs with the firewall on", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeys.Agent = true
+		cfg.SSH.ProxyJump.Host = "bastion.example.com"
+		cfg.SSH.ProxyJump.User = "jump"
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "firewall.allowed_cidrs")
+	})
+
 	t.Run("nonexistent ssh_key_path fails", func(t *testing.T) {
 		t.Parallel()
 
@@ -201,6 +318,80 @@ func TestValidateConstraints(t *testing.T) {
 		assert.Contains(t, err.Error(), "output")
 	})
 
+	t.Run("invalid firewall cidr fails", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeyPath = keyPath
+		cfg.Firewall.AllowedCIDRs = []string{"203.0.113.7"}
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "firewall.allowed_cidrs")
+	})
+
+	t.Run("non-positive reap ttl fails", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeyPath = keyPath
+		cfg.Reap.TTL = 0
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "reap.ttl")
+	})
+
+	t.Run("negative publish keep fails", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeyPath = keyPath
+		cfg.Publish.Keep = -1
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "publish.keep")
+	})
+
+	t.Run("non-positive pool idle timeout fails", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeyPath = keyPath
+		cfg.Pool.Enabled = true
+		cfg.Pool.IdleTimeout = 0
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pool.idle_timeout")
+	})
+
+	t.Run("undersized cache volume fails", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeyPath = keyPath
+		cfg.Volumes.Cache = true
+		cfg.Volumes.CacheSizeGB = 5
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "volumes.cache_size_gb")
+	})
+
+	t.Run("invalid location in preference list fails", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+		cfg.HCloudToken = testToken
+		cfg.SSHKeyPath = keyPath
+		cfg.Locations = []string{"fsn1", "mars1"}
+		err := config.Validate(&cfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "mars1")
+	})
+
 	t.Run("all valid locations accepted", func(t *testing.T) {
 		t.Parallel()
 
@@ -213,3 +404,74 @@ func TestValidateConstraints(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateArch(t *testing.T) {
+	t.Parallel()
+
+	keyPath := writeSSHKey(t)
+
+	tests := []struct {
+		name        string
+		arch        string
+		errContains string
+		serverTypes []string
+	}{
+		{name: "amd64 on x86 types", arch: "amd64", serverTypes: []string{"cpx31", "cx32"}, errContains: ""},
+		{name: "aarch64 on CAX types", arch: "evbarm-aarch64", serverTypes: []string{"cax21", "cax31"},
+			errContains: ""},
+		{name: "unsupported arch", arch: "sparc64", serverTypes: nil, errContains: "netbsd_arch"},
+		{name: "aarch64 on x86 type", arch: "evbarm-aarch64", serverTypes: []string{"cax21", "cpx31"},
+			errContains: "cpx31 does not match"},
+		{name: "amd64 on CAX type", arch: "amd64", serverTypes: []string{"cax21"},
+			errContains: "cax21 does not match"},
+	}
+
+	for _, tt := range tests {
+		testCase := tt
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Defaults()
+			cfg.HCloudToken = testToken
+			cfg.SSHKeyPath = keyPath
+			cfg.NetBSDArch = testCase.arch
+			cfg.ServerTypes = testCase.serverTypes
+
+			err := config.Validate(&cfg)
+			if testCase.errContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testCase.errContains)
+		})
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	t.Parallel()
+
+	t.Run("falls back to single values", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.Defaults()
+
+		assert.Equal(t, []string{"cpx31"}, cfg.ServerTypePreferences())
+		assert.Equal(t, []string{"fsn1"}, cfg.LocationPreferences())
+	})
+
+	t.Run("uses ordered lists when configured", func(t *testing.T) {
+		t.Parallel()
+
+		keyPath := writeSSHKey(t)
+		configPath := writeConfigFile(t, validConfigYAML(keyPath)+`server_types: [cpx31, cpx41, ccx23]
+locations: [fsn1, nbg1, hel1]
+`)
+
+		cfg, err := config.Load(configPath)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cpx31", "cpx41", "ccx23"}, cfg.ServerTypePreferences())
+		assert.Equal(t, []string{"fsn1", "nbg1", "hel1"}, cfg.LocationPreferences())
+	})
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"net"
+	"net/url"
 	"os"
 	"strings"
 )
@@ -8,20 +10,88 @@ import (
 // ValidLocations lists the Hetzner datacenter locations.
 var ValidLocations = []string{"fsn1", "nbg1", "hel1", "ash", "hil", "sin"}
 
+// minVolumeSizeGB is the smallest volume Hetzner will create.
+const minVolumeSizeGB = 10
+
+// ValidArchs lists the NetBSD ports that run on Hetzner server types.
+var ValidArchs = []string{"amd64", "evbarm-aarch64"}
+
+// ValidEscalations lists the tools that run commands as root for non-root SSH users.
+var ValidEscalations = []string{"doas", "sudo"}
+
+// armServerTypePrefix marks Hetzner's Ampere (ARM64) server types.
+const armServerTypePrefix = "cax"
+
 // Validate checks the configuration for required fields and valid values.
 func Validate(cfg *Config) error {
 	if cfg.HCloudToken == "" {
 		return &Error{Field: "hcloud_token", Message: "required (set in config or HCLOUD_TOKEN env)"}
 	}
 
-	if cfg.SSHKeyPath == "" {
-		return &Error{Field: "ssh_key_path", Message: "required"}
+	if err := validateSSHKeyPath(cfg); err != nil {
+		return err
 	}
 
-	if _, err := os.Stat(cfg.SSHKeyPath); os.IsNotExist(err) {
-		return &Error{Field: "ssh_key_path", Message: "file does not exist: " + cfg.SSHKeyPath}
+	if err := validateSSH(cfg); err != nil {
+		return err
+	}
+
+	if err := validateLocations(cfg); err != nil {
+		return err
+	}
+
+	if err := validateArch(cfg); err != nil {
+		return err
+	}
+
+	if !cfg.OutputISO && !cfg.OutputRaw {
+		return &Error{Field: "output_iso/output_raw", Message: "at least one output format must be enabled"}
+	}
+
+	if err := validateRetention(cfg); err != nil {
+		return err
+	}
+
+	if err := validateVolumes(&cfg.Volumes); err != nil {
+		return err
+	}
+
+	return validateFirewall(&cfg.Firewall)
+}
+
+func validateRetention(cfg *Config) error {
+	if cfg.BaseCache.Keep < 1 {
+		return &Error{Field: "base_cache.keep", Message: "must be at least 1"}
+	}
+
+	if cfg.Publish.Keep < 0 {
+		return &Error{Field: "publish.keep", Message: "must not be negative"}
+	}
+
+	if cfg.Reap.TTL <= 0 {
+		return &Error{Field: "reap.ttl", Message: "must be a positive duration"}
+	}
+
+	if cfg.Pool.Enabled && cfg.Pool.IdleTimeout <= 0 {
+		return &Error{Field: "pool.idle_timeout", Message: "must be a positive duration"}
+	}
+
+	return nil
+}
+
+func validateVolumes(volumes *Volumes) error {
+	if volumes.Artifacts && volumes.ArtifactsSizeGB < minVolumeSizeGB {
+		return &Error{Field: "volumes.artifacts_size_gb", Message: "must be at least 10"}
+	}
+
+	if volumes.Cache && volumes.CacheSizeGB < minVolumeSizeGB {
+		return &Error{Field: "volumes.cache_size_gb", Message: "must be at least 10"}
 	}
 
+	return nil
+}
+
+func validateLocations(cfg *Config) error {
 	if !contains(ValidLocations, cfg.Location) {
 		return &Error{
 			Field:   "location",
@@ -29,13 +99,154 @@ func Validate(cfg *Config) error {
 		}
 	}
 
-	if !cfg.OutputISO && !cfg.OutputRaw {
-		return &Error{Field: "output_iso/output_raw", Message: "at least one output format must be enabled"}
+	for _, location := range cfg.Locations {
+		if !contains(ValidLocations, location) {
+			return &Error{
+				Field:   "locations",
+				Message: location + " is not a valid Hetzner datacenter: " + strings.Join(ValidLocations, ", "),
+			}
+		}
 	}
 
 	return nil
 }
 
+// validateArch checks that every preferred server type matches netbsd_arch:
+// CAX types are ARM64 and need evbarm-aarch64, everything else is x86.
+func validateArch(cfg *Config) error {
+	if !contains(ValidArchs, cfg.NetBSDArch) {
+		return &Error{Field: "netbsd_arch", Message: "must be one of: " + strings.Join(ValidArchs, ", ")}
+	}
+
+	wantARM := cfg.NetBSDArch == "evbarm-aarch64"
+	for _, serverType := range cfg.ServerTypePreferences() {
+		if strings.HasPrefix(serverType, armServerTypePrefix) != wantARM {
+			return &Error{
+				Field:   "server_type",
+				Message: serverType + " does not match netbsd_arch " + cfg.NetBSDArch,
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSSHKeyPath requires a personal key only when ephemeral build keys
+// are disabled and the key does not come from ssh-agent.
+func validateSSHKeyPath(cfg *Config) error {
+	if cfg.SSHKeyPath == "" {
+		if cfg.SSHKeys.Ephemeral || cfg.SSHKeys.Agent {
+			return nil
+		}
+		return &Error{Field: "ssh_key_path", Message: "required when ssh_keys.ephemeral and ssh_keys.agent are false"}
+	}
+
+	if _, err := os.Stat(cfg.SSHKeyPath); os.IsNotExist(err) {
+		return &Error{Field: "ssh_key_path", Message: "file does not exist: " + cfg.SSHKeyPath}
+	}
+
+	return nil
+}
+
+// ValidProxySchemes lists the proxy URL schemes ssh.proxy accepts.
+var ValidProxySchemes = []string{"socks5", "socks5h", "http"}
+
+// maxPort is the highest TCP port.
+const maxPort = 65535
+
+// rescueUser is the only user the Hetzner rescue system logs in.
+const rescueUser = "root"
+
+func validateSSH(cfg *Config) error {
+	if err := validateSSHUsers(&cfg.SSHUsers); err != nil {
+		return err
+	}
+
+	if cfg.SSH.Proxy != "" {
+		if err := validateProxy(cfg.SSH.Proxy); err != nil {
+			return err
+		}
+	}
+
+	if cfg.SSH.ProxyJump.Host != "" {
+		if err := validateProxyJump(cfg); err != nil {
+			return err
+		}
+	}
+
+	// Servers see the bastion's or the proxy's address, not the one detected.
+	indirect := cfg.SSH.ProxyJump.Host != "" || cfg.SSH.Proxy != ""
+	if indirect && cfg.Firewall.Enabled && len(cfg.Firewall.AllowedCIDRs) == 0 {
+		return &Error{
+			Field:   "firewall.allowed_cidrs",
+			Message: "required when reaching servers through ssh.proxy_jump or ssh.proxy",
+		}
+	}
+
+	return nil
+}
+
+func validateProxy(proxy string) error {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || !contains(ValidProxySchemes, proxyURL.Scheme) || proxyURL.Host == "" {
+		return &Error{
+			Field:   "ssh.proxy",
+			Message: "must be a URL with scheme " + strings.Join(ValidProxySchemes, ", "),
+		}
+	}
+	return nil
+}
+
+func validateProxyJump(cfg *Config) error {
+	jump := &cfg.SSH.ProxyJump
+	if jump.User == "" {
+		return &Error{Field: "ssh.proxy_jump.user", Message: "required"}
+	}
+
+	if jump.Port < 1 || jump.Port > maxPort {
+		return &Error{Field: "ssh.proxy_jump.port", Message: "must be between 1 and 65535"}
+	}
+
+	if jump.KeyPath == "" {
+		if cfg.SSHKeys.Agent || cfg.SSHKeyPath != "" {
+			return nil
+		}
+		return &Error{Field: "ssh.proxy_jump.key_path", Message: "required without ssh_key_path or ssh_keys.agent"}
+	}
+
+	if _, err := os.Stat(jump.KeyPath); os.IsNotExist(err) {
+		return &Error{Field: "ssh.proxy_jump.key_path", Message: "file does not exist: " + jump.KeyPath}
+	}
+
+	return nil
+}
+
+func validateSSHUsers(users *SSHUsers) error {
+	// Hetzner's rescue system offers no other login.
+	if users.Rescue != rescueUser {
+		return &Error{Field: "ssh_users.rescue", Message: "must be " + rescueUser}
+	}
+
+	if users.NetBSD == "" {
+		return &Error{Field: "ssh_users.netbsd", Message: "required"}
+	}
+
+	if !contains(ValidEscalations, users.Escalation) {
+		return &Error{Field: "ssh_users.escalation", Message: "must be one of: " + strings.Join(ValidEscalations, ", ")}
+	}
+
+	return nil
+}
+
+func validateFirewall(firewall *Firewall) error {
+	for _, cidr := range firewall.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return &Error{Field: "firewall.allowed_cidrs", Message: "invalid CIDR: " + cidr}
+		}
+	}
+	return nil
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
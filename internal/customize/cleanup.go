@@ -0,0 +1,44 @@
+package customize
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PrepareSnapshot removes per-host state before the disk is snapshotted as a
+// reusable image: SSH host keys (sshd regenerates them on first boot), DHCP
+// leases, temporary files, shell history and log contents. Interface configs,
+// such as the one ConfigureIPv6 writes, are kept. With keepHostKey the ed25519
+// host key installed by InstallHostKey stays, so servers created from the
+// image present the key the build pinned. It finishes with a sync so the
+// snapshot sees a consistent filesystem.
+func (c *Customizer) PrepareSnapshot(ctx context.Context, keepHostKey bool) error {
+	removeHostKeys := "rm -f /etc/ssh/ssh_host_*"
+	if keepHostKey {
+		removeHostKeys = fmt.Sprintf("find /etc/ssh -name 'ssh_host_*' ! -name '%s*' -exec rm -f {} +",
+			path.Base(hostKeyPath))
+	}
+
+	command := strings.Join([]string{
+		removeHostKeys,
+		"rm -f /var/db/dhcpcd/*",
+		"rm -rf /tmp/* /var/tmp/*",
+		"rm -f /root/.sh_history /root/.history",
+		`find /var/log -type f -exec cp /dev/null {} \;`,
+		"sync",
+	}, " && ")
+
+	result, execErr := c.runner.Exec(ctx, command)
+	if execErr != nil {
+		return fmt.Errorf("prepare snapshot: %w", execErr)
+	}
+
+	if !result.Success() {
+		return fmt.Errorf("prepare snapshot: exited %d: %s",
+			result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+
+	return nil
+}
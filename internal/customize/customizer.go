@@ -10,7 +10,8 @@ type Customizer struct {
 	runner runner.Runner
 }
 
-// New creates a Customizer backed by the given Runner.
+// New creates a Customizer backed by the given Runner, which must run commands
+// as root; wrap a non-root login with runner.Login.Escalate.
 func New(exec runner.Runner) *Customizer {
 	return &Customizer{runner: exec}
 }
@@ -2,6 +2,8 @@ package customize_test
 
 import (
 	"context"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/omarluq/hetzner-blackbsd/internal/config"
@@ -215,6 +217,7 @@ func TestConfigureNetworking(t *testing.T) {
 		assert.Contains(t, runner.commands[0], "/etc/rc.conf")
 		assert.Contains(t, runner.commands[1], "1.1.1.1")
 		assert.Contains(t, runner.commands[1], "8.8.8.8")
+		assert.Contains(t, runner.commands[1], "2606:4700:4700::1111")
 		assert.Contains(t, runner.commands[1], "/etc/resolv.conf")
 	})
 
@@ -252,3 +255,143 @@ func TestDefaultSecurityTools(t *testing.T) {
 	assert.Equal(t, expectedTools, tools)
 	assert.Len(t, tools, 10)
 }
+
+func TestConfigureIPv6(t *testing.T) {
+	t.Parallel()
+
+	t.Run("assigns address and default route", func(t *testing.T) {
+		t.Parallel()
+
+		runner := &mockRunner{err: nil, results: nil, commands: nil}
+		customizer := customize.New(runner)
+
+		ipv6Err := customizer.ConfigureIPv6(context.Background(), "2001:db8:1:2::1")
+
+		require.NoError(t, ipv6Err)
+		require.Len(t, runner.commands, 1)
+		assert.Contains(t, runner.commands[0], `"inet6 2001:db8:1:2::1 prefixlen 64" >> /etc/ifconfig.$iface`)
+		assert.Contains(t, runner.commands[0], `"ip6mode=host" >> /etc/rc.conf`)
+		assert.Contains(t, runner.commands[0], `"defaultroute6=fe80::1%${iface}" >> /etc/rc.conf`)
+	})
+
+	t.Run("rejects non-IPv6 address", func(t *testing.T) {
+		t.Parallel()
+
+		runner := &mockRunner{err: nil, results: nil, commands: nil}
+		customizer := customize.New(runner)
+
+		ipv6Err := customizer.ConfigureIPv6(context.Background(), "192.0.2.1")
+
+		require.Error(t, ipv6Err)
+		assert.Empty(t, runner.commands)
+	})
+
+	t.Run("returns error when command fails", func(t *testing.T) {
+		t.Parallel()
+
+		runner := &mockRunner{err: assert.AnError, results: nil, commands: nil}
+		customizer := customize.New(runner)
+
+		ipv6Err := customizer.ConfigureIPv6(context.Background(), "2001:db8::1")
+
+		require.Error(t, ipv6Err)
+		assert.Contains(t, ipv6Err.Error(), "ipv6")
+	})
+}
+
+func TestPrepareSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("removes host state, keeps interface configs and syncs", func(t *testing.T) {
+		t.Parallel()
+
+		runner := &mockRunner{err: nil, results: nil, commands: nil}
+
+		require.NoError(t, customize.New(runner).PrepareSnapshot(context.Background(), false))
+		require.Len(t, runner.commands, 1)
+		assert.Contains(t, runner.commands[0], "rm -f /etc/ssh/ssh_host_*")
+		assert.NotContains(t, runner.commands[0], "/etc/ifconfig")
+		assert.Contains(t, runner.commands[0], `find /var/log -type f -exec cp /dev/null {} \;`)
+		assert.True(t, strings.HasSuffix(runner.commands[0], "&& sync"))
+	})
+
+	t.Run("keeps the pinned host key", func(t *testing.T) {
+		t.Parallel()
+
+		runner := &mockRunner{err: nil, results: nil, commands: nil}
+
+		require.NoError(t, customize.New(runner).PrepareSnapshot(context.Background(), true))
+		require.Len(t, runner.commands, 1)
+		assert.NotContains(t, runner.commands[0], "rm -f /etc/ssh/ssh_host_*")
+		assert.Contains(t, runner.commands[0],
+			"find /etc/ssh -name 'ssh_host_*' ! -name 'ssh_host_ed25519_key*' -exec rm -f {} +")
+	})
+
+	t.Run("returns error when command fails", func(t *testing.T) {
+		t.Parallel()
+
+		runner := &mockRunner{err: assert.AnError, results: nil, commands: nil}
+
+		err := customize.New(runner).PrepareSnapshot(context.Background(), false)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "prepare snapshot")
+	})
+}
+
+func TestUsePackageCache(t *testing.T) {
+	t.Parallel()
+
+	runner := &mockRunner{err: nil, results: nil, commands: nil}
+	customizer := customize.New(runner)
+
+	require.NoError(t, customizer.UsePackageCache(context.Background(), "/mnt/cache/packages"))
+	require.NoError(t, customizer.InstallCachedPackages(context.Background(), []string{"nmap"}))
+	require.NoError(t, customizer.ReleasePackageCache(context.Background()))
+	assert.Equal(t, []string{
+		"mkdir -p '/mnt/cache/packages' /var/db/pkgin/cache && " +
+			"mount_null '/mnt/cache/packages' /var/db/pkgin/cache",
+		"command -v pkgin >/dev/null || pkg_add -v pkgin",
+		"pkgin -y install 'nmap'",
+		"umount /var/db/pkgin/cache",
+	}, runner.commands)
+}
+
+func TestInstallHostKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("writes the key pair and restarts sshd", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := ssh.GenerateKeyPair()
+		require.NoError(t, err)
+
+		runner := &mockRunner{err: nil, results: nil, commands: nil}
+
+		require.NoError(t, customize.New(runner).InstallHostKey(context.Background(), key))
+		require.Len(t, runner.commands, 1)
+		assert.True(t, strings.HasPrefix(runner.commands[0], "umask 077 && "))
+		assert.Contains(t, runner.commands[0], "BEGIN OPENSSH PRIVATE KEY")
+		assert.Contains(t, runner.commands[0], "> /etc/ssh/ssh_host_ed25519_key &&")
+		assert.Contains(t, runner.commands[0], key.AuthorizedKey())
+		assert.True(t, strings.HasSuffix(runner.commands[0], "&& /etc/rc.d/sshd restart"))
+	})
+
+	t.Run("rejects a key loaded from disk", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "id_ed25519")
+		generated, err := ssh.GenerateKeyPair()
+		require.NoError(t, err)
+		require.NoError(t, generated.Export(path))
+
+		loaded, err := ssh.LoadKeyPair(path)
+		require.NoError(t, err)
+
+		runner := &mockRunner{err: nil, results: nil, commands: nil}
+
+		err = customize.New(runner).InstallHostKey(context.Background(), loaded)
+		require.ErrorIs(t, err, ssh.ErrKeyNotExportable)
+		assert.Empty(t, runner.commands)
+	})
+}
@@ -0,0 +1,41 @@
+package customize
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+const hostKeyPath = "/etc/ssh/ssh_host_ed25519_key"
+
+// InstallHostKey replaces the host's ed25519 SSH host key with key and
+// restarts sshd, so the build can pin a host key it generated itself instead
+// of trusting whatever NetBSD created on first boot. Open sessions survive
+// the restart; new connections present key.
+func (c *Customizer) InstallHostKey(ctx context.Context, key *ssh.KeyPair) error {
+	private, err := key.PrivateKeyPEM()
+	if err != nil {
+		return fmt.Errorf("install host key: %w", err)
+	}
+
+	command := strings.Join([]string{
+		"umask 077",
+		fmt.Sprintf("printf %%s %s > %s", ssh.EscapeShellArg(string(private)), hostKeyPath),
+		fmt.Sprintf("printf '%%s\\n' %s > %s.pub", ssh.EscapeShellArg(key.AuthorizedKey()), hostKeyPath),
+		"/etc/rc.d/sshd restart",
+	}, " && ")
+
+	result, execErr := c.runner.Exec(ctx, command)
+	if execErr != nil {
+		return fmt.Errorf("install host key: %w", execErr)
+	}
+
+	if !result.Success() {
+		return fmt.Errorf("install host key: exited %d: %s",
+			result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+
+	return nil
+}
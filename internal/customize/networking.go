@@ -3,9 +3,13 @@ package customize
 import (
 	"context"
 	"fmt"
+	"net"
 	"strings"
 )
 
+// ipv6Gateway is the link-local default gateway of every Hetzner Cloud server.
+const ipv6Gateway = "fe80::1"
+
 // ConfigureNetworking enables DHCP on the first interface and writes resolv.conf.
 func (c *Customizer) ConfigureNetworking(ctx context.Context) error {
 	if err := c.enableDHCP(ctx); err != nil {
@@ -35,6 +39,8 @@ func (c *Customizer) writeResolvConf(ctx context.Context) error {
 	command := `cat > /etc/resolv.conf << 'RESOLVEOF'
 nameserver 1.1.1.1
 nameserver 8.8.8.8
+nameserver 2606:4700:4700::1111
+nameserver 2001:4860:4860::8888
 RESOLVEOF`
 
 	result, execErr := c.runner.Exec(ctx, command)
@@ -49,3 +55,32 @@ RESOLVEOF`
 
 	return nil
 }
+
+// ConfigureIPv6 assigns the server's static IPv6 address to the first non-loopback
+// interface and routes through Hetzner's link-local gateway. Hetzner does not
+// hand out IPv6 addresses via DHCP, so IPv6-only servers need this to reach
+// package mirrors.
+func (c *Customizer) ConfigureIPv6(ctx context.Context, address string) error {
+	ip := net.ParseIP(address)
+	if ip == nil || ip.To4() != nil {
+		return fmt.Errorf("configure ipv6: invalid IPv6 address %q", address)
+	}
+
+	command := fmt.Sprintf(`iface=$(ifconfig -l | tr ' ' '\n' | grep -v '^lo' | head -n 1) && `+
+		`echo "inet6 %s prefixlen 64" >> /etc/ifconfig.$iface && `+
+		`echo "ip6mode=host" >> /etc/rc.conf && `+
+		`echo "defaultroute6=%s%%${iface}" >> /etc/rc.conf`,
+		ip, ipv6Gateway)
+
+	result, execErr := c.runner.Exec(ctx, command)
+	if execErr != nil {
+		return fmt.Errorf("configure ipv6: %w", execErr)
+	}
+
+	if !result.Success() {
+		return fmt.Errorf("configure ipv6: exited %d: %s",
+			result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+
+	return nil
+}
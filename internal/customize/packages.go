@@ -28,6 +28,56 @@ func (c *Customizer) InstallPackages(ctx context.Context, packages []string) err
 	return nil
 }
 
+// pkginCacheDir is where pkgin keeps the binary packages it downloads.
+const pkginCacheDir = "/var/db/pkgin/cache"
+
+// UsePackageCache null-mounts dir, typically on the shared cache volume, over
+// pkgin's download cache, so binary packages fetched by earlier builds are
+// reused. ReleasePackageCache unmounts it again, leaving the image's own
+// cache directory in place.
+func (c *Customizer) UsePackageCache(ctx context.Context, dir string) error {
+	command := fmt.Sprintf("mkdir -p %[1]s %[2]s && mount_null %[1]s %[2]s",
+		ssh.EscapeShellArg(dir), pkginCacheDir)
+
+	return c.runPackageCommand(ctx, "use package cache", command)
+}
+
+// ReleasePackageCache unmounts the package cache set up by UsePackageCache.
+func (c *Customizer) ReleasePackageCache(ctx context.Context) error {
+	return c.runPackageCommand(ctx, "release package cache", "umount "+pkginCacheDir)
+}
+
+// InstallCachedPackages installs packages with pkgin, bootstrapping pkgin with
+// pkg_add when it is missing, so the binaries land in the cache set up by
+// UsePackageCache. Each package is installed on its own for error isolation.
+func (c *Customizer) InstallCachedPackages(ctx context.Context, packages []string) error {
+	if err := c.runPackageCommand(ctx, "install pkgin", "command -v pkgin >/dev/null || pkg_add -v pkgin"); err != nil {
+		return err
+	}
+
+	for _, packageName := range packages {
+		command := "pkgin -y install " + ssh.EscapeShellArg(packageName)
+		if err := c.runPackageCommand(ctx, "install package "+packageName, command); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Customizer) runPackageCommand(ctx context.Context, action, command string) error {
+	result, execErr := c.runner.Exec(ctx, command)
+	if execErr != nil {
+		return fmt.Errorf("%s: %w", action, execErr)
+	}
+
+	if !result.Success() {
+		return fmt.Errorf("%s: exited %d: %s", action, result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+
+	return nil
+}
+
 // DefaultSecurityTools returns the default list of security packages to install.
 func DefaultSecurityTools() []string {
 	return []string{
@@ -1,8 +1,11 @@
 package di
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/rs/zerolog"
@@ -10,6 +13,7 @@ import (
 
 	"github.com/omarluq/hetzner-blackbsd/internal/config"
 	"github.com/omarluq/hetzner-blackbsd/internal/logger"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
 )
 
 // ConfigService wraps the loaded configuration.
@@ -63,10 +67,40 @@ func NewHetznerService(i do.Injector) (*HetznerService, error) {
 	return &HetznerService{Client: client}, nil
 }
 
-// SSHService is a placeholder for future SSH operations.
-type SSHService struct{}
+// SSHService keeps track of SSH clients so their persistent connections are
+// closed when the container shuts down.
+type SSHService struct {
+	clients []*ssh.Client
+	mu      sync.Mutex
+}
 
 // NewSSHService creates the SSH service.
 func NewSSHService(_ do.Injector) (*SSHService, error) {
-	return &SSHService{}, nil
+	return &SSHService{clients: nil, mu: sync.Mutex{}}, nil
+}
+
+// Track registers client to be closed at shutdown and returns it.
+func (s *SSHService) Track(client *ssh.Client) *ssh.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clients = append(s.clients, client)
+	return client
+}
+
+// Shutdown closes every tracked client, the most recently tracked first, so
+// clients reached through a jump host close before it. The container calls
+// it on shutdown.
+func (s *SSHService) Shutdown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, 0, len(s.clients))
+	for _, client := range slices.Backward(s.clients) {
+		errs = append(errs, client.Close())
+	}
+	s.clients = nil
+
+	slog.Info("ssh connections closed")
+	return errors.Join(errs...)
 }
@@ -2,6 +2,7 @@
 package extract
 
 import (
+	"github.com/omarluq/hetzner-blackbsd/internal/netbsd"
 	"github.com/omarluq/hetzner-blackbsd/internal/runner"
 )
 
@@ -9,12 +10,20 @@ import (
 type Extractor struct {
 	runner runner.Runner
 	device string
+	layout netbsd.Layout
 }
 
-// New creates a new Extractor.
+// New creates a new Extractor for an amd64 NetBSD disk.
 func New(exec runner.Runner, device string) *Extractor {
 	return &Extractor{
 		runner: exec,
 		device: device,
+		layout: netbsd.LayoutFor(netbsd.ArchAMD64),
 	}
 }
+
+// WithArch selects the partition layout and boot method of the given NetBSD port.
+func (e *Extractor) WithArch(arch string) *Extractor {
+	e.layout = netbsd.LayoutFor(arch)
+	return e
+}
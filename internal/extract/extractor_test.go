@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/omarluq/hetzner-blackbsd/internal/extract"
+	"github.com/omarluq/hetzner-blackbsd/internal/netbsd"
 	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
 	"github.com/stretchr/testify/assert"
 )
@@ -164,6 +165,24 @@ func TestExtractISOSuccess(t *testing.T) {
 	})
 }
 
+func TestExtractISOAArch64(t *testing.T) {
+	t.Parallel()
+
+	xorrisoCmd := "xorriso -as mkisofs -o '/tmp/blackbsd.iso' -append_partition 2 0xef '/dev/sda1' " +
+		"-e --interval:appended_partition_2:all:: -no-emul-boot '/mnt/iso'"
+	runner := newMock(map[string]ssh.CommandResult{
+		"mount -r '/dev/sda2' '/mnt/iso'": okResult(),
+		xorrisoCmd:                        okResult(),
+		"umount '/mnt/iso'":               okResult(),
+	})
+
+	isoErr := extract.New(runner, "/dev/sda").WithArch(netbsd.ArchAArch64).
+		ExtractISO(context.Background(), "/mnt/iso", "/tmp/blackbsd.iso")
+
+	assert.NoError(t, isoErr)
+	assert.Equal(t, []string{"mount -r '/dev/sda2' '/mnt/iso'", xorrisoCmd, "umount '/mnt/iso'"}, runner.commands)
+}
+
 func TestExtractISOMountError(t *testing.T) {
 	t.Parallel()
 
@@ -358,3 +377,72 @@ func TestChecksum(t *testing.T) {
 		})
 	}
 }
+
+// mockDownloader records the options a download was started with.
+type mockDownloader struct {
+	err  error
+	opts ssh.DownloadOpts
+}
+
+func (mock *mockDownloader) Download(_ context.Context, _, _ string, opts ssh.DownloadOpts) error {
+	mock.opts = opts
+	return mock.err
+}
+
+func newDownloader(err error) *mockDownloader {
+	var downloader mockDownloader
+	downloader.err = err
+	return &downloader
+}
+
+func TestDownload(t *testing.T) {
+	t.Parallel()
+
+	checksumCmd := "sha256sum '/tmp/image.raw.xz'"
+
+	t.Run("verifies against the remote checksum", func(t *testing.T) {
+		t.Parallel()
+
+		runner := newMock(map[string]ssh.CommandResult{
+			checksumCmd: {Stdout: "abc123  /tmp/image.raw.xz", Stderr: "", ExitCode: 0},
+		})
+		downloader := newDownloader(nil)
+
+		var opts ssh.DownloadOpts
+		opts.Parallel = 2
+		sum, err := extract.New(runner, "/dev/sda").
+			Download(context.Background(), downloader, "/tmp/image.raw.xz", "/tmp/local.raw.xz", opts)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "abc123", sum)
+		assert.Equal(t, "abc123", downloader.opts.SHA256)
+		assert.Equal(t, 2, downloader.opts.Parallel)
+	})
+
+	t.Run("fails without a remote checksum", func(t *testing.T) {
+		t.Parallel()
+
+		runner := newMock(map[string]ssh.CommandResult{checksumCmd: errResult("no such file")})
+		downloader := newDownloader(nil)
+
+		_, err := extract.New(runner, "/dev/sda").
+			Download(context.Background(), downloader, "/tmp/image.raw.xz", "/tmp/local.raw.xz", downloader.opts)
+
+		assert.ErrorContains(t, err, "compute checksum")
+		assert.Empty(t, downloader.opts.SHA256)
+	})
+
+	t.Run("wraps download errors", func(t *testing.T) {
+		t.Parallel()
+
+		runner := newMock(map[string]ssh.CommandResult{
+			checksumCmd: {Stdout: "abc123  /tmp/image.raw.xz", Stderr: "", ExitCode: 0},
+		})
+		downloader := newDownloader(ssh.ErrChecksumMismatch)
+
+		_, err := extract.New(runner, "/dev/sda").
+			Download(context.Background(), downloader, "/tmp/image.raw.xz", "/tmp/local.raw.xz", downloader.opts)
+
+		assert.ErrorIs(t, err, ssh.ErrChecksumMismatch)
+	})
+}
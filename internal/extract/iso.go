@@ -18,7 +18,7 @@ func (e *Extractor) ExtractISO(ctx context.Context, mountPoint, outputPath strin
 		return fmt.Errorf("invalid output path: %w", err)
 	}
 
-	partition := partitionPath(e.device, 1)
+	partition := partitionPath(e.device, e.layout.RootPartition)
 
 	if err := e.mountDevice(ctx, partition, mountPoint); err != nil {
 		return err
@@ -50,6 +50,16 @@ func (e *Extractor) createISO(ctx context.Context, mountPoint, outputPath string
 	cmd := fmt.Sprintf("xorriso -as mkisofs -o %s -b boot/cdboot -no-emul-boot %s",
 		ssh.EscapeShellArg(outputPath), ssh.EscapeShellArg(mountPoint))
 
+	// UEFI-only ports have no cdboot; the disk's EFI system partition is
+	// appended to the ISO and used as the El Torito EFI boot image instead.
+	if e.layout.EFIPartition > 0 {
+		cmd = fmt.Sprintf("xorriso -as mkisofs -o %s -append_partition 2 0xef %s "+
+			"-e --interval:appended_partition_2:all:: -no-emul-boot %s",
+			ssh.EscapeShellArg(outputPath),
+			ssh.EscapeShellArg(partitionPath(e.device, e.layout.EFIPartition)),
+			ssh.EscapeShellArg(mountPoint))
+	}
+
 	result, err := e.runner.Exec(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("create ISO: %w", err)
@@ -77,7 +87,7 @@ func (e *Extractor) unmountDevice(ctx context.Context, mountPoint string) error
 	return nil
 }
 
-// partitionPath returns the first partition path for a device.
+// partitionPath returns the path of partition partNum on a device.
 // NVMe devices (ending in digit) use "p" separator: /dev/nvme0n1 -> /dev/nvme0n1p1.
 // Traditional devices just append the number: /dev/sda -> /dev/sda1.
 func partitionPath(device string, partNum int) string {
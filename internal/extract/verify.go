@@ -62,3 +62,26 @@ func (e *Extractor) Checksum(ctx context.Context, imagePath string) (string, err
 
 	return parts[0], nil
 }
+
+// Downloader fetches a remote file, as ssh.Client does.
+type Downloader interface {
+	Download(ctx context.Context, remotePath, localPath string, opts ssh.DownloadOpts) error
+}
+
+// Download fetches a remote image to localPath and checks it against the
+// image's remote SHA256 checksum, which it returns.
+func (e *Extractor) Download(
+	ctx context.Context, downloader Downloader, imagePath, localPath string, opts ssh.DownloadOpts,
+) (string, error) {
+	sum, err := e.Checksum(ctx, imagePath)
+	if err != nil {
+		return "", err
+	}
+
+	opts.SHA256 = sum
+	if err = downloader.Download(ctx, imagePath, localPath, opts); err != nil {
+		return "", fmt.Errorf("download image: %w", err)
+	}
+
+	return sum, nil
+}
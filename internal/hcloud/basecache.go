@@ -0,0 +1,114 @@
+package hcloud
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+	"github.com/samber/mo"
+)
+
+const (
+	// RoleLabelKey distinguishes the purpose of blackbsd-managed snapshots.
+	RoleLabelKey = "blackbsd-role"
+
+	// RoleBase marks a snapshot of a clean post-install NetBSD base system.
+	RoleBase = "base"
+
+	// VersionLabelKey is the label key carrying the NetBSD version.
+	VersionLabelKey = "blackbsd-netbsd-version"
+
+	// ArchLabelKey is the label key carrying the NetBSD architecture.
+	ArchLabelKey = "blackbsd-arch"
+
+	// LayoutLabelKey is the label key carrying the disk-layout hash.
+	LayoutLabelKey = "blackbsd-layout"
+)
+
+// BaseKey identifies a cached NetBSD base snapshot.
+type BaseKey struct {
+	Version    string
+	Arch       string
+	LayoutHash string
+}
+
+// Labels returns the snapshot labels encoding this key.
+func (k BaseKey) Labels() map[string]string {
+	return map[string]string{
+		RoleLabelKey:    RoleBase,
+		VersionLabelKey: k.Version,
+		ArchLabelKey:    k.Arch,
+		LayoutLabelKey:  k.LayoutHash,
+	}
+}
+
+// String returns a human-readable representation of the key.
+func (k BaseKey) String() string {
+	return fmt.Sprintf("netbsd-%s-%s-%s", k.Version, k.Arch, k.LayoutHash)
+}
+
+func (k BaseKey) selector() string {
+	labels := k.Labels()
+	keys := lo.Keys(labels)
+	slices.Sort(keys)
+	return strings.Join(lo.Map(keys, func(key string, _ int) string {
+		return key + "=" + labels[key]
+	}), ",")
+}
+
+// BaseKeyOf reconstructs the BaseKey from a snapshot's labels.
+func BaseKeyOf(image *hcloud.Image) BaseKey {
+	return BaseKey{
+		Version:    image.Labels[VersionLabelKey],
+		Arch:       image.Labels[ArchLabelKey],
+		LayoutHash: image.Labels[LayoutLabelKey],
+	}
+}
+
+// ListBaseSnapshots returns all cached base snapshots, newest first.
+func (c *Client) ListBaseSnapshots(ctx context.Context) ([]*hcloud.Image, error) {
+	return c.ListSnapshots(ctx, RoleLabelKey+"="+RoleBase)
+}
+
+// FindBaseSnapshot returns the newest available base snapshot for the key.
+func (c *Client) FindBaseSnapshot(ctx context.Context, key BaseKey) (mo.Option[*hcloud.Image], error) {
+	images, err := c.ListSnapshots(ctx, key.selector())
+	if err != nil {
+		return mo.None[*hcloud.Image](), err
+	}
+
+	image, found := lo.Find(images, func(image *hcloud.Image) bool {
+		return image.Status == hcloud.ImageStatusAvailable
+	})
+	if !found {
+		return mo.None[*hcloud.Image](), nil
+	}
+	return mo.Some(image), nil
+}
+
+// SaveBaseSnapshot snapshots a freshly installed server as the base for key.
+func (c *Client) SaveBaseSnapshot(
+	ctx context.Context,
+	server *hcloud.Server,
+	key BaseKey,
+) (*hcloud.Image, error) {
+	var opts SnapshotOpts
+	opts.Description = "blackbsd base " + key.String()
+	opts.Labels = key.Labels()
+	return c.CreateSnapshot(ctx, server, &opts)
+}
+
+// SnapshotsToPrune selects the snapshots beyond the newest keep entries of each
+// base key. Published images carry no layout label, so for them this groups by
+// version and arch. The input is expected to be sorted newest first.
+func SnapshotsToPrune(images []*hcloud.Image, keep int) []*hcloud.Image {
+	seen := make(map[BaseKey]int)
+	return lo.Filter(images, func(image *hcloud.Image, _ int) bool {
+		key := BaseKeyOf(image)
+		seen[key]++
+		return seen[key] > keep
+	})
+}
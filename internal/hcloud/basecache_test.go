@@ -0,0 +1,119 @@
+package hcloud_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBaseKey() bsdhcloud.BaseKey {
+	return bsdhcloud.BaseKey{Version: "10.1", Arch: "amd64", LayoutHash: "abcdef123456"}
+}
+
+func baseImage(id int64, key bsdhcloud.BaseKey) *hcloudsdk.Image {
+	var image hcloudsdk.Image
+	image.ID = id
+	image.Status = hcloudsdk.ImageStatusAvailable
+	image.Labels = key.Labels()
+	return &image
+}
+
+func TestBaseKeyLabels(t *testing.T) {
+	t.Parallel()
+
+	key := testBaseKey()
+	labels := key.Labels()
+
+	assert.Equal(t, "base", labels[bsdhcloud.RoleLabelKey])
+	assert.Equal(t, "10.1", labels[bsdhcloud.VersionLabelKey])
+	assert.Equal(t, "amd64", labels[bsdhcloud.ArchLabelKey])
+	assert.Equal(t, "abcdef123456", labels[bsdhcloud.LayoutLabelKey])
+	assert.Equal(t, key, bsdhcloud.BaseKeyOf(baseImage(1, key)))
+}
+
+func TestFindBaseSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("queries snapshots by key labels", func(t *testing.T) {
+		t.Parallel()
+
+		var selector string
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, r *http.Request) {
+				selector = r.URL.Query().Get("label_selector")
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusOK)
+				writeJSON(t, writer, `{"images": [
+					{"id": 10, "type": "snapshot", "status": "creating"},
+					{"id": 11, "type": "snapshot", "status": "available"}
+				]}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		result, err := client.FindBaseSnapshot(context.Background(), testBaseKey())
+
+		require.NoError(t, err)
+		image, ok := result.Get()
+		require.True(t, ok)
+		assert.Equal(t, int64(11), image.ID)
+		assert.Contains(t, selector, "managed-by=blackbsd-builder")
+		assert.Contains(t, selector, "blackbsd-role=base")
+		assert.Contains(t, selector, "blackbsd-netbsd-version=10.1")
+		assert.Contains(t, selector, "blackbsd-layout=abcdef123456")
+	})
+
+	t.Run("returns None when nothing is cached", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusOK)
+				writeJSON(t, writer, `{"images": []}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		result, err := client.FindBaseSnapshot(context.Background(), testBaseKey())
+
+		require.NoError(t, err)
+		assert.False(t, result.IsPresent())
+	})
+}
+
+func TestSnapshotsToPrune(t *testing.T) {
+	t.Parallel()
+
+	key := testBaseKey()
+	other := bsdhcloud.BaseKey{Version: "10.0", Arch: "amd64", LayoutHash: "abcdef123456"}
+
+	images := []*hcloudsdk.Image{
+		baseImage(4, key),
+		baseImage(3, other),
+		baseImage(2, key),
+		baseImage(1, key),
+	}
+
+	t.Run("keeps newest per key", func(t *testing.T) {
+		t.Parallel()
+
+		pruned := bsdhcloud.SnapshotsToPrune(images, 1)
+
+		require.Len(t, pruned, 2)
+		assert.Equal(t, int64(2), pruned[0].ID)
+		assert.Equal(t, int64(1), pruned[1].ID)
+	})
+
+	t.Run("keeps everything within retention", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Empty(t, bsdhcloud.SnapshotsToPrune(images, 3))
+	})
+}
@@ -2,6 +2,8 @@
 package hcloud
 
 import (
+	"net/http"
+
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
 
@@ -18,19 +20,38 @@ const (
 
 // Client wraps the official hcloud.Client with domain-specific operations.
 type Client struct {
-	api *hcloud.Client
+	api      *hcloud.Client
+	progress ProgressFunc
 }
 
 // NewClient creates a new Hetzner client with the given token.
 func NewClient(token string) *Client {
-	return &Client{
-		api: hcloud.NewClient(hcloud.WithToken(token)),
-	}
+	return NewClientWithOpts(hcloud.WithToken(token))
 }
 
 // NewClientWithOpts creates a new Hetzner client with custom options.
+// Every request goes through the retrying transport; see NewRetryTransport.
 func NewClientWithOpts(opts ...hcloud.ClientOption) *Client {
+	return NewClientWithTransportOpts(DefaultTransportOpts(), opts...)
+}
+
+// NewClientWithTransportOpts creates a new Hetzner client whose requests are
+// retried according to transportOpts. The SDK's own retries are disabled so the
+// transport is the single retry layer.
+func NewClientWithTransportOpts(transportOpts TransportOpts, opts ...hcloud.ClientOption) *Client {
+	var httpClient http.Client
+	httpClient.Transport = NewRetryTransport(http.DefaultTransport, transportOpts)
+
+	var retryOpts hcloud.RetryOpts
+	retryOpts.MaxRetries = 0
+
+	baseOpts := []hcloud.ClientOption{
+		hcloud.WithHTTPClient(&httpClient),
+		hcloud.WithRetryOpts(retryOpts),
+	}
+
 	return &Client{
-		api: hcloud.NewClient(opts...),
+		api:      hcloud.NewClient(append(baseOpts, opts...)...),
+		progress: nil,
 	}
 }
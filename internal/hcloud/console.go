@@ -0,0 +1,130 @@
+package hcloud
+
+import (
+	"context"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+	"github.com/omarluq/hetzner-blackbsd/internal/vnc"
+)
+
+const consoleDirPermissions = 0o750
+
+// Console is a VNC console session granted by the Hetzner API.
+type Console struct {
+	URL      string
+	Password secret.Secret
+}
+
+// ConsoleCaptureOpts configures CaptureConsole. Shots screenshots are taken
+// Interval apart and written as PNG files into Dir.
+type ConsoleCaptureOpts struct {
+	Dir      string
+	Shots    int
+	Interval time.Duration
+}
+
+// RequestConsole requests a websocket VNC console for the server.
+func (c *Client) RequestConsole(ctx context.Context, server *hcloud.Server) (Console, error) {
+	var console Console
+
+	result, _, err := c.api.Server.RequestConsole(ctx, server)
+	if err != nil {
+		return console, fmt.Errorf("request console for server %d: %w", server.ID, err)
+	}
+
+	if result.Action != nil {
+		if waitErr := c.WaitForAction(ctx, result.Action); waitErr != nil {
+			return console, waitErr
+		}
+	}
+
+	console.URL = result.WSSURL
+	console.Password = secret.New(result.Password)
+	return console, nil
+}
+
+// CaptureConsole connects to the server's VNC console and saves screenshots.
+// It returns the paths of the files written, which may be fewer than
+// requested if capturing fails part way.
+func (c *Client) CaptureConsole(
+	ctx context.Context,
+	server *hcloud.Server,
+	opts *ConsoleCaptureOpts,
+) ([]string, error) {
+	console, err := c.RequestConsole(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	vncClient, err := vnc.DialWebSocket(ctx, console.URL, console.Password)
+	if err != nil {
+		return nil, fmt.Errorf("connect console for server %d: %w", server.ID, err)
+	}
+	defer func() {
+		if closeErr := vncClient.Close(); closeErr != nil {
+			slog.Debug("console close error", "server_id", server.ID, "error", closeErr)
+		}
+	}()
+
+	if err = os.MkdirAll(opts.Dir, consoleDirPermissions); err != nil {
+		return nil, fmt.Errorf("create console dir: %w", err)
+	}
+
+	paths := make([]string, 0, opts.Shots)
+	for shot := range opts.Shots {
+		if shot > 0 {
+			if err = sleepContext(ctx, opts.Interval); err != nil {
+				return paths, err
+			}
+		}
+
+		path, shotErr := saveScreenshot(ctx, vncClient, server.ID, opts.Dir, shot)
+		if shotErr != nil {
+			return paths, shotErr
+		}
+
+		slog.Info("console screenshot saved", "server_id", server.ID, "path", path)
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func saveScreenshot(
+	ctx context.Context,
+	vncClient *vnc.Client,
+	serverID int64,
+	dir string,
+	shot int,
+) (path string, err error) {
+	screen, err := vncClient.Screenshot(ctx)
+	if err != nil {
+		return "", fmt.Errorf("capture console for server %d: %w", serverID, err)
+	}
+
+	name := fmt.Sprintf("console-%d-%s-%d.png", serverID, time.Now().UTC().Format("20060102T150405"), shot)
+	path = filepath.Join(dir, name)
+
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("create screenshot: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close screenshot: %w", closeErr)
+		}
+	}()
+
+	if err = png.Encode(file, screen); err != nil {
+		return "", fmt.Errorf("encode screenshot: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,95 @@
+package hcloud_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/vnc/vnctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func consoleAPI(t *testing.T, wssURL string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			switch {
+			case strings.HasSuffix(request.URL.Path, "/actions/request_console"):
+				writeJSON(t, writer, `{"action": {"id": 1, "status": "success"},
+					"wss_url": "`+wssURL+`", "password": "vncpass"}`)
+			case strings.HasSuffix(request.URL.Path, "/actions"):
+				writeJSON(t, writer, `{"actions": [{"id": 1, "status": "success"}]}`)
+			}
+		}))
+}
+
+func TestRequestConsole(t *testing.T) {
+	t.Parallel()
+
+	api := consoleAPI(t, "wss://console.example/?token=abc")
+	defer api.Close()
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(api.URL))
+	var srv hcloudsdk.Server
+	srv.ID = 42
+
+	console, err := client.RequestConsole(context.Background(), &srv)
+
+	require.NoError(t, err)
+	assert.Equal(t, "wss://console.example/?token=abc", console.URL)
+	assert.Equal(t, "vncpass", console.Password.Reveal())
+}
+
+func TestCaptureConsole(t *testing.T) {
+	t.Parallel()
+
+	screen := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	screen.Set(3, 2, color.RGBA{R: 255, G: 0, B: 0, A: 255})
+
+	vncServer := vnctest.NewServer(screen, "vncpass")
+	defer vncServer.Close()
+
+	api := consoleAPI(t, vncServer.URL)
+	defer api.Close()
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(api.URL))
+	var srv hcloudsdk.Server
+	srv.ID = 42
+
+	dir := t.TempDir() + "/console"
+	paths, err := client.CaptureConsole(context.Background(), &srv, &bsdhcloud.ConsoleCaptureOpts{
+		Dir:      dir,
+		Shots:    2,
+		Interval: time.Millisecond,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+
+	for _, path := range paths {
+		assert.True(t, strings.HasPrefix(path, dir+"/console-42-"))
+
+		file, openErr := os.Open(path)
+		require.NoError(t, openErr)
+
+		decoded, decodeErr := png.Decode(file)
+		require.NoError(t, file.Close())
+		require.NoError(t, decodeErr)
+
+		assert.Equal(t, screen.Bounds(), decoded.Bounds())
+		red, green, blue, _ := decoded.At(3, 2).RGBA()
+		assert.Equal(t, []uint32{0xffff, 0, 0}, []uint32{red, green, blue})
+	}
+}
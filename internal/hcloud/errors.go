@@ -0,0 +1,102 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// ErrorClass describes how a failed Hetzner API call should be handled.
+type ErrorClass int
+
+const (
+	// ErrorClassFatal errors will not succeed on retry.
+	ErrorClassFatal ErrorClass = iota
+
+	// ErrorClassTransient errors may succeed when the same request is retried.
+	ErrorClassTransient
+
+	// ErrorClassCapacity errors mean the requested server type is unavailable in
+	// the requested location; another placement may succeed.
+	ErrorClassCapacity
+)
+
+// String returns the class name.
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassFatal:
+		return "fatal"
+	case ErrorClassTransient:
+		return "transient"
+	case ErrorClassCapacity:
+		return "capacity"
+	default:
+		return "unknown"
+	}
+}
+
+// ClassifyError maps an hcloud API error code to an ErrorClass. Errors from
+// failing to reach the API, such as a dropped connection, are transient. An
+// invalid server type is fatal: it names a type that does not exist, which no
+// other location offers either.
+func ClassifyError(err error) ErrorClass {
+	var apiErr hcloud.Error
+	if !errors.As(err, &apiErr) {
+		if isNetworkError(err) {
+			return ErrorClassTransient
+		}
+		return ErrorClassFatal
+	}
+
+	switch apiErr.Code {
+	case hcloud.ErrorCodeResourceUnavailable,
+		hcloud.ErrorCodePlacementError,
+		hcloud.ErrorCodeNoSpaceLeftInLocation:
+		return ErrorClassCapacity
+	case hcloud.ErrorCodeRateLimitExceeded,
+		hcloud.ErrorCodeLocked,
+		hcloud.ErrorCodeConflict,
+		hcloud.ErrorCodeTimeout,
+		hcloud.ErrorCodeServerError,
+		hcloud.ErrorCodeServiceError,
+		hcloud.ErrorCodeMaintenance,
+		hcloud.ErrorCodeRobotUnavailable:
+		return ErrorClassTransient
+	default:
+		return ErrorClassFatal
+	}
+}
+
+// isNetworkError reports whether err is a failure to reach the API rather
+// than an answer from it. Context errors are not: the caller gave up.
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// ActionError is returned when a Hetzner action finishes with an error.
+type ActionError struct {
+	Command string
+	Code    string
+	Message string
+	ID      int64
+}
+
+// Error returns the action, its error code and message.
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("action %d (%s) failed: %s: %s", e.ID, e.Command, e.Code, e.Message)
+}
+
+// isNotFound reports whether the API answered 404 for the requested resource.
+func isNotFound(resp *hcloud.Response) bool {
+	return resp != nil && resp.Response != nil && resp.StatusCode == http.StatusNotFound
+}
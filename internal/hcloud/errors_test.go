@@ -0,0 +1,88 @@
+package hcloud_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err      error
+		name     string
+		expected bsdhcloud.ErrorClass
+	}{
+		{
+			name:     "resource unavailable is capacity",
+			err:      hcloudsdk.Error{Code: hcloudsdk.ErrorCodeResourceUnavailable, Message: "", Details: nil},
+			expected: bsdhcloud.ErrorClassCapacity,
+		},
+		{
+			name:     "placement error is capacity",
+			err:      hcloudsdk.Error{Code: hcloudsdk.ErrorCodePlacementError, Message: "", Details: nil},
+			expected: bsdhcloud.ErrorClassCapacity,
+		},
+		{
+			name:     "invalid server type is fatal",
+			err:      hcloudsdk.Error{Code: hcloudsdk.ErrorCodeInvalidServerType, Message: "", Details: nil},
+			expected: bsdhcloud.ErrorClassFatal,
+		},
+		{
+			name:     "rate limit is transient",
+			err:      hcloudsdk.Error{Code: hcloudsdk.ErrorCodeRateLimitExceeded, Message: "", Details: nil},
+			expected: bsdhcloud.ErrorClassTransient,
+		},
+		{
+			name: "wrapped locked is transient",
+			err: fmt.Errorf("create: %w",
+				hcloudsdk.Error{Code: hcloudsdk.ErrorCodeLocked, Message: "", Details: nil}),
+			expected: bsdhcloud.ErrorClassTransient,
+		},
+		{
+			name:     "unauthorized is fatal",
+			err:      hcloudsdk.Error{Code: hcloudsdk.ErrorCodeUnauthorized, Message: "", Details: nil},
+			expected: bsdhcloud.ErrorClassFatal,
+		},
+		{
+			name:     "non api error is fatal",
+			err:      assert.AnError,
+			expected: bsdhcloud.ErrorClassFatal,
+		},
+		{
+			name: "connection error is transient",
+			err: &url.Error{Op: "Post", URL: "https://api.hetzner.cloud/v1/servers",
+				Err: &net.OpError{Op: "dial", Net: "tcp", Source: nil, Addr: nil, Err: syscall.ECONNREFUSED}},
+			expected: bsdhcloud.ErrorClassTransient,
+		},
+		{
+			name:     "truncated response is transient",
+			err:      fmt.Errorf("read body: %w", io.ErrUnexpectedEOF),
+			expected: bsdhcloud.ErrorClassTransient,
+		},
+		{
+			name:     "deadline is fatal",
+			err:      fmt.Errorf("post servers: %w", context.DeadlineExceeded),
+			expected: bsdhcloud.ErrorClassFatal,
+		},
+	}
+
+	for _, tt := range tests {
+		testCase := tt
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			class := bsdhcloud.ClassifyError(testCase.err)
+			assert.Equal(t, testCase.expected, class, "got %s", class)
+		})
+	}
+}
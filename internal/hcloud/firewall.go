@@ -0,0 +1,200 @@
+package hcloud
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+)
+
+const (
+	// DefaultIPEchoURL is queried to detect the operator's public IP address.
+	DefaultIPEchoURL = "https://api.ipify.org"
+
+	// DefaultIPv6EchoURL detects the operator's public IPv6 address, which is
+	// the one that can reach IPv6-only build servers.
+	DefaultIPv6EchoURL = "https://api6.ipify.org"
+
+	sshPort          = "22"
+	maxIPEchoBody    = 256
+	firewallRetries  = 5
+	ipv4HostMaskBits = 32
+	ipv6HostMaskBits = 128
+)
+
+// FirewallOpts defines options for creating a per-build firewall.
+type FirewallOpts struct {
+	Labels      map[string]string
+	Name        string
+	SourceCIDRs []string
+}
+
+// CreateFirewall creates a firewall that only admits inbound SSH from the given CIDRs.
+func (c *Client) CreateFirewall(ctx context.Context, opts *FirewallOpts) (*hcloud.Firewall, error) {
+	if len(opts.SourceCIDRs) == 0 {
+		return nil, fmt.Errorf("create firewall %s: no source CIDRs", opts.Name)
+	}
+
+	sourceIPs, err := parseCIDRs(opts.SourceCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("create firewall %s: %w", opts.Name, err)
+	}
+
+	var rule hcloud.FirewallRule
+	rule.Direction = hcloud.FirewallRuleDirectionIn
+	rule.Protocol = hcloud.FirewallRuleProtocolTCP
+	rule.Port = hcloud.Ptr(sshPort)
+	rule.SourceIPs = sourceIPs
+	rule.Description = hcloud.Ptr("blackbsd operator ssh")
+
+	var createOpts hcloud.FirewallCreateOpts
+	createOpts.Name = opts.Name
+	createOpts.Labels = mergeLabels(opts.Labels)
+	createOpts.Rules = []hcloud.FirewallRule{rule}
+
+	result, _, err := c.api.Firewall.Create(ctx, createOpts)
+	if err != nil {
+		return nil, fmt.Errorf("create firewall %s: %w", opts.Name, err)
+	}
+
+	slog.Info("firewall created", "id", result.Firewall.ID, "name", result.Firewall.Name,
+		"sources", strings.Join(opts.SourceCIDRs, ","))
+	return result.Firewall, nil
+}
+
+// ListFirewalls returns all firewalls matching the blackbsd label.
+func (c *Client) ListFirewalls(ctx context.Context) ([]*hcloud.Firewall, error) {
+	return c.listFirewalls(ctx, "")
+}
+
+func (c *Client) listFirewalls(ctx context.Context, selector string) ([]*hcloud.Firewall, error) {
+	labelSelector := Label
+	if selector != "" {
+		labelSelector += "," + selector
+	}
+
+	var firewallListOpts hcloud.FirewallListOpts
+	firewallListOpts.LabelSelector = labelSelector
+
+	firewalls, err := c.api.Firewall.AllWithOpts(ctx, firewallListOpts)
+	if err != nil {
+		return nil, fmt.Errorf("list firewalls: %w", err)
+	}
+	return firewalls, nil
+}
+
+// DeleteFirewall deletes a firewall. Returns true if deleted, false if not found.
+// Deletion is retried while Hetzner still reports the firewall as in use, which
+// happens briefly after the server it was applied to has been deleted.
+func (c *Client) DeleteFirewall(ctx context.Context, firewall *hcloud.Firewall) (bool, error) {
+	deleted := true
+
+	operation := func() error {
+		_, err := c.api.Firewall.Delete(ctx, firewall)
+		switch {
+		case err == nil:
+			return nil
+		case hcloud.IsError(err, hcloud.ErrorCodeNotFound):
+			deleted = false
+			return nil
+		case hcloud.IsError(err, hcloud.ErrorCodeResourceInUse):
+			return err
+		default:
+			return backoff.Permanent(err)
+		}
+	}
+
+	policy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), firewallRetries)
+	if err := backoff.Retry(operation, backoff.WithContext(policy, ctx)); err != nil {
+		return false, fmt.Errorf("delete firewall %d: %w", firewall.ID, err)
+	}
+
+	if deleted {
+		slog.Info("firewall deleted", "id", firewall.ID, "name", firewall.Name)
+	}
+	return deleted, nil
+}
+
+// OrphanedFirewalls returns blackbsd-managed firewalls not applied to any
+// resource. A firewall whose build has not expired by now is left alone: a
+// build creates its firewall before the server it protects.
+func OrphanedFirewalls(firewalls []*hcloud.Firewall, now time.Time) []*hcloud.Firewall {
+	return lo.Filter(firewalls, func(firewall *hcloud.Firewall, _ int) bool {
+		return len(firewall.AppliedTo) == 0 && !unexpired(firewall.Labels, now)
+	})
+}
+
+// OperatorCIDRs returns the configured CIDRs, or detects the operator's public
+// address via echoURL when none are configured.
+func OperatorCIDRs(ctx context.Context, configured []string, echoURL string) ([]string, error) {
+	if len(configured) > 0 {
+		return configured, nil
+	}
+
+	ip, err := DetectPublicIP(ctx, http.DefaultClient, echoURL)
+	if err != nil {
+		return nil, err
+	}
+	return []string{hostCIDR(ip)}, nil
+}
+
+// DetectPublicIP asks an IP echo service for the caller's public address.
+func DetectPublicIP(ctx context.Context, httpClient *http.Client, echoURL string) (net.IP, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, echoURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("detect public ip: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("detect public ip: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Debug("close error", "error", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("detect public ip: unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIPEchoBody))
+	if err != nil {
+		return nil, fmt.Errorf("detect public ip: %w", err)
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("detect public ip: invalid address %q", strings.TrimSpace(string(body)))
+	}
+
+	return ip, nil
+}
+
+func hostCIDR(ip net.IP) string {
+	if ip.To4() != nil {
+		return fmt.Sprintf("%s/%d", ip.String(), ipv4HostMaskBits)
+	}
+	return fmt.Sprintf("%s/%d", ip.String(), ipv6HostMaskBits)
+}
+
+func parseCIDRs(cidrs []string) ([]net.IPNet, error) {
+	nets := make([]net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse cidr %q: %w", cidr, err)
+		}
+		nets = append(nets, *ipNet)
+	}
+	return nets, nil
+}
@@ -0,0 +1,216 @@
+package hcloud_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateFirewall(t *testing.T) {
+	t.Parallel()
+
+	t.Run("creates ssh rule from source cidrs with labels", func(t *testing.T) {
+		t.Parallel()
+
+		var requestBody string
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, r *http.Request) {
+				body, readErr := io.ReadAll(r.Body)
+				require.NoError(t, readErr)
+				requestBody = string(body)
+
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusCreated)
+				writeJSON(t, writer, `{"firewall": {"id": 7, "name": "blackbsd-fw"}, "actions": []}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		firewall, err := client.CreateFirewall(context.Background(), &bsdhcloud.FirewallOpts{
+			Name:        "blackbsd-fw",
+			Labels:      bsdhcloud.BuildLabels("abc123"),
+			SourceCIDRs: []string{"203.0.113.7/32"},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), firewall.ID)
+		assert.Contains(t, requestBody, `"port":"22"`)
+		assert.Contains(t, requestBody, "203.0.113.7/32")
+		assert.Contains(t, requestBody, "blackbsd-builder")
+		assert.Contains(t, requestBody, "abc123")
+	})
+
+	t.Run("rejects empty source cidrs", func(t *testing.T) {
+		t.Parallel()
+
+		client := bsdhcloud.NewClient("token")
+		_, err := client.CreateFirewall(context.Background(), &bsdhcloud.FirewallOpts{
+			Name:        "blackbsd-fw",
+			Labels:      nil,
+			SourceCIDRs: nil,
+		})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no source CIDRs")
+	})
+
+	t.Run("rejects invalid cidr", func(t *testing.T) {
+		t.Parallel()
+
+		client := bsdhcloud.NewClient("token")
+		_, err := client.CreateFirewall(context.Background(), &bsdhcloud.FirewallOpts{
+			Name:        "blackbsd-fw",
+			Labels:      nil,
+			SourceCIDRs: []string{"not-a-cidr"},
+		})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not-a-cidr")
+	})
+}
+
+func TestDeleteFirewall(t *testing.T) {
+	t.Parallel()
+
+	var firewall hcloudsdk.Firewall
+	firewall.ID = 7
+
+	t.Run("returns false for 404", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusNotFound)
+				writeJSON(t, writer, `{"error": {"code": "not_found", "message": "not found"}}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		deleted, err := client.DeleteFirewall(context.Background(), &firewall)
+
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	})
+
+	t.Run("retries while firewall is in use", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				calls++
+				writer.Header().Set("Content-Type", "application/json")
+				if calls == 1 {
+					writer.WriteHeader(http.StatusLocked)
+					writeJSON(t, writer, `{"error": {"code": "resource_in_use", "message": "in use"}}`)
+					return
+				}
+				writer.WriteHeader(http.StatusNoContent)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		deleted, err := client.DeleteFirewall(context.Background(), &firewall)
+
+		require.NoError(t, err)
+		assert.True(t, deleted)
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestOrphanedFirewalls(t *testing.T) {
+	t.Parallel()
+
+	var attached hcloudsdk.Firewall
+	attached.ID = 1
+	attached.AppliedTo = []hcloudsdk.FirewallResource{{
+		Type:               hcloudsdk.FirewallResourceTypeServer,
+		Server:             &hcloudsdk.FirewallResourceServer{ID: 42},
+		LabelSelector:      nil,
+		AppliedToResources: nil,
+	}}
+
+	now := time.Now()
+
+	var orphan hcloudsdk.Firewall
+	orphan.ID = 2
+	orphan.Labels = bsdhcloud.WithExpiry(bsdhcloud.BuildLabels("old"), now.Add(-time.Minute))
+
+	// A running build creates its firewall before the server is attached.
+	var pending hcloudsdk.Firewall
+	pending.ID = 3
+	pending.Labels = bsdhcloud.WithExpiry(bsdhcloud.BuildLabels("new"), now.Add(time.Hour))
+
+	result := bsdhcloud.OrphanedFirewalls([]*hcloudsdk.Firewall{&attached, &orphan, &pending}, now)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, int64(2), result[0].ID)
+}
+
+func TestOperatorCIDRs(t *testing.T) {
+	t.Parallel()
+
+	t.Run("prefers configured cidrs", func(t *testing.T) {
+		t.Parallel()
+
+		cidrs, err := bsdhcloud.OperatorCIDRs(context.Background(), []string{"198.51.100.0/24"}, "http://invalid")
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"198.51.100.0/24"}, cidrs)
+	})
+
+	t.Run("detects ipv4 address as /32", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writeJSON(t, writer, "203.0.113.7\n")
+			}))
+		defer testServer.Close()
+
+		cidrs, err := bsdhcloud.OperatorCIDRs(context.Background(), nil, testServer.URL)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"203.0.113.7/32"}, cidrs)
+	})
+
+	t.Run("detects ipv6 address as /128", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writeJSON(t, writer, "2001:db8::7")
+			}))
+		defer testServer.Close()
+
+		cidrs, err := bsdhcloud.OperatorCIDRs(context.Background(), nil, testServer.URL)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2001:db8::7/128"}, cidrs)
+	})
+
+	t.Run("rejects garbage response", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writeJSON(t, writer, "<html>")
+			}))
+		defer testServer.Close()
+
+		_, err := bsdhcloud.OperatorCIDRs(context.Background(), nil, testServer.URL)
+
+		require.Error(t, err)
+		assert.True(t, strings.Contains(err.Error(), "invalid address"))
+	})
+}
@@ -0,0 +1,67 @@
+package hcloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+const (
+	// RoleImage marks a snapshot of a finished, bootable BlackBSD image.
+	RoleImage = "image"
+
+	// ChecksumLabelKey carries the leading hex digits of the image's SHA-256.
+	// Label values are capped at 63 characters, so the full digest goes into
+	// the snapshot description instead.
+	ChecksumLabelKey = "blackbsd-sha256"
+
+	checksumLabelLength = 32
+)
+
+// ImageMeta describes a published BlackBSD image snapshot.
+type ImageMeta struct {
+	Version  string
+	Arch     string
+	BuildID  string
+	Checksum string
+}
+
+// Labels returns the snapshot labels encoding the metadata.
+func (m ImageMeta) Labels() map[string]string {
+	labels := map[string]string{
+		RoleLabelKey:    RoleImage,
+		VersionLabelKey: m.Version,
+		ArchLabelKey:    m.Arch,
+		BuildIDLabelKey: m.BuildID,
+	}
+
+	if m.Checksum != "" {
+		labels[ChecksumLabelKey] = m.Checksum[:min(len(m.Checksum), checksumLabelLength)]
+	}
+
+	return labels
+}
+
+// Description returns the human-readable snapshot description.
+func (m ImageMeta) Description() string {
+	description := fmt.Sprintf("BlackBSD NetBSD %s %s build %s", m.Version, m.Arch, m.BuildID)
+	if m.Checksum != "" {
+		description += " sha256:" + m.Checksum
+	}
+	return description
+}
+
+// PublishImage snapshots a finished build server as a reusable BlackBSD image.
+// Unlike build resources the snapshot carries no expiry, so reap keeps it.
+func (c *Client) PublishImage(ctx context.Context, server *hcloud.Server, meta ImageMeta) (*hcloud.Image, error) {
+	var opts SnapshotOpts
+	opts.Description = meta.Description()
+	opts.Labels = meta.Labels()
+	return c.CreateSnapshot(ctx, server, &opts)
+}
+
+// ListImageSnapshots returns all published BlackBSD image snapshots, newest first.
+func (c *Client) ListImageSnapshots(ctx context.Context) ([]*hcloud.Image, error) {
+	return c.ListSnapshots(ctx, RoleLabelKey+"="+RoleImage)
+}
@@ -0,0 +1,97 @@
+package hcloud_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChecksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func testImageMeta() bsdhcloud.ImageMeta {
+	return bsdhcloud.ImageMeta{Version: "10.1", Arch: "amd64", BuildID: "b1", Checksum: testChecksum}
+}
+
+func TestImageMeta(t *testing.T) {
+	t.Parallel()
+
+	meta := testImageMeta()
+	labels := meta.Labels()
+
+	assert.Equal(t, "image", labels[bsdhcloud.RoleLabelKey])
+	assert.Equal(t, "10.1", labels[bsdhcloud.VersionLabelKey])
+	assert.Equal(t, "amd64", labels[bsdhcloud.ArchLabelKey])
+	assert.Equal(t, "b1", labels[bsdhcloud.BuildIDLabelKey])
+	assert.Equal(t, testChecksum[:32], labels[bsdhcloud.ChecksumLabelKey])
+	assert.Equal(t, "BlackBSD NetBSD 10.1 amd64 build b1 sha256:"+testChecksum, meta.Description())
+
+	meta.Checksum = ""
+	assert.NotContains(t, meta.Labels(), bsdhcloud.ChecksumLabelKey)
+}
+
+func TestPublishImage(t *testing.T) {
+	t.Parallel()
+
+	var request struct {
+		Labels      map[string]string `json:"labels"`
+		Type        string            `json:"type"`
+		Description string            `json:"description"`
+	}
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, r *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			if !strings.HasSuffix(r.URL.Path, "/actions/create_image") {
+				writeJSON(t, writer, `{"action": {"id": 5, "status": "success"}}`)
+				return
+			}
+
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			writer.WriteHeader(http.StatusCreated)
+			writeJSON(t, writer, `{"image": {"id": 77, "type": "snapshot"},
+				"action": {"id": 5, "status": "success"}}`)
+		}))
+	defer testServer.Close()
+
+	var server hcloudsdk.Server
+	server.ID = 42
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+	image, err := client.PublishImage(context.Background(), &server, testImageMeta())
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(77), image.ID)
+	assert.Equal(t, "snapshot", request.Type)
+	assert.Equal(t, "image", request.Labels[bsdhcloud.RoleLabelKey])
+	assert.Equal(t, "blackbsd-builder", request.Labels["managed-by"])
+	assert.NotContains(t, request.Labels, bsdhcloud.ExpiresAtLabelKey)
+	assert.Contains(t, request.Description, testChecksum)
+}
+
+func TestListImageSnapshots(t *testing.T) {
+	t.Parallel()
+
+	var selector string
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, r *http.Request) {
+			selector = r.URL.Query().Get("label_selector")
+			writer.Header().Set("Content-Type", "application/json")
+			writeJSON(t, writer, `{"images": [{"id": 3, "type": "snapshot"}]}`)
+		}))
+	defer testServer.Close()
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+	images, err := client.ListImageSnapshots(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, bsdhcloud.Label+",blackbsd-role=image", selector)
+}
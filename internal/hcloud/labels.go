@@ -0,0 +1,66 @@
+package hcloud
+
+import (
+	"crypto/rand"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// BuildIDLabelKey is the label key carrying the build identifier.
+	BuildIDLabelKey = "blackbsd-build-id"
+
+	// ExpiresAtLabelKey is the label key carrying the Unix time after which a
+	// resource may be reaped.
+	ExpiresAtLabelKey = "blackbsd-expires-at"
+
+	buildIDLength = 10
+)
+
+// NewBuildID returns a short random identifier for a single build.
+func NewBuildID() string {
+	return strings.ToLower(rand.Text()[:buildIDLength])
+}
+
+// BuildLabels returns the labels applied to every resource created for a build.
+func BuildLabels(buildID string) map[string]string {
+	labels := map[string]string{LabelKey: LabelValue}
+	if buildID != "" {
+		labels[BuildIDLabelKey] = buildID
+	}
+	return labels
+}
+
+// WithExpiry returns a copy of labels that expire at expiresAt.
+func WithExpiry(labels map[string]string, expiresAt time.Time) map[string]string {
+	expiring := make(map[string]string, len(labels)+1)
+	maps.Copy(expiring, labels)
+	expiring[ExpiresAtLabelKey] = strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiring
+}
+
+// ExpiresAt returns the expiry recorded in labels, if any.
+func ExpiresAt(labels map[string]string) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(labels[ExpiresAtLabelKey], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// unexpired reports whether labels carry an expiry later than now, as the
+// resources of a build that may still be running do.
+func unexpired(labels map[string]string, now time.Time) bool {
+	expiresAt, ok := ExpiresAt(labels)
+	return ok && expiresAt.After(now)
+}
+
+// mergeLabels combines extra labels with the managed-by label, which always wins.
+func mergeLabels(extra map[string]string) map[string]string {
+	labels := make(map[string]string, len(extra)+1)
+	maps.Copy(labels, extra)
+	labels[LabelKey] = LabelValue
+	return labels
+}
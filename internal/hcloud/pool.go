@@ -0,0 +1,297 @@
+package hcloud
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+const (
+	// RolePool marks a warm build server that is kept between builds.
+	RolePool = "pool"
+
+	poolNamePrefix = "blackbsd-pool-"
+)
+
+// IsPoolServer reports whether server belongs to the warm pool.
+func IsPoolServer(server *hcloud.Server) bool {
+	return server.Labels[RoleLabelKey] == RolePool
+}
+
+// PoolServerBusy reports whether a pool server is in use, and by which build.
+func PoolServerBusy(server *hcloud.Server) (string, bool) {
+	buildID, busy := server.Labels[BuildIDLabelKey]
+	return buildID, busy
+}
+
+// ListPoolServers returns all warm pool servers.
+func (c *Client) ListPoolServers(ctx context.Context) ([]*hcloud.Server, error) {
+	return c.listServers(ctx, RoleLabelKey+"="+RolePool)
+}
+
+// AcquirePoolServer hands the build described by opts an idle pool server
+// whose server type and location match one of its placements, wiping it with
+// the rebuild action instead of creating a server. Idle servers past their
+// idle timeout are torn down on the way, and servers still claimed by a build
+// past its expiry are taken back from it. When none fits, a new pool server is
+// created from opts. A server is claimed with the build's ID before it is
+// rebuilt, so builds racing for one do not both wipe it; while in use it
+// carries the build's ID and expiry, so teardown and reap treat it like any
+// other build server. A server whose rebuild fails is torn down rather than
+// left claimed.
+func (c *Client) AcquirePoolServer(ctx context.Context, opts *CreateOpts) (*hcloud.Server, error) {
+	servers, err := c.ListPoolServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, server := range servers {
+		if !c.poolServerAvailable(ctx, server, now) || !opts.fits(server) {
+			continue
+		}
+
+		claimed, claimErr := c.claimPoolServer(ctx, server, opts)
+		if claimErr != nil {
+			return nil, claimErr
+		}
+		if !claimed {
+			continue
+		}
+
+		resetErr := c.resetPoolServer(ctx, server, opts)
+		if resetErr == nil {
+			return server, nil
+		}
+
+		if _, teardownErr := c.TeardownServer(context.WithoutCancel(ctx), server); teardownErr != nil {
+			slog.Error("pool server teardown failed", "server_id", server.ID, "error", teardownErr)
+		}
+		return nil, resetErr
+	}
+
+	poolOpts := *opts
+	poolOpts.Name = poolNamePrefix + opts.Labels[BuildIDLabelKey]
+	poolOpts.Labels = maps.Clone(opts.Labels)
+	poolOpts.Labels[RoleLabelKey] = RolePool
+	return c.CreateServer(ctx, &poolOpts)
+}
+
+// ReleasePoolServer returns a pool server to the pool once its build is done.
+// The build's firewalls are removed from it and deleted along with the rest of
+// the build's resources, managed volumes are detached so other servers can use
+// them, and the server is labelled to expire after idle unless a later build
+// acquires it first.
+func (c *Client) ReleasePoolServer(ctx context.Context, server *hcloud.Server, idle time.Duration) error {
+	if err := c.unclaimPoolServer(ctx, server, time.Now().Add(idle)); err != nil {
+		return err
+	}
+
+	slog.Info("pool server released", "id", server.ID, "name", server.Name, "idle_timeout", idle)
+	return nil
+}
+
+// poolServerAvailable reports whether server may be claimed. An idle server
+// past its idle timeout is torn down instead. A server still claimed by a
+// build past its expiry was never released, as when the build crashed; the
+// claim is dropped and the server can be claimed again.
+func (c *Client) poolServerAvailable(ctx context.Context, server *hcloud.Server, now time.Time) bool {
+	_, busy := PoolServerBusy(server)
+	expiresAt, expired := expiredAt(server.Labels, now)
+	switch {
+	case !expired:
+		return !busy
+	case busy:
+		if err := c.unclaimPoolServer(ctx, server, expiresAt); err != nil {
+			slog.Warn("stale pool server claim not released", "server_id", server.ID, "error", err)
+			return false
+		}
+		slog.Info("stale pool server claim released", "id", server.ID, "name", server.Name)
+		return true
+	default:
+		if _, err := c.TeardownServer(ctx, server); err != nil {
+			slog.Warn("idle pool server teardown failed", "server_id", server.ID, "error", err)
+		}
+		return false
+	}
+}
+
+// unclaimPoolServer takes server back from the build it is labelled with: the
+// build's firewalls are removed from it and deleted along with the rest of the
+// build's resources, managed volumes are detached, and the server is labelled
+// idle until expiresAt.
+func (c *Client) unclaimPoolServer(ctx context.Context, server *hcloud.Server, expiresAt time.Time) error {
+	buildID, _ := PoolServerBusy(server)
+	if buildID != "" {
+		firewalls, err := c.listFirewalls(ctx, BuildIDLabelKey+"="+buildID)
+		if err != nil {
+			return err
+		}
+
+		for _, firewall := range firewalls {
+			if err = c.removeFirewall(ctx, firewall, server); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.detachManagedVolumes(ctx, server); err != nil {
+		return err
+	}
+
+	labels := maps.Clone(server.Labels)
+	delete(labels, BuildIDLabelKey)
+	if err := c.setServerLabels(ctx, server, WithExpiry(labels, expiresAt)); err != nil {
+		return err
+	}
+
+	return c.CleanupBuild(ctx, buildID)
+}
+
+// claimPoolServer labels an idle pool server with the build ID of opts before
+// anything else touches it. Hetzner labels have no compare-and-set, so the
+// server is read before and after the write: when builds race for it the last
+// write wins, and only the build that reads its own ID back may rebuild it.
+func (c *Client) claimPoolServer(ctx context.Context, server *hcloud.Server, opts *CreateOpts) (bool, error) {
+	buildID := opts.Labels[BuildIDLabelKey]
+
+	current, exists, err := c.poolServerClaim(ctx, server.ID)
+	if err != nil || !exists || current != "" {
+		return false, err
+	}
+
+	labels := maps.Clone(server.Labels)
+	labels[BuildIDLabelKey] = buildID
+	if expiresAt, ok := ExpiresAt(opts.Labels); ok {
+		labels = WithExpiry(labels, expiresAt)
+	}
+	if err = c.setServerLabels(ctx, server, labels); err != nil {
+		return false, err
+	}
+
+	current, exists, err = c.poolServerClaim(ctx, server.ID)
+	if err != nil {
+		return false, err
+	}
+	if !exists || current != buildID {
+		slog.Info("pool server claimed by another build", "id", server.ID, "build_id", current)
+		return false, nil
+	}
+	return true, nil
+}
+
+// poolServerClaim returns the build ID a pool server is currently labelled
+// with, "" when it is idle, and whether the server still exists.
+func (c *Client) poolServerClaim(ctx context.Context, id int64) (string, bool, error) {
+	found, err := c.GetServer(ctx, id)
+	if err != nil {
+		return "", false, err
+	}
+
+	server, ok := found.Get()
+	if !ok {
+		return "", false, nil
+	}
+	buildID, _ := PoolServerBusy(server)
+	return buildID, true, nil
+}
+
+// fits reports whether server was created with one of the placements of opts.
+func (opts *CreateOpts) fits(server *hcloud.Server) bool {
+	return slices.Contains(opts.placements(), Placement{
+		ServerType: server.Labels[ServerTypeLabelKey],
+		Location:   server.Labels[LocationLabelKey],
+	})
+}
+
+// resetPoolServer rebuilds server from the image of opts, powers it on if the
+// rebuild left it off, and hands it to the build: it takes over the build's
+// labels and firewalls while keeping its pool role and placement.
+func (c *Client) resetPoolServer(ctx context.Context, server *hcloud.Server, opts *CreateOpts) error {
+	var rebuildOpts hcloud.ServerRebuildOpts
+	rebuildOpts.Image = opts.image()
+
+	result, _, err := c.api.Server.RebuildWithResult(ctx, server, rebuildOpts)
+	if err != nil {
+		return fmt.Errorf("rebuild server %d: %w", server.ID, err)
+	}
+
+	if err = c.WaitForAction(ctx, result.Action); err != nil {
+		return err
+	}
+
+	labels := mergeLabels(opts.Labels)
+	labels[RoleLabelKey] = RolePool
+	labels[ServerTypeLabelKey] = server.Labels[ServerTypeLabelKey]
+	labels[LocationLabelKey] = server.Labels[LocationLabelKey]
+	if err = c.setServerLabels(ctx, server, labels); err != nil {
+		return err
+	}
+
+	for _, id := range opts.FirewallIDs {
+		var firewall hcloud.Firewall
+		firewall.ID = id
+		if err = c.applyFirewall(ctx, &firewall, server); err != nil {
+			return err
+		}
+	}
+
+	if c.ServerStatus(ctx, server.ID) == string(hcloud.ServerStatusOff) {
+		if err = c.PowerOnServer(ctx, server); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("pool server rebuilt", "id", server.ID, "name", server.Name)
+	return nil
+}
+
+// setServerLabels replaces the labels of server, keeping server in sync.
+func (c *Client) setServerLabels(ctx context.Context, server *hcloud.Server, labels map[string]string) error {
+	var updateOpts hcloud.ServerUpdateOpts
+	updateOpts.Labels = labels
+
+	if _, _, err := c.api.Server.Update(ctx, server, updateOpts); err != nil {
+		return fmt.Errorf("update labels of server %d: %w", server.ID, err)
+	}
+
+	server.Labels = labels
+	return nil
+}
+
+func (c *Client) applyFirewall(ctx context.Context, firewall *hcloud.Firewall, server *hcloud.Server) error {
+	actions, _, err := c.api.Firewall.ApplyResources(ctx, firewall, serverResource(server))
+	if err != nil {
+		return fmt.Errorf("apply firewall %d to server %d: %w", firewall.ID, server.ID, err)
+	}
+	return c.waitForActions(ctx, actions)
+}
+
+func (c *Client) removeFirewall(ctx context.Context, firewall *hcloud.Firewall, server *hcloud.Server) error {
+	actions, _, err := c.api.Firewall.RemoveResources(ctx, firewall, serverResource(server))
+	if err != nil && !hcloud.IsError(err, hcloud.ErrorCodeFirewallResourceNotFound) {
+		return fmt.Errorf("remove firewall %d from server %d: %w", firewall.ID, server.ID, err)
+	}
+	return c.waitForActions(ctx, actions)
+}
+
+func (c *Client) waitForActions(ctx context.Context, actions []*hcloud.Action) error {
+	for _, action := range actions {
+		if err := c.WaitForAction(ctx, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serverResource(server *hcloud.Server) []hcloud.FirewallResource {
+	var resource hcloud.FirewallResource
+	resource.Type = hcloud.FirewallResourceTypeServer
+	resource.Server = &hcloud.FirewallResourceServer{ID: server.ID}
+	return []hcloud.FirewallResource{resource}
+}
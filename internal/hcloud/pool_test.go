@@ -0,0 +1,266 @@
+package hcloud_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type poolRequests struct {
+	calls   []string
+	labels  map[string]string
+	created volumeRequest
+}
+
+// poolFake fakes the server and firewall endpoints used by the warm pool.
+// serversJSON answers server listings; label updates and creates are recorded.
+// A server read after a label update carries the updated labels, or the build
+// ID claimedBy when that is set, as if another build claimed it meanwhile.
+// Rebuilds fail when failRebuild is set.
+type poolFake struct {
+	t           *testing.T
+	requests    *poolRequests
+	serversJSON string
+	claimedBy   string
+	failRebuild bool
+	mu          sync.Mutex
+}
+
+func poolAPI(t *testing.T, serversJSON, claimedBy string) (*bsdhcloud.Client, *poolRequests) {
+	t.Helper()
+
+	return poolAPIWithRebuild(t, serversJSON, claimedBy, false)
+}
+
+func poolAPIWithRebuild(
+	t *testing.T, serversJSON, claimedBy string, failRebuild bool,
+) (*bsdhcloud.Client, *poolRequests) {
+	t.Helper()
+
+	fake := &poolFake{
+		t:           t,
+		requests:    &poolRequests{calls: nil, labels: nil, created: volumeRequest{}},
+		serversJSON: serversJSON,
+		claimedBy:   claimedBy,
+		failRebuild: failRebuild,
+		mu:          sync.Mutex{},
+	}
+	testServer := httptest.NewServer(fake)
+	t.Cleanup(testServer.Close)
+
+	return bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL)), fake.requests
+}
+
+func (fake *poolFake) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.requests.calls = append(fake.requests.calls, request.Method+" "+request.URL.Path)
+
+	writer.Header().Set("Content-Type", "application/json")
+	path := request.URL.Path
+	switch {
+	case path == "/servers" || request.Method == http.MethodPut:
+		fake.serveServers(writer, request)
+	case request.Method == http.MethodGet && strings.HasPrefix(path, "/servers/"):
+		fake.serveServer(writer)
+	case request.Method == http.MethodGet && path == "/firewalls":
+		writeJSON(fake.t, writer, `{"firewalls": [{"id": 5, "name": "blackbsd-builder-b1"}]}`)
+	case request.Method == http.MethodGet:
+		writeJSON(fake.t, writer, `{"volumes": [], "ssh_keys": []}`)
+	case strings.Contains(path, "/actions/"):
+		fake.serveAction(writer, path)
+	case request.Method == http.MethodDelete:
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// serveAction answers a server or firewall action.
+func (fake *poolFake) serveAction(writer http.ResponseWriter, path string) {
+	if fake.failRebuild && strings.HasSuffix(path, "/actions/rebuild") {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writeJSON(fake.t, writer, `{"error": {"code": "server_error", "message": "rebuild failed"}}`)
+		return
+	}
+
+	writeJSON(fake.t, writer, `{"action": {"id": 2, "status": "success"},
+		"actions": [{"id": 3, "status": "success"}]}`)
+}
+
+// serveServers lists, creates and updates servers.
+func (fake *poolFake) serveServers(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		writeJSON(fake.t, writer, fake.serversJSON)
+	case http.MethodPost:
+		assert.NoError(fake.t, json.NewDecoder(request.Body).Decode(&fake.requests.created))
+		writer.WriteHeader(http.StatusCreated)
+		writeJSON(fake.t, writer, `{"server": {"id": 7, "name": "created"},
+			"action": {"id": 1, "status": "success"}}`)
+	default:
+		var update struct {
+			Labels map[string]string `json:"labels"`
+		}
+		assert.NoError(fake.t, json.NewDecoder(request.Body).Decode(&update))
+		fake.requests.labels = update.Labels
+		writeJSON(fake.t, writer, `{"server": {"id": 1}}`)
+	}
+}
+
+// serveServer answers a server read with the labels last written to it.
+func (fake *poolFake) serveServer(writer http.ResponseWriter) {
+	labels := fake.requests.labels
+	if labels != nil && fake.claimedBy != "" {
+		labels = map[string]string{bsdhcloud.BuildIDLabelKey: fake.claimedBy}
+	}
+
+	encoded, err := json.Marshal(labels)
+	require.NoError(fake.t, err)
+	writeJSON(fake.t, writer, `{"server": {"id": 1, "status": "running", "labels": `+string(encoded)+`}}`)
+}
+
+func poolCreateOpts() *bsdhcloud.CreateOpts {
+	labels := bsdhcloud.WithExpiry(bsdhcloud.BuildLabels("b1"), time.Now().Add(time.Hour))
+	return &bsdhcloud.CreateOpts{
+		Labels:      labels,
+		Name:        "blackbsd-builder-b1",
+		ServerType:  "cpx31",
+		Image:       "ubuntu-24.04",
+		Location:    "fsn1",
+		SSHKeyIDs:   []int64{3},
+		FirewallIDs: []int64{5},
+		Placements:  nil,
+		ImageID:     0,
+		DisableIPv4: false,
+	}
+}
+
+func poolServerJSON(extraLabels string) string {
+	return poolServerJSONExpiring(time.Now().Add(time.Hour), extraLabels)
+}
+
+func poolServerJSONExpiring(expiry time.Time, extraLabels string) string {
+	expiresAt := strconv.FormatInt(expiry.Unix(), 10)
+	return `{"servers": [{"id": 1, "name": "blackbsd-pool-a1", "status": "off", "labels": {
+		"managed-by": "blackbsd-builder", "blackbsd-role": "pool",
+		"blackbsd-server-type": "cpx31", "blackbsd-location": "fsn1",
+		"blackbsd-expires-at": "` + expiresAt + `"` + extraLabels + `}}]}`
+}
+
+func TestAcquirePoolServer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rebuilds an idle server", func(t *testing.T) {
+		t.Parallel()
+
+		client, requests := poolAPI(t, poolServerJSON(""), "")
+
+		server, err := client.AcquirePoolServer(context.Background(), poolCreateOpts())
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(1), server.ID)
+		claim := slices.Index(requests.calls, "PUT /servers/1")
+		rebuild := slices.Index(requests.calls, "POST /servers/1/actions/rebuild")
+		require.NotEqual(t, -1, claim)
+		assert.Greater(t, rebuild, claim, "claimed before the rebuild")
+		assert.Contains(t, requests.calls, "POST /firewalls/5/actions/apply_to_resources")
+		assert.NotContains(t, requests.calls, "POST /servers")
+		assert.Equal(t, "b1", requests.labels[bsdhcloud.BuildIDLabelKey])
+		assert.Equal(t, bsdhcloud.RolePool, requests.labels[bsdhcloud.RoleLabelKey])
+		assert.Equal(t, "cpx31", requests.labels[bsdhcloud.ServerTypeLabelKey])
+		assert.Equal(t, "b1", server.Labels[bsdhcloud.BuildIDLabelKey])
+	})
+
+	t.Run("creates a server when the pool is busy", func(t *testing.T) {
+		t.Parallel()
+
+		client, requests := poolAPI(t, poolServerJSON(`, "blackbsd-build-id": "other"`), "")
+
+		server, err := client.AcquirePoolServer(context.Background(), poolCreateOpts())
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(7), server.ID)
+		assert.NotContains(t, requests.calls, "POST /servers/1/actions/rebuild")
+		assert.Equal(t, "blackbsd-pool-b1", requests.created.Name)
+		assert.Equal(t, bsdhcloud.RolePool, requests.created.Labels[bsdhcloud.RoleLabelKey])
+	})
+
+	t.Run("leaves a server another build claimed first", func(t *testing.T) {
+		t.Parallel()
+
+		client, requests := poolAPI(t, poolServerJSON(""), "other")
+
+		server, err := client.AcquirePoolServer(context.Background(), poolCreateOpts())
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(7), server.ID)
+		assert.Contains(t, requests.calls, "PUT /servers/1")
+		assert.NotContains(t, requests.calls, "POST /servers/1/actions/rebuild")
+	})
+
+	t.Run("takes back a server from a build past its expiry", func(t *testing.T) {
+		t.Parallel()
+
+		serversJSON := poolServerJSONExpiring(time.Now().Add(-time.Minute), `, "blackbsd-build-id": "crashed"`)
+		client, requests := poolAPI(t, serversJSON, "")
+
+		server, err := client.AcquirePoolServer(context.Background(), poolCreateOpts())
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(1), server.ID)
+		assert.Contains(t, requests.calls, "POST /firewalls/5/actions/remove_from_resources")
+		assert.Contains(t, requests.calls, "POST /servers/1/actions/rebuild")
+		assert.NotContains(t, requests.calls, "DELETE /servers/1")
+		assert.Equal(t, "b1", server.Labels[bsdhcloud.BuildIDLabelKey])
+	})
+
+	t.Run("tears down a server whose rebuild fails", func(t *testing.T) {
+		t.Parallel()
+
+		client, requests := poolAPIWithRebuild(t, poolServerJSON(""), "", true)
+
+		_, err := client.AcquirePoolServer(context.Background(), poolCreateOpts())
+		require.Error(t, err)
+
+		assert.Contains(t, requests.calls, "POST /servers/1/actions/rebuild")
+		assert.Contains(t, requests.calls, "DELETE /servers/1")
+		assert.NotContains(t, requests.calls, "POST /servers")
+	})
+}
+
+func TestReleasePoolServer(t *testing.T) {
+	t.Parallel()
+
+	client, requests := poolAPI(t, `{"servers": []}`, "")
+
+	var server hcloudsdk.Server
+	server.ID = 1
+	server.Labels = map[string]string{
+		bsdhcloud.LabelKey:        bsdhcloud.LabelValue,
+		bsdhcloud.RoleLabelKey:    bsdhcloud.RolePool,
+		bsdhcloud.BuildIDLabelKey: "b1",
+	}
+
+	before := time.Now()
+	require.NoError(t, client.ReleasePoolServer(context.Background(), &server, 30*time.Minute))
+
+	assert.Contains(t, requests.calls, "POST /firewalls/5/actions/remove_from_resources")
+	assert.Contains(t, requests.calls, "DELETE /firewalls/5")
+	assert.NotContains(t, requests.labels, bsdhcloud.BuildIDLabelKey)
+	assert.Equal(t, bsdhcloud.RolePool, requests.labels[bsdhcloud.RoleLabelKey])
+
+	expiresAt, ok := bsdhcloud.ExpiresAt(requests.labels)
+	require.True(t, ok)
+	assert.WithinDuration(t, before.Add(30*time.Minute), expiresAt, time.Minute)
+}
@@ -0,0 +1,293 @@
+package hcloud
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// ResourceKind names a type of Hetzner resource blackbsd creates.
+type ResourceKind string
+
+// Resource kinds in the order they are reaped: servers first so the volumes,
+// firewalls and keys attached to them are released.
+const (
+	KindServer   ResourceKind = "server"
+	KindVolume   ResourceKind = "volume"
+	KindFirewall ResourceKind = "firewall"
+	KindSSHKey   ResourceKind = "ssh key"
+	KindSnapshot ResourceKind = "snapshot"
+)
+
+// ExpiredResource is a blackbsd-managed resource whose expiry label has passed.
+// HourlyCost is its gross hourly price in EUR: a server's together with its
+// primary IPv4, the storage price of a volume or snapshot spread over the
+// hours of a month, and zero for firewalls and SSH keys.
+type ExpiredResource struct {
+	ExpiresAt  time.Time
+	remove     func(context.Context) (bool, error)
+	Kind       ResourceKind
+	Name       string
+	ID         int64
+	HourlyCost float64
+}
+
+// Remove deletes the resource. Returns true if deleted, false if it was already gone.
+func (r *ExpiredResource) Remove(ctx context.Context) (bool, error) {
+	return r.remove(ctx)
+}
+
+// hoursPerMonth spreads monthly prices over the hours of an average month.
+const hoursPerMonth = 730
+
+// prices holds the gross prices in EUR that HourlyCost is estimated from,
+// beyond the server prices the API includes with each server.
+type prices struct {
+	primaryIPv4   map[string]float64
+	volumeGBMonth float64
+	imageGBMonth  float64
+}
+
+// ListExpired returns every blackbsd-managed resource whose expires-at label is
+// at or before now, in reaping order. Resources without the label never expire.
+// Volumes and firewalls still attached to a live server are left alone.
+func (c *Client) ListExpired(ctx context.Context, now time.Time) ([]ExpiredResource, error) {
+	costs := c.fetchPrices(ctx)
+
+	servers, reaped, err := c.expiredServers(ctx, now, costs)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, err := c.expiredVolumes(ctx, now, reaped, costs)
+	if err != nil {
+		return nil, err
+	}
+
+	firewalls, err := c.expiredFirewalls(ctx, now, reaped)
+	if err != nil {
+		return nil, err
+	}
+
+	sshKeys, err := c.expiredSSHKeys(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := c.expiredSnapshots(ctx, now, costs)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Concat(servers, volumes, firewalls, sshKeys, snapshots), nil
+}
+
+// expiredServers also returns the IDs of the expired servers, so attached
+// resources can tell whether they are about to be released.
+func (c *Client) expiredServers(
+	ctx context.Context,
+	now time.Time,
+	costs prices,
+) ([]ExpiredResource, map[int64]bool, error) {
+	servers, err := c.listServers(ctx, ExpiresAtLabelKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var expired []ExpiredResource
+	reaped := make(map[int64]bool)
+	for _, server := range servers {
+		if expiresAt, ok := expiredAt(server.Labels, now); ok {
+			reaped[server.ID] = true
+			expired = append(expired, ExpiredResource{
+				ExpiresAt:  expiresAt,
+				remove:     func(ctx context.Context) (bool, error) { return c.TeardownServer(ctx, server) },
+				Kind:       KindServer,
+				Name:       server.Name,
+				ID:         server.ID,
+				HourlyCost: hourlyCost(server) + costs.ipv4Cost(server),
+			})
+		}
+	}
+	return expired, reaped, nil
+}
+
+func (c *Client) expiredVolumes(
+	ctx context.Context,
+	now time.Time,
+	reaped map[int64]bool,
+	costs prices,
+) ([]ExpiredResource, error) {
+	volumes, err := c.ListVolumes(ctx, ExpiresAtLabelKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredResource
+	for _, volume := range volumes {
+		expiresAt, ok := expiredAt(volume.Labels, now)
+		if !ok || (volume.Server != nil && !reaped[volume.Server.ID]) {
+			continue
+		}
+		expired = append(expired, ExpiredResource{
+			ExpiresAt:  expiresAt,
+			remove:     func(ctx context.Context) (bool, error) { return c.DeleteVolume(ctx, volume) },
+			Kind:       KindVolume,
+			Name:       volume.Name,
+			ID:         volume.ID,
+			HourlyCost: float64(volume.Size) * costs.volumeGBMonth / hoursPerMonth,
+		})
+	}
+	return expired, nil
+}
+
+func (c *Client) expiredFirewalls(
+	ctx context.Context,
+	now time.Time,
+	reaped map[int64]bool,
+) ([]ExpiredResource, error) {
+	firewalls, err := c.listFirewalls(ctx, ExpiresAtLabelKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredResource
+	for _, firewall := range firewalls {
+		expiresAt, ok := expiredAt(firewall.Labels, now)
+		if !ok || appliedToLiveServer(firewall, reaped) {
+			continue
+		}
+		expired = append(expired, ExpiredResource{
+			ExpiresAt:  expiresAt,
+			remove:     func(ctx context.Context) (bool, error) { return c.DeleteFirewall(ctx, firewall) },
+			Kind:       KindFirewall,
+			Name:       firewall.Name,
+			ID:         firewall.ID,
+			HourlyCost: 0,
+		})
+	}
+	return expired, nil
+}
+
+func (c *Client) expiredSSHKeys(ctx context.Context, now time.Time) ([]ExpiredResource, error) {
+	sshKeys, err := c.ListSSHKeys(ctx, ExpiresAtLabelKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredResource
+	for _, sshKey := range sshKeys {
+		if expiresAt, ok := expiredAt(sshKey.Labels, now); ok {
+			expired = append(expired, ExpiredResource{
+				ExpiresAt:  expiresAt,
+				remove:     func(ctx context.Context) (bool, error) { return c.DeleteSSHKey(ctx, sshKey) },
+				Kind:       KindSSHKey,
+				Name:       sshKey.Name,
+				ID:         sshKey.ID,
+				HourlyCost: 0,
+			})
+		}
+	}
+	return expired, nil
+}
+
+func (c *Client) expiredSnapshots(ctx context.Context, now time.Time, costs prices) ([]ExpiredResource, error) {
+	images, err := c.ListSnapshots(ctx, ExpiresAtLabelKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredResource
+	for _, image := range images {
+		if expiresAt, ok := expiredAt(image.Labels, now); ok {
+			expired = append(expired, ExpiredResource{
+				ExpiresAt:  expiresAt,
+				remove:     func(ctx context.Context) (bool, error) { return c.DeleteImage(ctx, image) },
+				Kind:       KindSnapshot,
+				Name:       image.Description,
+				ID:         image.ID,
+				HourlyCost: float64(image.ImageSize) * costs.imageGBMonth / hoursPerMonth,
+			})
+		}
+	}
+	return expired, nil
+}
+
+// expiredAt returns the expiry from labels when it is at or before now.
+func expiredAt(labels map[string]string, now time.Time) (time.Time, bool) {
+	expiresAt, ok := ExpiresAt(labels)
+	if !ok || expiresAt.After(now) {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+// appliedToLiveServer reports whether the firewall protects a server that is not being reaped.
+func appliedToLiveServer(firewall *hcloud.Firewall, reaped map[int64]bool) bool {
+	for _, resource := range firewall.AppliedTo {
+		if resource.Server != nil && !reaped[resource.Server.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// hourlyCost returns the server's gross hourly price in its location, or zero
+// when the API did not include pricing.
+func hourlyCost(server *hcloud.Server) float64 {
+	if server.ServerType == nil || server.Location == nil {
+		return 0
+	}
+
+	for _, pricing := range server.ServerType.Pricings {
+		if pricing.Location != nil && pricing.Location.Name == server.Location.Name {
+			return parsePrice(pricing.Hourly.Gross)
+		}
+	}
+	return 0
+}
+
+// fetchPrices fetches the current prices. They only feed the cost estimate, so
+// when they cannot be fetched the estimate counts servers alone.
+func (c *Client) fetchPrices(ctx context.Context) prices {
+	costs := prices{primaryIPv4: map[string]float64{}, volumeGBMonth: 0, imageGBMonth: 0}
+
+	pricing, _, err := c.api.Pricing.Get(ctx)
+	if err != nil {
+		slog.Warn("fetch pricing failed, estimating server costs only", "error", err)
+		return costs
+	}
+
+	costs.volumeGBMonth = parsePrice(pricing.Volume.PerGBMonthly.Gross)
+	costs.imageGBMonth = parsePrice(pricing.Image.PerGBMonth.Gross)
+	for _, primaryIP := range pricing.PrimaryIPs {
+		if primaryIP.Type != string(hcloud.PrimaryIPTypeIPv4) {
+			continue
+		}
+		for _, price := range primaryIP.Pricings {
+			costs.primaryIPv4[price.Location] = parsePrice(price.Hourly.Gross)
+		}
+	}
+	return costs
+}
+
+// ipv4Cost returns the hourly price of the server's primary IPv4, which is
+// deleted along with it, or zero when it has none.
+func (costs prices) ipv4Cost(server *hcloud.Server) float64 {
+	if server.PublicNet.IPv4.IP == nil || server.PublicNet.IPv4.IP.IsUnspecified() {
+		return 0
+	}
+	return costs.primaryIPv4[serverLocation(server)]
+}
+
+func parsePrice(price string) float64 {
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,150 @@
+package hcloud_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiryLabels(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round trips expiry", func(t *testing.T) {
+		t.Parallel()
+
+		labels := bsdhcloud.BuildLabels("b1")
+		expiresAt := time.Unix(1_800_000_000, 0)
+		expiring := bsdhcloud.WithExpiry(labels, expiresAt)
+
+		assert.Equal(t, "1800000000", expiring[bsdhcloud.ExpiresAtLabelKey])
+		assert.NotContains(t, labels, bsdhcloud.ExpiresAtLabelKey)
+
+		parsed, ok := bsdhcloud.ExpiresAt(expiring)
+		require.True(t, ok)
+		assert.True(t, parsed.Equal(expiresAt))
+	})
+
+	t.Run("missing or invalid label never expires", func(t *testing.T) {
+		t.Parallel()
+
+		_, ok := bsdhcloud.ExpiresAt(map[string]string{})
+		assert.False(t, ok)
+
+		_, ok = bsdhcloud.ExpiresAt(map[string]string{bsdhcloud.ExpiresAtLabelKey: "soon"})
+		assert.False(t, ok)
+	})
+}
+
+const reapServersJSON = `{"servers": [
+	{"id": 1, "name": "expired", "labels": {"blackbsd-expires-at": "1000"},
+	 "location": {"id": 1, "name": "fsn1"},
+	 "public_net": {"ipv4": {"id": 5, "ip": "203.0.113.7"}},
+	 "server_type": {"id": 1, "name": "cpx31", "prices": [
+		{"location": "nbg1", "price_hourly": {"net": "0.02", "gross": "0.0238"}},
+		{"location": "fsn1", "price_hourly": {"net": "0.01", "gross": "0.0119"}}
+	 ]}},
+	{"id": 2, "name": "fresh", "labels": {"blackbsd-expires-at": "3000"}}
+]}`
+
+const reapVolumesJSON = `{"volumes": [
+	{"id": 10, "name": "attached-to-live", "server": 2, "labels": {"blackbsd-expires-at": "1000"}},
+	{"id": 11, "name": "detached", "size": 73, "labels": {"blackbsd-expires-at": "1000"}}
+]}`
+
+const reapFirewallsJSON = `{"firewalls": [
+	{"id": 20, "name": "on-expired", "labels": {"blackbsd-expires-at": "1000"},
+	 "applied_to": [{"type": "server", "server": {"id": 1}}]},
+	{"id": 21, "name": "on-live", "labels": {"blackbsd-expires-at": "1000"},
+	 "applied_to": [{"type": "server", "server": {"id": 2}}]}
+]}`
+
+const reapSSHKeysJSON = `{"ssh_keys": [
+	{"id": 30, "name": "key", "labels": {"blackbsd-expires-at": "1000"}}
+]}`
+
+const reapImagesJSON = `{"images": [
+	{"id": 40, "type": "snapshot", "description": "fresh", "labels": {"blackbsd-expires-at": "3000"}},
+	{"id": 41, "type": "snapshot", "description": "old", "image_size": 14.6, "labels": {"blackbsd-expires-at": "1000"}}
+]}`
+
+const reapPricingJSON = `{"pricing": {
+	"volume": {"price_per_gb_month": {"net": "0.04", "gross": "0.0476"}},
+	"image": {"price_per_gb_month": {"net": "0.01", "gross": "0.0119"}},
+	"floating_ips": [{"type": "ipv4", "prices": []}, {"type": "ipv6", "prices": []}],
+	"primary_ips": [
+		{"type": "ipv4", "prices": [{"location": "fsn1", "price_hourly": {"net": "0.001", "gross": "0.0012"}}]},
+		{"type": "ipv6", "prices": [{"location": "fsn1", "price_hourly": {"net": "0", "gross": "0"}}]}
+	]
+}}`
+
+func TestListExpired(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		selectors []string
+	)
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mu.Lock()
+			selectors = append(selectors, request.URL.Query().Get("label_selector"))
+			mu.Unlock()
+
+			writer.Header().Set("Content-Type", "application/json")
+			switch {
+			case strings.HasSuffix(request.URL.Path, "/servers"):
+				writeJSON(t, writer, reapServersJSON)
+			case strings.HasSuffix(request.URL.Path, "/volumes"):
+				writeJSON(t, writer, reapVolumesJSON)
+			case strings.HasSuffix(request.URL.Path, "/firewalls"):
+				writeJSON(t, writer, reapFirewallsJSON)
+			case strings.HasSuffix(request.URL.Path, "/ssh_keys"):
+				writeJSON(t, writer, reapSSHKeysJSON)
+			case strings.HasSuffix(request.URL.Path, "/images"):
+				writeJSON(t, writer, reapImagesJSON)
+			case strings.HasSuffix(request.URL.Path, "/pricing"):
+				writeJSON(t, writer, reapPricingJSON)
+			}
+		}))
+	defer testServer.Close()
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+	expired, err := client.ListExpired(context.Background(), time.Unix(2000, 0))
+	require.NoError(t, err)
+
+	type entry struct {
+		kind bsdhcloud.ResourceKind
+		id   int64
+	}
+	got := make([]entry, 0, len(expired))
+	for _, resource := range expired {
+		got = append(got, entry{kind: resource.Kind, id: resource.ID})
+	}
+
+	assert.Equal(t, []entry{
+		{kind: bsdhcloud.KindServer, id: 1},
+		{kind: bsdhcloud.KindVolume, id: 11},
+		{kind: bsdhcloud.KindFirewall, id: 20},
+		{kind: bsdhcloud.KindSSHKey, id: 30},
+		{kind: bsdhcloud.KindSnapshot, id: 41},
+	}, got)
+	assert.InDelta(t, 0.0119+0.0012, expired[0].HourlyCost, 1e-9)
+	assert.InDelta(t, 73*0.0476/730, expired[1].HourlyCost, 1e-9)
+	assert.InDelta(t, 0, expired[2].HourlyCost, 1e-9)
+	assert.InDelta(t, 14.6*0.0119/730, expired[4].HourlyCost, 1e-6)
+	assert.True(t, expired[0].ExpiresAt.Equal(time.Unix(1000, 0)))
+
+	for _, selector := range selectors {
+		assert.Contains(t, []string{"", bsdhcloud.Label + "," + bsdhcloud.ExpiresAtLabelKey}, selector)
+	}
+}
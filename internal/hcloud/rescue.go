@@ -7,6 +7,8 @@ import (
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/samber/mo"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
 )
 
 // RescueOption configures rescue mode enablement.
@@ -39,7 +41,7 @@ func (c *Client) EnableRescue(
 	opts ...RescueOption,
 ) mo.Result[hcloud.ServerEnableRescueResult] {
 	rescueOpts := &hcloud.ServerEnableRescueOpts{
-		Type:   hcloud.ServerRescueTypeLinux64,
+		Type:    hcloud.ServerRescueTypeLinux64,
 		SSHKeys: nil,
 	}
 
@@ -65,3 +67,35 @@ func (c *Client) DisableRescue(ctx context.Context, server *hcloud.Server) error
 	}
 	return nil
 }
+
+// EnterRescue enables rescue mode, resets the server into it, and waits until
+// the server is running again. It returns the rescue root password, which
+// callers can use as a fallback when SSH key injection fails.
+func (c *Client) EnterRescue(
+	ctx context.Context,
+	server *hcloud.Server,
+	opts ...RescueOption,
+) (secret.Secret, error) {
+	result, err := c.EnableRescue(ctx, server, opts...).Get()
+	if err != nil {
+		return secret.Secret{}, fmt.Errorf("enable rescue for server %d: %w", server.ID, err)
+	}
+
+	password := secret.New(result.RootPassword)
+
+	if result.Action != nil {
+		if waitErr := c.WaitForAction(ctx, result.Action); waitErr != nil {
+			return password, waitErr
+		}
+	}
+
+	if resetErr := c.ResetServer(ctx, server); resetErr != nil {
+		return password, resetErr
+	}
+
+	if waitErr := c.WaitForServerStatus(ctx, server.ID, hcloud.ServerStatusRunning); waitErr != nil {
+		return password, waitErr
+	}
+
+	return password, nil
+}
@@ -2,8 +2,10 @@ package hcloud_test
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
@@ -86,3 +88,33 @@ func TestDisableRescue(t *testing.T) {
 		require.NoError(t, err)
 	})
 }
+
+func TestEnterRescue(t *testing.T) {
+	t.Parallel()
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			switch {
+			case strings.HasSuffix(request.URL.Path, "/actions/enable_rescue"):
+				writeJSON(t, writer, `{"action": {"id": 1, "status": "success"}, "root_password": "hunter2"}`)
+			case strings.HasSuffix(request.URL.Path, "/actions/reset"):
+				writeJSON(t, writer, `{"action": {"id": 2, "status": "success"}}`)
+			case strings.HasSuffix(request.URL.Path, "/actions"):
+				writeJSON(t, writer, `{"actions": [{"id": 1, "status": "success"}, {"id": 2, "status": "success"}]}`)
+			case strings.HasSuffix(request.URL.Path, "/servers/42"):
+				writeJSON(t, writer, `{"server": {"id": 42, "status": "running"}}`)
+			}
+		}))
+	defer testServer.Close()
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+	var srv hcloudsdk.Server
+	srv.ID = 42
+
+	password, err := client.EnterRescue(context.Background(), &srv)
+
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", password.Reveal())
+	assert.NotContains(t, fmt.Sprintf("%v %+v %#v", password, password, password), "hunter2")
+}
@@ -2,8 +2,12 @@ package hcloud
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"slices"
+	"strconv"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
@@ -11,19 +15,89 @@ import (
 	"github.com/samber/mo"
 )
 
+const (
+	// ServerTypeLabelKey records the server type a build server was created with.
+	ServerTypeLabelKey = "blackbsd-server-type"
+
+	// LocationLabelKey records the location a build server was created in.
+	LocationLabelKey = "blackbsd-location"
+
+	createRetries = 3
+)
+
+// ErrNotBuildServer is returned by FindServer for a server that exists but
+// does not carry the blackbsd label, so commands never touch other servers
+// in the project.
+var ErrNotBuildServer = errors.New("server is not a blackbsd build server")
+
 // CreateOpts defines options for creating a build server.
+// When ImageID is set it takes precedence over the Image name, which is how
+// the build command boots a cached base snapshot and boot-test a published
+// image. When Placements is set it
+// replaces ServerType and Location with an ordered list of preferences.
+// DisableIPv4 creates an IPv6-only server, avoiding the primary IPv4 charge.
 type CreateOpts struct {
-	Name       string
+	Labels      map[string]string
+	Name        string
+	ServerType  string
+	Image       string
+	Location    string
+	SSHKeyIDs   []int64
+	FirewallIDs []int64
+	Placements  []Placement
+	ImageID     int64
+	DisableIPv4 bool
+}
+
+// Placement is a server type and location combination to try.
+type Placement struct {
 	ServerType string
-	Image      string
 	Location   string
-	SSHKeyIDs  []int64
+}
+
+// Placements returns every combination of server types and locations in
+// preference order: each server type is tried in every location before
+// falling back to the next server type.
+func Placements(serverTypes, locations []string) []Placement {
+	placements := make([]Placement, 0, len(serverTypes)*len(locations))
+	for _, serverType := range serverTypes {
+		for _, location := range locations {
+			placements = append(placements, Placement{ServerType: serverType, Location: location})
+		}
+	}
+	return placements
+}
+
+func (opts *CreateOpts) placements() []Placement {
+	if len(opts.Placements) > 0 {
+		return opts.Placements
+	}
+	return []Placement{{ServerType: opts.ServerType, Location: opts.Location}}
+}
+
+func (opts *CreateOpts) image() *hcloud.Image {
+	var image hcloud.Image
+	image.Name = opts.Image
+	if opts.ImageID != 0 {
+		image.ID = opts.ImageID
+		image.Name = ""
+	}
+	return &image
 }
 
 // ListServers returns all servers matching the blackbsd label.
 func (c *Client) ListServers(ctx context.Context) ([]*hcloud.Server, error) {
+	return c.listServers(ctx, "")
+}
+
+func (c *Client) listServers(ctx context.Context, selector string) ([]*hcloud.Server, error) {
+	labelSelector := Label
+	if selector != "" {
+		labelSelector += "," + selector
+	}
+
 	var listOpts hcloud.ListOpts
-	listOpts.LabelSelector = Label
+	listOpts.LabelSelector = labelSelector
 
 	var serverListOpts hcloud.ServerListOpts
 	serverListOpts.ListOpts = listOpts
@@ -36,12 +110,48 @@ func (c *Client) ListServers(ctx context.Context) ([]*hcloud.Server, error) {
 }
 
 // GetServer fetches a server by ID, returning None if not found.
-func (c *Client) GetServer(ctx context.Context, id int64) mo.Option[*hcloud.Server] {
-	server, _, err := c.api.Server.GetByID(ctx, id)
-	if err != nil || server == nil {
-		return mo.None[*hcloud.Server]()
+// Any other failure is returned as an error.
+func (c *Client) GetServer(ctx context.Context, id int64) (mo.Option[*hcloud.Server], error) {
+	server, resp, err := c.api.Server.GetByID(ctx, id)
+	if isNotFound(resp) {
+		return mo.None[*hcloud.Server](), nil
+	}
+
+	if err != nil {
+		return mo.None[*hcloud.Server](), fmt.Errorf("get server %d: %w", id, err)
+	}
+
+	if server == nil {
+		return mo.None[*hcloud.Server](), nil
+	}
+	return mo.Some(server), nil
+}
+
+// FindServer fetches a build server by ID or, when ref is not a number, by
+// name, returning None if there is no such server. A server without the
+// blackbsd label is rejected with ErrNotBuildServer.
+func (c *Client) FindServer(ctx context.Context, ref string) (mo.Option[*hcloud.Server], error) {
+	found := mo.None[*hcloud.Server]()
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		found, err = c.GetServer(ctx, id)
+		if err != nil {
+			return found, err
+		}
+	} else {
+		server, _, err := c.api.Server.GetByName(ctx, ref)
+		if err != nil {
+			return found, fmt.Errorf("get server %q: %w", ref, err)
+		}
+		if server != nil {
+			found = mo.Some(server)
+		}
+	}
+
+	server, ok := found.Get()
+	if ok && server.Labels[LabelKey] != LabelValue {
+		return mo.None[*hcloud.Server](), fmt.Errorf("server %s: %w", ref, ErrNotBuildServer)
 	}
-	return mo.Some(server)
+	return found, nil
 }
 
 // DeleteServer deletes a server. Returns true if deleted, false if not found.
@@ -62,20 +172,51 @@ func (c *Client) DeleteServer(
 }
 
 // CreateServer provisions a new build server with the blackbsd label.
+// Placements are tried in order: capacity errors move on to the next one,
+// transient errors are retried in place, and anything else, an invalid server
+// type included, aborts. After a dropped connection the request is only sent
+// again when the server it was creating does not exist. The placement that
+// succeeded is recorded in the server's labels.
 func (c *Client) CreateServer(
 	ctx context.Context,
 	opts *CreateOpts,
+) (*hcloud.Server, error) {
+	placements := opts.placements()
+
+	var lastErr error
+	for _, placement := range placements {
+		server, err := c.createServerAt(ctx, opts, placement)
+		if err == nil {
+			slog.Info("server created", "id", server.ID, "name", server.Name,
+				"server_type", placement.ServerType, "location", placement.Location)
+			return server, nil
+		}
+
+		if ClassifyError(err) != ErrorClassCapacity {
+			return nil, fmt.Errorf("create server %s: %w", opts.Name, err)
+		}
+
+		slog.Warn("placement unavailable, trying next", "server_type", placement.ServerType,
+			"location", placement.Location, "error", err)
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("create server %s: no capacity in %d placement(s): %w",
+		opts.Name, len(placements), lastErr)
+}
+
+func (c *Client) createServerAt(
+	ctx context.Context,
+	opts *CreateOpts,
+	placement Placement,
 ) (*hcloud.Server, error) {
 	var result hcloud.ServerCreateResult
 
 	var serverType hcloud.ServerType
-	serverType.Name = opts.ServerType
-
-	var image hcloud.Image
-	image.Name = opts.Image
+	serverType.Name = placement.ServerType
 
 	var location hcloud.Location
-	location.Name = opts.Location
+	location.Name = placement.Location
 
 	sshKeys := lo.Map(opts.SSHKeyIDs, func(id int64, _ int) *hcloud.SSHKey {
 		var sshKey hcloud.SSHKey
@@ -83,33 +224,123 @@ func (c *Client) CreateServer(
 		return &sshKey
 	})
 
+	firewalls := lo.Map(opts.FirewallIDs, func(id int64, _ int) *hcloud.ServerCreateFirewall {
+		var firewall hcloud.ServerCreateFirewall
+		firewall.Firewall.ID = id
+		return &firewall
+	})
+
+	labels := mergeLabels(opts.Labels)
+	labels[ServerTypeLabelKey] = placement.ServerType
+	labels[LocationLabelKey] = placement.Location
+
 	var createOpts hcloud.ServerCreateOpts
 	createOpts.Name = opts.Name
 	createOpts.ServerType = &serverType
-	createOpts.Image = &image
+	createOpts.Image = opts.image()
 	createOpts.Location = &location
 	createOpts.SSHKeys = sshKeys
-	createOpts.Labels = map[string]string{LabelKey: LabelValue}
+	createOpts.Firewalls = firewalls
+	createOpts.Labels = labels
+
+	if opts.DisableIPv4 {
+		var publicNet hcloud.ServerCreatePublicNet
+		publicNet.EnableIPv4 = false
+		publicNet.EnableIPv6 = true
+		createOpts.PublicNet = &publicNet
+	}
 
+	// A create whose connection dropped may still have created the server.
+	// Sending it again would fail on the name now taken or, were the name to
+	// change, leave a second server behind, so the server is looked up first.
+	dropped := false
 	retryOperation := func() error {
+		if dropped {
+			found, err := c.droppedServer(ctx, opts)
+			if server, ok := found.Get(); ok || err != nil {
+				result.Server = server
+				return retryable(err)
+			}
+		}
+
 		var err error
 		result, _, err = c.api.Server.Create(ctx, createOpts)
-		return err
+		dropped = err != nil && isNetworkError(err)
+		return retryable(err)
 	}
 
-	if err := backoff.Retry(retryOperation, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)); err != nil {
-		return nil, fmt.Errorf("create server %s: %w", opts.Name, err)
+	policy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), createRetries)
+	if err := backoff.Retry(retryOperation, backoff.WithContext(policy, ctx)); err != nil {
+		return nil, err
 	}
 
-	slog.Info("server created", "id", result.Server.ID, "name", result.Server.Name)
 	return result.Server, nil
 }
 
-// ServerStatus returns the status of a server by ID.
+// droppedServer returns the server a dropped create request for opts made,
+// or None when there is none. A server of that name from another build is
+// not it: creating one again then fails on the taken name.
+func (c *Client) droppedServer(ctx context.Context, opts *CreateOpts) (mo.Option[*hcloud.Server], error) {
+	server, _, err := c.api.Server.GetByName(ctx, opts.Name)
+	if err != nil {
+		return mo.None[*hcloud.Server](), fmt.Errorf("get server %q: %w", opts.Name, err)
+	}
+
+	if server == nil || server.Labels[LabelKey] != LabelValue ||
+		server.Labels[BuildIDLabelKey] != opts.Labels[BuildIDLabelKey] {
+		return mo.None[*hcloud.Server](), nil
+	}
+
+	slog.Info("server created by dropped request", "id", server.ID, "name", server.Name)
+	return mo.Some(server), nil
+}
+
+// retryable marks err permanent for backoff.Retry unless it is transient.
+func retryable(err error) error {
+	if err != nil && ClassifyError(err) != ErrorClassTransient {
+		return backoff.Permanent(err)
+	}
+	return err
+}
+
+// ServerStatus returns the status of a server by ID, or "unknown" when the
+// server does not exist or cannot be fetched.
 func (c *Client) ServerStatus(ctx context.Context, id int64) string {
-	opt := c.GetServer(ctx, id)
+	opt, err := c.GetServer(ctx, id)
+	if err != nil {
+		slog.Warn("server status unavailable", "id", id, "error", err)
+		return "unknown"
+	}
+
 	if server, ok := opt.Get(); ok {
 		return string(server.Status)
 	}
 	return "unknown"
 }
+
+// ServerAddress returns the address to reach a server on: its public IPv4
+// address, or the IPv6 address for IPv6-only servers.
+func ServerAddress(server *hcloud.Server) string {
+	if server.PublicNet.IPv4.IP != nil {
+		return server.PublicNet.IPv4.IP.String()
+	}
+
+	if ip := IPv6Address(server); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// IPv6Address returns the ::1 host of the server's /64, which Hetzner images
+// configure as the server's IPv6 address, or nil when IPv6 is disabled.
+func IPv6Address(server *hcloud.Server) net.IP {
+	network := server.PublicNet.IPv6.IP.To16()
+	if network == nil || server.PublicNet.IPv6.IP.To4() != nil {
+		return nil
+	}
+
+	host := slices.Clone(network)
+	clear(host[net.IPv6len/2:])
+	host[net.IPv6len-1] = 1
+	return host
+}
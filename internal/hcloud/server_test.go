@@ -3,9 +3,11 @@ package hcloud_test
 import (
 	"context"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
@@ -106,7 +108,8 @@ func TestGetServer(t *testing.T) {
 		defer testServer.Close()
 
 		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
-		result := client.GetServer(context.Background(), 42)
+		result, err := client.GetServer(context.Background(), 42)
+		require.NoError(t, err)
 
 		assert.True(t, result.IsPresent())
 		srv, _ := result.Get()
@@ -123,12 +126,76 @@ func TestGetServer(t *testing.T) {
 		defer testServer.Close()
 
 		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
-		result := client.GetServer(context.Background(), 42)
+		result, err := client.GetServer(context.Background(), 42)
+		require.NoError(t, err)
+
+		assert.False(t, result.IsPresent())
+	})
+
+	t.Run("returns error after retrying server errors", func(t *testing.T) {
+		t.Parallel()
+
+		var requests atomic.Int32
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				requests.Add(1)
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusInternalServerError)
+				writeJSON(t, writer, `{"error": {"code": "server_error", "message": "boom"}}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithTransportOpts(fastTransportOpts(),
+			hcloudsdk.WithEndpoint(testServer.URL))
+		result, err := client.GetServer(context.Background(), 42)
 
+		require.Error(t, err)
 		assert.False(t, result.IsPresent())
+		assert.Equal(t, int32(3), requests.Load())
 	})
 }
 
+func TestFindServer(t *testing.T) {
+	t.Parallel()
+
+	const buildServer = `{"id": 42, "name": "blackbsd-abc", "labels": {"managed-by": "blackbsd-builder"}}`
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, r *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			switch {
+			case strings.Contains(r.URL.Path, "/servers/42"):
+				writeJSON(t, writer, `{"server": `+buildServer+`}`)
+			case r.URL.Query().Get("name") == "blackbsd-abc":
+				writeJSON(t, writer, `{"servers": [`+buildServer+`]}`)
+			case r.URL.Query().Get("name") == "database":
+				writeJSON(t, writer, `{"servers": [{"id": 7, "name": "database", "labels": {}}]}`)
+			default:
+				writeJSON(t, writer, `{"servers": []}`)
+			}
+		}))
+	t.Cleanup(testServer.Close)
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+
+	for _, ref := range []string{"42", "blackbsd-abc"} {
+		result, err := client.FindServer(context.Background(), ref)
+		require.NoError(t, err)
+
+		srv, ok := result.Get()
+		require.True(t, ok, ref)
+		assert.Equal(t, int64(42), srv.ID)
+	}
+
+	result, err := client.FindServer(context.Background(), "missing")
+	require.NoError(t, err)
+	assert.False(t, result.IsPresent())
+
+	result, err = client.FindServer(context.Background(), "database")
+	require.ErrorIs(t, err, bsdhcloud.ErrNotBuildServer)
+	assert.False(t, result.IsPresent())
+}
+
 func TestServerStatus(t *testing.T) {
 	t.Parallel()
 
@@ -197,11 +264,16 @@ func TestCreateServer(t *testing.T) {
 
 		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
 		opts := &bsdhcloud.CreateOpts{
-			Name:       "test-server",
-			ServerType: "cpx31",
-			Image:      "ubuntu-24.04",
-			Location:   "fsn1",
-			SSHKeyIDs:  []int64{123},
+			Labels:      nil,
+			Name:        "test-server",
+			ServerType:  "cpx31",
+			Image:       "ubuntu-24.04",
+			Location:    "fsn1",
+			SSHKeyIDs:   []int64{123},
+			FirewallIDs: nil,
+			Placements:  nil,
+			ImageID:     0,
+			DisableIPv4: false,
 		}
 
 		result, err := client.CreateServer(context.Background(), opts)
@@ -218,4 +290,304 @@ func TestCreateServer(t *testing.T) {
 		assert.Contains(t, requestBodies[0], "managed-by")
 		assert.Contains(t, requestBodies[0], "blackbsd-builder")
 	})
+
+	t.Run("attaches firewalls and build labels", func(t *testing.T) {
+		t.Parallel()
+
+		var requestBody string
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, r *http.Request) {
+				body, readErr := io.ReadAll(r.Body)
+				require.NoError(t, readErr)
+				requestBody = string(body)
+
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusCreated)
+				writeJSON(t, writer, `{
+					"server": {"id": 42, "name": "test-server", "status": "running"},
+					"action": {"id": 1, "status": "running"}
+				}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		opts := &bsdhcloud.CreateOpts{
+			Labels:      bsdhcloud.BuildLabels("build1"),
+			Name:        "test-server",
+			ServerType:  "cpx31",
+			Image:       "ubuntu-24.04",
+			Location:    "fsn1",
+			SSHKeyIDs:   nil,
+			FirewallIDs: []int64{7},
+			Placements:  nil,
+			ImageID:     0,
+			DisableIPv4: false,
+		}
+
+		_, err := client.CreateServer(context.Background(), opts)
+
+		require.NoError(t, err)
+		assert.Contains(t, requestBody, `"firewalls":[{"firewall":7}]`)
+		assert.Contains(t, requestBody, `"blackbsd-build-id":"build1"`)
+		assert.Contains(t, requestBody, `"managed-by":"blackbsd-builder"`)
+	})
+
+	t.Run("creates IPv6-only server", func(t *testing.T) {
+		t.Parallel()
+
+		var requestBody string
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, r *http.Request) {
+				body, readErr := io.ReadAll(r.Body)
+				require.NoError(t, readErr)
+				requestBody = string(body)
+
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusCreated)
+				writeJSON(t, writer, `{
+					"server": {"id": 42, "name": "test-server", "status": "running"},
+					"action": {"id": 1, "status": "running"}
+				}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		opts := &bsdhcloud.CreateOpts{
+			Labels:      nil,
+			Name:        "test-server",
+			ServerType:  "cpx31",
+			Image:       "ubuntu-24.04",
+			Location:    "fsn1",
+			SSHKeyIDs:   nil,
+			FirewallIDs: nil,
+			Placements:  nil,
+			ImageID:     0,
+			DisableIPv4: true,
+		}
+
+		_, err := client.CreateServer(context.Background(), opts)
+
+		require.NoError(t, err)
+		assert.Contains(t, requestBody, `"enable_ipv4":false`)
+		assert.Contains(t, requestBody, `"enable_ipv6":true`)
+	})
+}
+
+func TestServerAddress(t *testing.T) {
+	t.Parallel()
+
+	t.Run("prefers IPv4", func(t *testing.T) {
+		t.Parallel()
+
+		var server hcloudsdk.Server
+		server.PublicNet.IPv4.IP = net.ParseIP("192.0.2.10")
+		server.PublicNet.IPv6.IP = net.ParseIP("2001:db8:1:2::")
+
+		assert.Equal(t, "192.0.2.10", bsdhcloud.ServerAddress(&server))
+		assert.Equal(t, "2001:db8:1:2::1", bsdhcloud.IPv6Address(&server).String())
+	})
+
+	t.Run("uses ::1 of the /64 for IPv6-only servers", func(t *testing.T) {
+		t.Parallel()
+
+		var server hcloudsdk.Server
+		server.PublicNet.IPv6.IP = net.ParseIP("2001:db8:1:2::")
+
+		assert.Equal(t, "2001:db8:1:2::1", bsdhcloud.ServerAddress(&server))
+	})
+
+	t.Run("returns empty without public addresses", func(t *testing.T) {
+		t.Parallel()
+
+		var server hcloudsdk.Server
+
+		assert.Empty(t, bsdhcloud.ServerAddress(&server))
+		assert.Nil(t, bsdhcloud.IPv6Address(&server))
+	})
+}
+
+func TestPlacements(t *testing.T) {
+	t.Parallel()
+
+	placements := bsdhcloud.Placements([]string{"cpx31", "cpx41"}, []string{"fsn1", "nbg1"})
+
+	assert.Equal(t, []bsdhcloud.Placement{
+		{ServerType: "cpx31", Location: "fsn1"},
+		{ServerType: "cpx31", Location: "nbg1"},
+		{ServerType: "cpx41", Location: "fsn1"},
+		{ServerType: "cpx41", Location: "nbg1"},
+	}, placements)
+}
+
+func TestCreateServerFallback(t *testing.T) {
+	t.Parallel()
+
+	newOpts := func() *bsdhcloud.CreateOpts {
+		return &bsdhcloud.CreateOpts{
+			Labels:      nil,
+			Name:        "test-server",
+			ServerType:  "",
+			Image:       "ubuntu-24.04",
+			Location:    "",
+			SSHKeyIDs:   nil,
+			FirewallIDs: nil,
+			Placements:  bsdhcloud.Placements([]string{"cpx31"}, []string{"fsn1", "nbg1"}),
+			ImageID:     0,
+			DisableIPv4: false,
+		}
+	}
+
+	t.Run("moves to next placement on capacity error", func(t *testing.T) {
+		t.Parallel()
+
+		var requestBodies []string
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, r *http.Request) {
+				body, readErr := io.ReadAll(r.Body)
+				require.NoError(t, readErr)
+				requestBodies = append(requestBodies, string(body))
+
+				writer.Header().Set("Content-Type", "application/json")
+				if strings.Contains(string(body), `"location":"fsn1"`) {
+					writer.WriteHeader(http.StatusPreconditionFailed)
+					writeJSON(t, writer, `{"error": {"code": "resource_unavailable", "message": "unavailable"}}`)
+					return
+				}
+
+				writer.WriteHeader(http.StatusCreated)
+				writeJSON(t, writer, `{
+					"server": {"id": 42, "name": "test-server", "status": "initializing"},
+					"action": {"id": 1, "status": "running"}
+				}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		result, err := client.CreateServer(context.Background(), newOpts())
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), result.ID)
+		require.Len(t, requestBodies, 2)
+		assert.Contains(t, requestBodies[1], `"blackbsd-location":"nbg1"`)
+		assert.Contains(t, requestBodies[1], `"blackbsd-server-type":"cpx31"`)
+	})
+
+	t.Run("stops on fatal error", func(t *testing.T) {
+		t.Parallel()
+
+		requests := 0
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				requests++
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusUnauthorized)
+				writeJSON(t, writer, `{"error": {"code": "unauthorized", "message": "bad token"}}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		_, err := client.CreateServer(context.Background(), newOpts())
+
+		require.Error(t, err)
+		assert.Equal(t, 1, requests)
+	})
+
+	// droppedCreateAPI drops the connection of the first create request and
+	// answers lookups by name with serversJSON.
+	droppedCreateAPI := func(t *testing.T, serversJSON string, creates *atomic.Int32) *httptest.Server {
+		t.Helper()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, request *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				if request.Method == http.MethodGet {
+					writeJSON(t, writer, serversJSON)
+					return
+				}
+
+				if creates.Add(1) == 1 {
+					conn, _, hijackErr := http.NewResponseController(writer).Hijack()
+					require.NoError(t, hijackErr)
+					require.NoError(t, conn.Close())
+					return
+				}
+
+				writer.WriteHeader(http.StatusCreated)
+				writeJSON(t, writer, `{
+					"server": {"id": 42, "name": "test-server", "status": "initializing"},
+					"action": {"id": 1, "status": "running"}
+				}`)
+			}))
+		t.Cleanup(testServer.Close)
+		return testServer
+	}
+
+	t.Run("retries a dropped connection that created nothing", func(t *testing.T) {
+		t.Parallel()
+
+		var creates atomic.Int32
+		testServer := droppedCreateAPI(t, `{"servers": []}`, &creates)
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		result, err := client.CreateServer(context.Background(), newOpts())
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), result.ID)
+		assert.Equal(t, int32(2), creates.Load())
+	})
+
+	t.Run("returns the server a dropped connection created", func(t *testing.T) {
+		t.Parallel()
+
+		var creates atomic.Int32
+		testServer := droppedCreateAPI(t, `{"servers": [{"id": 7, "name": "test-server", "status": "initializing",
+			"labels": {"managed-by": "blackbsd-builder"}}]}`, &creates)
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		result, err := client.CreateServer(context.Background(), newOpts())
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), result.ID)
+		assert.Equal(t, int32(1), creates.Load())
+	})
+
+	t.Run("stops on an invalid server type", func(t *testing.T) {
+		t.Parallel()
+
+		var requests atomic.Int32
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				requests.Add(1)
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusUnprocessableEntity)
+				writeJSON(t, writer, `{"error": {"code": "invalid_server_type", "message": "no such type"}}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		_, err := client.CreateServer(context.Background(), newOpts())
+
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "no capacity")
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("reports exhaustion when no placement has capacity", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusPreconditionFailed)
+				writeJSON(t, writer, `{"error": {"code": "resource_unavailable", "message": "unavailable"}}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		_, err := client.CreateServer(context.Background(), newOpts())
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no capacity in 2 placement(s)")
+		assert.Equal(t, bsdhcloud.ErrorClassCapacity, bsdhcloud.ClassifyError(err))
+	})
 }
@@ -0,0 +1,34 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrArchMismatch is returned when a server type's CPU architecture does not
+// match the NetBSD port being built.
+var ErrArchMismatch = errors.New("server type architecture mismatch")
+
+// CheckServerTypeArch verifies that every named server type exists and has
+// the given architecture ("x86" or "arm"), so an amd64 build is never placed
+// on a CAX server or the other way round.
+func (c *Client) CheckServerTypeArch(ctx context.Context, names []string, arch string) error {
+	for _, name := range names {
+		serverType, _, err := c.api.ServerType.GetByName(ctx, name)
+		if err != nil {
+			return fmt.Errorf("get server type %s: %w", name, err)
+		}
+
+		if serverType == nil {
+			return fmt.Errorf("server type %s not found", name)
+		}
+
+		if string(serverType.Architecture) != arch {
+			return fmt.Errorf("%w: %s is %s, build needs %s",
+				ErrArchMismatch, name, serverType.Architecture, arch)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package hcloud_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serverTypeAPI(t *testing.T) *bsdhcloud.Client {
+	t.Helper()
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			switch request.URL.Query().Get("name") {
+			case "cax21":
+				writeJSON(t, writer, `{"server_types": [{"id": 45, "name": "cax21", "architecture": "arm"}]}`)
+			case "cpx31":
+				writeJSON(t, writer, `{"server_types": [{"id": 9, "name": "cpx31", "architecture": "x86"}]}`)
+			default:
+				writeJSON(t, writer, `{"server_types": []}`)
+			}
+		}))
+	t.Cleanup(testServer.Close)
+
+	return bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+}
+
+func TestCheckServerTypeArch(t *testing.T) {
+	t.Parallel()
+
+	t.Run("accepts matching types", func(t *testing.T) {
+		t.Parallel()
+
+		client := serverTypeAPI(t)
+		require.NoError(t, client.CheckServerTypeArch(context.Background(), []string{"cax21"}, "arm"))
+		require.NoError(t, client.CheckServerTypeArch(context.Background(), []string{"cpx31"}, "x86"))
+	})
+
+	t.Run("rejects mismatched type", func(t *testing.T) {
+		t.Parallel()
+
+		err := serverTypeAPI(t).CheckServerTypeArch(context.Background(), []string{"cax21", "cpx31"}, "arm")
+		require.ErrorIs(t, err, bsdhcloud.ErrArchMismatch)
+		assert.Contains(t, err.Error(), "cpx31 is x86")
+	})
+
+	t.Run("rejects unknown type", func(t *testing.T) {
+		t.Parallel()
+
+		err := serverTypeAPI(t).CheckServerTypeArch(context.Background(), []string{"cx99"}, "x86")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cx99 not found")
+	})
+}
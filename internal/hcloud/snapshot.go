@@ -0,0 +1,75 @@
+package hcloud
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// SnapshotOpts defines options for snapshotting a server disk.
+type SnapshotOpts struct {
+	Labels      map[string]string
+	Description string
+}
+
+// CreateSnapshot snapshots the server's disk and waits until the image is available.
+func (c *Client) CreateSnapshot(
+	ctx context.Context,
+	server *hcloud.Server,
+	opts *SnapshotOpts,
+) (*hcloud.Image, error) {
+	var imageOpts hcloud.ServerCreateImageOpts
+	imageOpts.Type = hcloud.ImageTypeSnapshot
+	imageOpts.Description = hcloud.Ptr(opts.Description)
+	imageOpts.Labels = mergeLabels(opts.Labels)
+
+	result, _, err := c.api.Server.CreateImage(ctx, server, &imageOpts)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot server %d: %w", server.ID, err)
+	}
+
+	if result.Action != nil {
+		if waitErr := c.WaitForAction(ctx, result.Action); waitErr != nil {
+			return nil, waitErr
+		}
+	}
+
+	slog.Info("snapshot created", "id", result.Image.ID, "server_id", server.ID, "description", opts.Description)
+	return result.Image, nil
+}
+
+// ListSnapshots returns all blackbsd-managed snapshots, optionally narrowed by
+// an additional label selector.
+func (c *Client) ListSnapshots(ctx context.Context, selector string) ([]*hcloud.Image, error) {
+	labelSelector := Label
+	if selector != "" {
+		labelSelector += "," + selector
+	}
+
+	var imageListOpts hcloud.ImageListOpts
+	imageListOpts.LabelSelector = labelSelector
+	imageListOpts.Type = []hcloud.ImageType{hcloud.ImageTypeSnapshot}
+	imageListOpts.Sort = []string{"created:desc"}
+
+	images, err := c.api.Image.AllWithOpts(ctx, imageListOpts)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	return images, nil
+}
+
+// DeleteImage deletes a snapshot image. Returns true if deleted, false if not found.
+func (c *Client) DeleteImage(ctx context.Context, image *hcloud.Image) (bool, error) {
+	_, err := c.api.Image.Delete(ctx, image)
+	if err != nil {
+		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("delete image %d: %w", image.ID, err)
+	}
+
+	slog.Info("image deleted", "id", image.ID, "description", image.Description)
+	return true, nil
+}
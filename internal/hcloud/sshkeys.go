@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
 	"github.com/samber/mo"
 )
 
@@ -38,15 +40,93 @@ func (c *Client) EnsureSSHKey(
 	return created, nil
 }
 
-// FindSSHKeyByFingerprint finds an SSH key by its fingerprint.
+// FindSSHKeyByFingerprint finds an SSH key by its fingerprint, returning None
+// if no key matches. Any other failure is returned as an error.
 func (c *Client) FindSSHKeyByFingerprint(
 	ctx context.Context,
 	fingerprint string,
-) mo.Option[*hcloud.SSHKey] {
-	sshKey, _, err := c.api.SSHKey.GetByFingerprint(ctx, fingerprint)
-	if err != nil || sshKey == nil {
-		return mo.None[*hcloud.SSHKey]()
+) (mo.Option[*hcloud.SSHKey], error) {
+	sshKey, resp, err := c.api.SSHKey.GetByFingerprint(ctx, fingerprint)
+	if isNotFound(resp) {
+		return mo.None[*hcloud.SSHKey](), nil
 	}
 
-	return mo.Some(sshKey)
+	if err != nil {
+		return mo.None[*hcloud.SSHKey](), fmt.Errorf("get ssh key by fingerprint %s: %w", fingerprint, err)
+	}
+
+	if sshKey == nil {
+		return mo.None[*hcloud.SSHKey](), nil
+	}
+	return mo.Some(sshKey), nil
+}
+
+// CreateSSHKey registers a new SSH key carrying the blackbsd label plus labels.
+func (c *Client) CreateSSHKey(
+	ctx context.Context,
+	name string,
+	publicKey string,
+	labels map[string]string,
+) (*hcloud.SSHKey, error) {
+	var createOpts hcloud.SSHKeyCreateOpts
+	createOpts.Name = name
+	createOpts.PublicKey = publicKey
+	createOpts.Labels = mergeLabels(labels)
+
+	created, _, err := c.api.SSHKey.Create(ctx, createOpts)
+	if err != nil {
+		return nil, fmt.Errorf("create ssh key %q: %w", name, err)
+	}
+
+	slog.Info("ssh key created", "name", name, "id", created.ID)
+	return created, nil
+}
+
+// ListSSHKeys returns all blackbsd-managed SSH keys, optionally narrowed by
+// an additional label selector.
+func (c *Client) ListSSHKeys(ctx context.Context, selector string) ([]*hcloud.SSHKey, error) {
+	labelSelector := Label
+	if selector != "" {
+		labelSelector += "," + selector
+	}
+
+	var sshKeyListOpts hcloud.SSHKeyListOpts
+	sshKeyListOpts.LabelSelector = labelSelector
+
+	sshKeys, err := c.api.SSHKey.AllWithOpts(ctx, sshKeyListOpts)
+	if err != nil {
+		return nil, fmt.Errorf("list ssh keys: %w", err)
+	}
+	return sshKeys, nil
+}
+
+// OrphanedSSHKeys returns the per-build SSH keys whose build is over: those
+// whose build has expired by now and has no server left among servers. A
+// build registers its key before it creates its server, so a key of a build
+// that has not expired is kept even without one.
+func OrphanedSSHKeys(sshKeys []*hcloud.SSHKey, servers []*hcloud.Server, now time.Time) []*hcloud.SSHKey {
+	live := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if buildID := server.Labels[BuildIDLabelKey]; buildID != "" {
+			live[buildID] = true
+		}
+	}
+
+	return lo.Filter(sshKeys, func(sshKey *hcloud.SSHKey, _ int) bool {
+		return !live[sshKey.Labels[BuildIDLabelKey]] && !unexpired(sshKey.Labels, now)
+	})
+}
+
+// DeleteSSHKey deletes an SSH key. Returns true if deleted, false if not found.
+func (c *Client) DeleteSSHKey(ctx context.Context, sshKey *hcloud.SSHKey) (bool, error) {
+	_, err := c.api.SSHKey.Delete(ctx, sshKey)
+	if err != nil {
+		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("delete ssh key %d: %w", sshKey.ID, err)
+	}
+
+	slog.Info("ssh key deleted", "id", sshKey.ID, "name", sshKey.Name)
+	return true, nil
 }
@@ -2,11 +2,13 @@ package hcloud_test
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
 	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
@@ -92,7 +94,8 @@ func TestFindSSHKeyByFingerprint(t *testing.T) {
 		defer testServer.Close()
 
 		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
-		result := client.FindSSHKeyByFingerprint(context.Background(), "ab:cd:ef")
+		result, err := client.FindSSHKeyByFingerprint(context.Background(), "ab:cd:ef")
+		require.NoError(t, err)
 
 		assert.True(t, result.IsPresent())
 		sshKey, present := result.Get()
@@ -111,8 +114,105 @@ func TestFindSSHKeyByFingerprint(t *testing.T) {
 		defer testServer.Close()
 
 		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
-		result := client.FindSSHKeyByFingerprint(context.Background(), "no:such:fp")
+		result, err := client.FindSSHKeyByFingerprint(context.Background(), "no:such:fp")
+		require.NoError(t, err)
 
 		assert.False(t, result.IsPresent())
 	})
 }
+
+func TestCreateSSHKey(t *testing.T) {
+	t.Parallel()
+
+	var requestBody string
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			body, readErr := io.ReadAll(request.Body)
+			require.NoError(t, readErr)
+			requestBody = string(body)
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusCreated)
+			writeJSON(t, writer,
+				`{"ssh_key": {"id": 5, "name": "blackbsd-builder-b1", "public_key": "ssh-ed25519 AAA"}}`)
+		}))
+	defer testServer.Close()
+
+	client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+	sshKey, err := client.CreateSSHKey(context.Background(), "blackbsd-builder-b1", "ssh-ed25519 AAA",
+		bsdhcloud.BuildLabels("b1"))
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), sshKey.ID)
+	assert.Contains(t, requestBody, `"blackbsd-build-id":"b1"`)
+	assert.Contains(t, requestBody, `"managed-by":"blackbsd-builder"`)
+}
+
+func TestDeleteSSHKey(t *testing.T) {
+	t.Parallel()
+
+	var sshKey hcloudsdk.SSHKey
+	sshKey.ID = 5
+
+	t.Run("deletes existing key", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.WriteHeader(http.StatusNoContent)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		deleted, err := client.DeleteSSHKey(context.Background(), &sshKey)
+
+		require.NoError(t, err)
+		assert.True(t, deleted)
+	})
+
+	t.Run("returns false for 404", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(http.StatusNotFound)
+				writeJSON(t, writer, `{"error": {"code": "not_found", "message": "not found"}}`)
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		deleted, err := client.DeleteSSHKey(context.Background(), &sshKey)
+
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	})
+}
+
+func TestOrphanedSSHKeys(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	sshKey := func(id int64, buildID string, expiresAt time.Time) *hcloudsdk.SSHKey {
+		var key hcloudsdk.SSHKey
+		key.ID = id
+		key.Labels = bsdhcloud.WithExpiry(bsdhcloud.BuildLabels(buildID), expiresAt)
+		return &key
+	}
+
+	var server hcloudsdk.Server
+	server.Labels = bsdhcloud.BuildLabels("live")
+
+	sshKeys := []*hcloudsdk.SSHKey{
+		sshKey(1, "done", now.Add(-time.Minute)),
+		// A running build registers its key before it creates its server.
+		sshKey(2, "starting", now.Add(time.Hour)),
+		// An expired build whose teardown failed still has its server.
+		sshKey(3, "live", now.Add(-time.Minute)),
+	}
+
+	result := bsdhcloud.OrphanedSSHKeys(sshKeys, []*hcloudsdk.Server{&server}, now)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, int64(1), result[0].ID)
+}
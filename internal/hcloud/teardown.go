@@ -0,0 +1,94 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// TeardownServer detaches blackbsd-managed volumes, deletes the server, waits
+// for the deletion to finish, and then deletes every blackbsd-managed firewall
+// that was applied to it along with the remaining resources of its build.
+// Volumes are kept: artifacts outlive the server and the cache is reused.
+// Returns true if the server was deleted, false if it was already gone.
+func (c *Client) TeardownServer(ctx context.Context, server *hcloud.Server) (bool, error) {
+	if detachErr := c.detachManagedVolumes(ctx, server); detachErr != nil {
+		slog.Warn("detach volumes failed, deleting server anyway", "server_id", server.ID, "error", detachErr)
+	}
+
+	result, _, err := c.api.Server.DeleteWithResult(ctx, server)
+	deleted := err == nil
+	if err != nil && !hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+		return false, fmt.Errorf("delete server %d: %w", server.ID, err)
+	}
+
+	if deleted {
+		slog.Info("server deleted", "id", server.ID, "name", server.Name)
+		if result.Action != nil {
+			if waitErr := c.WaitForAction(ctx, result.Action); waitErr != nil {
+				return true, waitErr
+			}
+		}
+	}
+
+	for _, status := range server.PublicNet.Firewalls {
+		if delErr := c.deleteManagedFirewall(ctx, status.Firewall.ID); delErr != nil {
+			return deleted, delErr
+		}
+	}
+
+	return deleted, c.CleanupBuild(ctx, server.Labels[BuildIDLabelKey])
+}
+
+// CleanupBuild deletes the firewalls and SSH keys labelled with buildID.
+// It is a no-op for an empty build ID.
+func (c *Client) CleanupBuild(ctx context.Context, buildID string) error {
+	if buildID == "" {
+		return nil
+	}
+
+	selector := BuildIDLabelKey + "=" + buildID
+
+	sshKeys, err := c.ListSSHKeys(ctx, selector)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sshKey := range sshKeys {
+		if _, delErr := c.DeleteSSHKey(ctx, sshKey); delErr != nil {
+			errs = append(errs, delErr)
+		}
+	}
+
+	firewalls, err := c.listFirewalls(ctx, selector)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	for _, firewall := range firewalls {
+		if _, delErr := c.DeleteFirewall(ctx, firewall); delErr != nil {
+			errs = append(errs, delErr)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deleteManagedFirewall deletes the firewall with the given ID if it carries the blackbsd label.
+func (c *Client) deleteManagedFirewall(ctx context.Context, id int64) error {
+	firewall, _, err := c.api.Firewall.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get firewall %d: %w", id, err)
+	}
+
+	if firewall == nil || firewall.Labels[LabelKey] != LabelValue {
+		return nil
+	}
+
+	_, err = c.DeleteFirewall(ctx, firewall)
+	return err
+}
@@ -0,0 +1,69 @@
+package hcloud_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupBuild(t *testing.T) {
+	t.Parallel()
+
+	t.Run("deletes ssh keys and firewalls labelled with the build", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu        sync.Mutex
+			deleted   []string
+			selectors []string
+		)
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, request *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				writer.Header().Set("Content-Type", "application/json")
+
+				if request.Method == http.MethodDelete {
+					deleted = append(deleted, request.URL.Path)
+					writer.WriteHeader(http.StatusNoContent)
+					return
+				}
+
+				selectors = append(selectors, request.URL.Query().Get("label_selector"))
+				switch {
+				case strings.HasSuffix(request.URL.Path, "/ssh_keys"):
+					writeJSON(t, writer, `{"ssh_keys": [{"id": 5, "name": "blackbsd-builder-b1"}]}`)
+				case strings.HasSuffix(request.URL.Path, "/firewalls"):
+					writeJSON(t, writer, `{"firewalls": [{"id": 7, "name": "blackbsd-builder-b1"}]}`)
+				}
+			}))
+		defer testServer.Close()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+		err := client.CleanupBuild(context.Background(), "b1")
+
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"/ssh_keys/5", "/firewalls/7"}, deleted)
+		for _, selector := range selectors {
+			assert.Contains(t, selector, "blackbsd-build-id=b1")
+		}
+	})
+
+	t.Run("is a no-op without build id", func(t *testing.T) {
+		t.Parallel()
+
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint("http://192.0.2.1"))
+
+		assert.NoError(t, client.CleanupBuild(context.Background(), ""))
+	})
+}
@@ -0,0 +1,254 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTransportRetries   = 5
+	defaultTransportBaseDelay = 500 * time.Millisecond
+	defaultTransportMaxDelay  = 30 * time.Second
+)
+
+// TransportOpts configures the retrying transport used for all Hetzner API calls.
+type TransportOpts struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultTransportOpts returns the retry settings used by NewClient.
+func DefaultTransportOpts() TransportOpts {
+	return TransportOpts{
+		MaxRetries: defaultTransportRetries,
+		BaseDelay:  defaultTransportBaseDelay,
+		MaxDelay:   defaultTransportMaxDelay,
+	}
+}
+
+// retryTransport is an http.RoundTripper that honors Hetzner's rate-limit
+// headers and retries failures that are safe to repeat:
+//   - 429 responses for any method, since the request was not processed;
+//   - 5xx responses and network errors for idempotent methods only.
+type retryTransport struct {
+	resetAt time.Time
+	next    http.RoundTripper
+	opts    TransportOpts
+	mu      sync.Mutex
+	// exhausted is set when the last response reported RateLimit-Remaining: 0.
+	exhausted bool
+}
+
+// NewRetryTransport wraps next with rate-limit and transient-error handling.
+func NewRetryTransport(next http.RoundTripper, opts TransportOpts) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &retryTransport{
+		resetAt:   time.Time{},
+		next:      next,
+		opts:      opts,
+		mu:        sync.Mutex{},
+		exhausted: false,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if err := sleepContext(ctx, t.rateLimitDelay()); err != nil {
+			return nil, err
+		}
+
+		attemptReq, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.next.RoundTrip(attemptReq)
+		if resp != nil {
+			t.observeRateLimit(resp.Header)
+		}
+
+		delay, retry := t.retryDelay(req, resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+
+		slog.Debug("retrying hetzner request", "method", req.Method, "path", req.URL.Path,
+			"attempt", attempt+1, "delay", delay, "status", statusOf(resp), "error", err)
+
+		if resp != nil {
+			drainAndClose(resp.Body)
+		}
+
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return nil, sleepErr
+		}
+	}
+}
+
+// retryDelay decides whether the attempt should be retried and after how long.
+func (t *retryTransport) retryDelay(
+	req *http.Request,
+	resp *http.Response,
+	err error,
+	attempt int,
+) (time.Duration, bool) {
+	if attempt >= t.opts.MaxRetries || req.Context().Err() != nil {
+		return 0, false
+	}
+
+	if err != nil {
+		var netErr net.Error
+		if isIdempotent(req.Method) && (errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			return t.backoff(attempt), true
+		}
+		return 0, false
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return max(t.untilReset(resp.Header), t.backoff(attempt)), true
+	case resp.StatusCode >= http.StatusInternalServerError && isIdempotent(req.Method):
+		return t.backoff(attempt), true
+	default:
+		return 0, false
+	}
+}
+
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	delay := t.opts.BaseDelay << attempt
+	if delay <= 0 || delay > t.opts.MaxDelay {
+		return t.opts.MaxDelay
+	}
+	return delay
+}
+
+// untilReset returns how long until the rate limit resets, capped at MaxDelay.
+func (t *retryTransport) untilReset(header http.Header) time.Duration {
+	resetAt, ok := parseReset(header)
+	if !ok {
+		return 0
+	}
+	return min(time.Until(resetAt), t.opts.MaxDelay)
+}
+
+// observeRateLimit records whether the budget is exhausted and when it resets.
+func (t *retryTransport) observeRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	resetAt, ok := parseReset(header)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.exhausted = remaining <= 0 && ok
+	t.resetAt = resetAt
+}
+
+// rateLimitDelay returns how long to hold a request back when the budget is exhausted.
+func (t *retryTransport) rateLimitDelay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.exhausted {
+		return 0
+	}
+
+	wait := time.Until(t.resetAt)
+	if wait <= 0 {
+		t.exhausted = false
+		return 0
+	}
+	return min(wait, t.opts.MaxDelay)
+}
+
+func parseReset(header http.Header) (time.Time, bool) {
+	value := header.Get("RateLimit-Reset")
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// rewindRequest returns req for the first attempt, and a clone with a fresh
+// body for subsequent attempts.
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("retry %s %s: request body cannot be replayed", req.Method, req.URL.Path)
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("retry %s %s: %w", req.Method, req.URL.Path, err)
+	}
+
+	cloned := req.Clone(req.Context())
+	cloned.Body = body
+	return cloned, nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func drainAndClose(body io.ReadCloser) {
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		slog.Debug("drain error", "error", err)
+	}
+	if err := body.Close(); err != nil {
+		slog.Debug("close error", "error", err)
+	}
+}
+
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
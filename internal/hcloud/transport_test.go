@@ -0,0 +1,199 @@
+package hcloud_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fastTransportOpts() bsdhcloud.TransportOpts {
+	return bsdhcloud.TransportOpts{
+		MaxRetries: 2,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   2 * time.Second,
+	}
+}
+
+func doRequest(t *testing.T, transport http.RoundTripper, method, target, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), method, target, strings.NewReader(body))
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, resp.Body.Close()) })
+	return resp
+}
+
+func TestRetryTransport(t *testing.T) {
+	t.Parallel()
+
+	t.Run("retries 429 after rate limit reset", func(t *testing.T) {
+		t.Parallel()
+
+		var requests atomic.Int32
+		var firstAt, secondAt time.Time
+		reset := time.Now().Add(time.Second).Truncate(time.Second).Add(time.Second)
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				if requests.Add(1) == 1 {
+					firstAt = time.Now()
+					writer.Header().Set("RateLimit-Remaining", "0")
+					writer.Header().Set("RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+					writer.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				secondAt = time.Now()
+				writer.WriteHeader(http.StatusOK)
+			}))
+		defer testServer.Close()
+
+		transport := bsdhcloud.NewRetryTransport(nil, bsdhcloud.TransportOpts{
+			MaxRetries: 2,
+			BaseDelay:  time.Millisecond,
+			MaxDelay:   5 * time.Second,
+		})
+		resp := doRequest(t, transport, http.MethodGet, testServer.URL, "")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(2), requests.Load())
+		assert.False(t, secondAt.Before(reset), "retried %s before reset", reset.Sub(secondAt))
+		assert.True(t, secondAt.After(firstAt))
+	})
+
+	t.Run("replays POST body on 429", func(t *testing.T) {
+		t.Parallel()
+
+		var requests atomic.Int32
+		var bodies []string
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, request *http.Request) {
+				body, err := io.ReadAll(request.Body)
+				assert.NoError(t, err)
+				bodies = append(bodies, string(body))
+
+				if requests.Add(1) == 1 {
+					writer.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				writer.WriteHeader(http.StatusCreated)
+			}))
+		defer testServer.Close()
+
+		transport := bsdhcloud.NewRetryTransport(nil, fastTransportOpts())
+		resp := doRequest(t, transport, http.MethodPost, testServer.URL, `{"name":"builder"}`)
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, []string{`{"name":"builder"}`, `{"name":"builder"}`}, bodies)
+	})
+
+	t.Run("retries 5xx for GET", func(t *testing.T) {
+		t.Parallel()
+
+		var requests atomic.Int32
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				if requests.Add(1) < 3 {
+					writer.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				writer.WriteHeader(http.StatusOK)
+			}))
+		defer testServer.Close()
+
+		transport := bsdhcloud.NewRetryTransport(nil, fastTransportOpts())
+		resp := doRequest(t, transport, http.MethodGet, testServer.URL, "")
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("does not retry 5xx for POST", func(t *testing.T) {
+		t.Parallel()
+
+		var requests atomic.Int32
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				requests.Add(1)
+				writer.WriteHeader(http.StatusInternalServerError)
+			}))
+		defer testServer.Close()
+
+		transport := bsdhcloud.NewRetryTransport(nil, fastTransportOpts())
+		resp := doRequest(t, transport, http.MethodPost, testServer.URL, "{}")
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("holds requests while rate limit is exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		var requests atomic.Int32
+		reset := time.Now().Add(time.Second).Truncate(time.Second).Add(time.Second)
+		var secondAt time.Time
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				if requests.Add(1) == 1 {
+					writer.Header().Set("RateLimit-Remaining", "0")
+					writer.Header().Set("RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+				} else {
+					secondAt = time.Now()
+				}
+				writer.WriteHeader(http.StatusOK)
+			}))
+		defer testServer.Close()
+
+		transport := bsdhcloud.NewRetryTransport(nil, bsdhcloud.TransportOpts{
+			MaxRetries: 0,
+			BaseDelay:  time.Millisecond,
+			MaxDelay:   5 * time.Second,
+		})
+		doRequest(t, transport, http.MethodGet, testServer.URL, "")
+		doRequest(t, transport, http.MethodGet, testServer.URL, "")
+
+		assert.Equal(t, int32(2), requests.Load())
+		assert.False(t, secondAt.Before(reset), "sent %s before reset", reset.Sub(secondAt))
+	})
+
+	t.Run("stops waiting when context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.WriteHeader(http.StatusServiceUnavailable)
+			}))
+		defer testServer.Close()
+
+		transport := bsdhcloud.NewRetryTransport(nil, bsdhcloud.TransportOpts{
+			MaxRetries: 5,
+			BaseDelay:  time.Minute,
+			MaxDelay:   time.Minute,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, testServer.URL, http.NoBody)
+		require.NoError(t, err)
+
+		resp, err := transport.RoundTrip(req)
+		if resp != nil {
+			require.NoError(t, resp.Body.Close())
+		}
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
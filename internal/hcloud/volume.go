@@ -0,0 +1,210 @@
+package hcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// ListVolumes returns all blackbsd-managed volumes, optionally narrowed by
+// an additional label selector.
+func (c *Client) ListVolumes(ctx context.Context, selector string) ([]*hcloud.Volume, error) {
+	labelSelector := Label
+	if selector != "" {
+		labelSelector += "," + selector
+	}
+
+	var volumeListOpts hcloud.VolumeListOpts
+	volumeListOpts.LabelSelector = labelSelector
+
+	volumes, err := c.api.Volume.AllWithOpts(ctx, volumeListOpts)
+	if err != nil {
+		return nil, fmt.Errorf("list volumes: %w", err)
+	}
+	return volumes, nil
+}
+
+// DeleteVolume deletes a detached volume. Returns true if deleted, false if not found.
+func (c *Client) DeleteVolume(ctx context.Context, volume *hcloud.Volume) (bool, error) {
+	_, err := c.api.Volume.Delete(ctx, volume)
+	if err != nil {
+		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("delete volume %d: %w", volume.ID, err)
+	}
+
+	slog.Info("volume deleted", "id", volume.ID, "name", volume.Name)
+	return true, nil
+}
+
+const (
+	// RoleArtifacts marks a per-build volume that stages build artifacts.
+	RoleArtifacts = "artifacts"
+
+	// RoleCache marks the persistent per-location volume that caches NetBSD
+	// install media and pkgsrc binaries across builds.
+	RoleCache = "cache"
+
+	cacheVolumePrefix = "blackbsd-cache-"
+)
+
+// ErrVolumeInUse is returned when the cache volume is attached to another server.
+var ErrVolumeInUse = errors.New("volume is attached to another server")
+
+// CreateArtifactsVolume creates a volume attached to server for staging build
+// artifacts. It carries the build's labels, expiry included, so it outlives
+// teardown detached until it is downloaded from or reaped.
+func (c *Client) CreateArtifactsVolume(
+	ctx context.Context,
+	server *hcloud.Server,
+	labels map[string]string,
+	sizeGB int,
+) (*hcloud.Volume, error) {
+	volumeLabels := make(map[string]string, len(labels)+1)
+	maps.Copy(volumeLabels, labels)
+	volumeLabels[RoleLabelKey] = RoleArtifacts
+
+	return c.createAttachedVolume(ctx, server, server.Name+"-artifacts", volumeLabels, sizeGB)
+}
+
+// AttachCacheVolume attaches the cache volume for server's location, creating
+// it on first use. Volumes cannot move between locations, so each location
+// has its own cache. It carries no expiry and serves one build at a time.
+func (c *Client) AttachCacheVolume(ctx context.Context, server *hcloud.Server, sizeGB int) (*hcloud.Volume, error) {
+	location := serverLocation(server)
+	volumes, err := c.ListVolumes(ctx, RoleLabelKey+"="+RoleCache+","+LocationLabelKey+"="+location)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(volumes) == 0 {
+		return c.createAttachedVolume(ctx, server, cacheVolumePrefix+location, map[string]string{
+			RoleLabelKey:     RoleCache,
+			LocationLabelKey: location,
+		}, sizeGB)
+	}
+
+	volume := volumes[0]
+	if volume.Server != nil {
+		if volume.Server.ID == server.ID {
+			return volume, nil
+		}
+		return nil, fmt.Errorf("attach cache volume %d: %w %d", volume.ID, ErrVolumeInUse, volume.Server.ID)
+	}
+
+	if err = c.AttachVolume(ctx, volume, server); err != nil {
+		return nil, err
+	}
+	return volume, nil
+}
+
+// AttachVolume attaches a volume to server and waits for the action.
+func (c *Client) AttachVolume(ctx context.Context, volume *hcloud.Volume, server *hcloud.Server) error {
+	action, _, err := c.api.Volume.Attach(ctx, volume, server)
+	if err != nil {
+		return fmt.Errorf("attach volume %d to server %d: %w", volume.ID, server.ID, err)
+	}
+
+	if err = c.WaitForAction(ctx, action); err != nil {
+		return err
+	}
+
+	slog.Info("volume attached", "id", volume.ID, "name", volume.Name, "server_id", server.ID)
+	trackVolume(server, volume)
+	return nil
+}
+
+// DetachVolume detaches a volume from its server and waits for the action.
+// A volume that no longer exists is treated as detached.
+func (c *Client) DetachVolume(ctx context.Context, volume *hcloud.Volume) error {
+	action, _, err := c.api.Volume.Detach(ctx, volume)
+	if err != nil {
+		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return nil
+		}
+		return fmt.Errorf("detach volume %d: %w", volume.ID, err)
+	}
+
+	if err = c.WaitForAction(ctx, action); err != nil {
+		return err
+	}
+
+	slog.Info("volume detached", "id", volume.ID, "name", volume.Name)
+	return nil
+}
+
+func (c *Client) createAttachedVolume(
+	ctx context.Context,
+	server *hcloud.Server,
+	name string,
+	labels map[string]string,
+	sizeGB int,
+) (*hcloud.Volume, error) {
+	var opts hcloud.VolumeCreateOpts
+	opts.Name = name
+	opts.Size = sizeGB
+	opts.Server = server
+	opts.Labels = mergeLabels(labels)
+	opts.Automount = hcloud.Ptr(false)
+
+	result, _, err := c.api.Volume.Create(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("create volume %s: %w", name, err)
+	}
+
+	for _, action := range append([]*hcloud.Action{result.Action}, result.NextActions...) {
+		if action == nil {
+			continue
+		}
+		if waitErr := c.WaitForAction(ctx, action); waitErr != nil {
+			return nil, waitErr
+		}
+	}
+
+	slog.Info("volume created", "id", result.Volume.ID, "name", name, "server_id", server.ID)
+	trackVolume(server, result.Volume)
+	return result.Volume, nil
+}
+
+// trackVolume records volume as attached to server, so teardown detaches
+// volumes attached after the server was fetched.
+func trackVolume(server *hcloud.Server, volume *hcloud.Volume) {
+	if !slices.ContainsFunc(server.Volumes, func(attached *hcloud.Volume) bool { return attached.ID == volume.ID }) {
+		server.Volumes = append(server.Volumes, volume)
+	}
+}
+
+// detachManagedVolumes detaches the blackbsd-managed volumes attached to
+// server so they are released cleanly before it is deleted.
+func (c *Client) detachManagedVolumes(ctx context.Context, server *hcloud.Server) error {
+	var errs []error
+	for _, attached := range server.Volumes {
+		volume, _, err := c.api.Volume.GetByID(ctx, attached.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("get volume %d: %w", attached.ID, err))
+			continue
+		}
+
+		if volume == nil || volume.Labels[LabelKey] != LabelValue {
+			continue
+		}
+
+		if err = c.DetachVolume(ctx, volume); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func serverLocation(server *hcloud.Server) string {
+	if server.Location != nil {
+		return server.Location.Name
+	}
+	return server.Labels[LocationLabelKey]
+}
@@ -0,0 +1,166 @@
+package hcloud_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type volumeRequest struct {
+	Labels map[string]string `json:"labels"`
+	Name   string            `json:"name"`
+	Server int64             `json:"server"`
+	Size   int               `json:"size"`
+}
+
+// volumeAPI fakes the volume endpoints. listJSON answers volume listings;
+// create requests are decoded into created and every call is recorded.
+func volumeAPI(t *testing.T, listJSON string) (*bsdhcloud.Client, *[]string, *volumeRequest) {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		calls   []string
+		created volumeRequest
+	)
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, request.Method+" "+request.URL.Path)
+
+			writer.Header().Set("Content-Type", "application/json")
+			switch {
+			case request.Method == http.MethodGet && strings.HasSuffix(request.URL.Path, "/volumes"):
+				assert.Contains(t, request.URL.Query().Get("label_selector"), "blackbsd-location=fsn1")
+				writeJSON(t, writer, listJSON)
+			case request.Method == http.MethodPost && strings.HasSuffix(request.URL.Path, "/volumes"):
+				assert.NoError(t, json.NewDecoder(request.Body).Decode(&created))
+				writer.WriteHeader(http.StatusCreated)
+				writeJSON(t, writer, `{"volume": {"id": 9, "name": "created"},
+					"action": {"id": 1, "status": "success"},
+					"next_actions": [{"id": 2, "status": "success"}]}`)
+			case strings.HasSuffix(request.URL.Path, "/actions/attach"),
+				strings.HasSuffix(request.URL.Path, "/actions/detach"):
+				writeJSON(t, writer, `{"action": {"id": 3, "status": "success"}}`)
+			case request.Method == http.MethodDelete:
+				writeJSON(t, writer, `{"action": {"id": 4, "status": "success"}}`)
+			case request.Method == http.MethodGet && strings.HasPrefix(request.URL.Path, "/volumes/"):
+				writeJSON(t, writer, `{"volume": {"id": 9, "name": "cache",
+					"labels": {"managed-by": "blackbsd-builder"}}}`)
+			}
+		}))
+	t.Cleanup(testServer.Close)
+
+	return bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL)), &calls, &created
+}
+
+func volumeTestServer() *hcloudsdk.Server {
+	var location hcloudsdk.Location
+	location.Name = "fsn1"
+
+	var server hcloudsdk.Server
+	server.ID = 42
+	server.Name = "blackbsd-builder-b1"
+	server.Location = &location
+	return &server
+}
+
+func TestAttachCacheVolume(t *testing.T) {
+	t.Parallel()
+
+	t.Run("creates cache volume on first use", func(t *testing.T) {
+		t.Parallel()
+
+		client, _, created := volumeAPI(t, `{"volumes": []}`)
+
+		volume, err := client.AttachCacheVolume(context.Background(), volumeTestServer(), 20)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(9), volume.ID)
+		assert.Equal(t, "blackbsd-cache-fsn1", created.Name)
+		assert.Equal(t, int64(42), created.Server)
+		assert.Equal(t, 20, created.Size)
+		assert.Equal(t, bsdhcloud.RoleCache, created.Labels[bsdhcloud.RoleLabelKey])
+		assert.Equal(t, "blackbsd-builder", created.Labels["managed-by"])
+		assert.NotContains(t, created.Labels, bsdhcloud.ExpiresAtLabelKey)
+	})
+
+	t.Run("attaches existing detached volume", func(t *testing.T) {
+		t.Parallel()
+
+		client, calls, _ := volumeAPI(t, `{"volumes": [{"id": 5, "name": "blackbsd-cache-fsn1"}]}`)
+
+		volume, err := client.AttachCacheVolume(context.Background(), volumeTestServer(), 20)
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), volume.ID)
+		assert.Contains(t, *calls, "POST /volumes/5/actions/attach")
+	})
+
+	t.Run("refuses volume attached elsewhere", func(t *testing.T) {
+		t.Parallel()
+
+		client, _, _ := volumeAPI(t, `{"volumes": [{"id": 5, "name": "blackbsd-cache-fsn1", "server": 7}]}`)
+
+		_, err := client.AttachCacheVolume(context.Background(), volumeTestServer(), 20)
+
+		require.ErrorIs(t, err, bsdhcloud.ErrVolumeInUse)
+	})
+}
+
+func TestCreateArtifactsVolume(t *testing.T) {
+	t.Parallel()
+
+	client, _, created := volumeAPI(t, `{"volumes": []}`)
+	labels := bsdhcloud.BuildLabels("b1")
+
+	_, err := client.CreateArtifactsVolume(context.Background(), volumeTestServer(), labels, 50)
+
+	require.NoError(t, err)
+	assert.Equal(t, "blackbsd-builder-b1-artifacts", created.Name)
+	assert.Equal(t, bsdhcloud.RoleArtifacts, created.Labels[bsdhcloud.RoleLabelKey])
+	assert.Equal(t, "b1", created.Labels[bsdhcloud.BuildIDLabelKey])
+	assert.NotContains(t, labels, bsdhcloud.RoleLabelKey)
+}
+
+func TestTeardownDetachesCreatedVolumes(t *testing.T) {
+	t.Parallel()
+
+	client, calls, _ := volumeAPI(t, `{"volumes": []}`)
+	server := volumeTestServer()
+
+	_, err := client.CreateArtifactsVolume(context.Background(), server, bsdhcloud.BuildLabels("b1"), 20)
+	require.NoError(t, err)
+	_, err = client.TeardownServer(context.Background(), server)
+
+	require.NoError(t, err)
+	assert.Contains(t, *calls, "POST /volumes/9/actions/detach")
+}
+
+func TestTeardownDetachesManagedVolumes(t *testing.T) {
+	t.Parallel()
+
+	client, calls, _ := volumeAPI(t, `{"volumes": []}`)
+
+	var volume hcloudsdk.Volume
+	volume.ID = 9
+	server := volumeTestServer()
+	server.Volumes = []*hcloudsdk.Volume{&volume}
+
+	_, err := client.TeardownServer(context.Background(), server)
+
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(*calls), 2)
+	assert.Equal(t, "POST /volumes/9/actions/detach", (*calls)[1])
+}
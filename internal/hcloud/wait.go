@@ -11,29 +11,110 @@ import (
 )
 
 const (
-	// waitForStatusTimeout is the maximum time to wait for a server status change.
-	waitForStatusTimeout = 10 * time.Minute
+	// DefaultServerStatusTimeout is how long WaitForServerStatus waits unless
+	// WithWaitTimeout says otherwise. Actions wait as long as ctx allows.
+	DefaultServerStatusTimeout = 10 * time.Minute
+
+	// PowerOffTimeout bounds the wait for a powered off server to report
+	// off. The power off is a hard one, so this takes seconds, not minutes.
+	PowerOffTimeout = 2 * time.Minute
+
+	progressAction = "action"
+	progressServer = "server"
 )
 
-// WaitForAction waits until the given action completes.
-func (c *Client) WaitForAction(ctx context.Context, action *hcloud.Action) error {
-	if err := c.api.Action.WaitFor(ctx, action); err != nil {
+// Progress is an update observed while waiting: an action's status and
+// completion percentage, or a server's status on its way to the target.
+type Progress struct {
+	Resource string
+	Command  string
+	Status   string
+	ID       int64
+	Percent  int
+}
+
+// ProgressFunc receives wait progress. It is called from the waiting goroutine.
+type ProgressFunc func(Progress)
+
+// WaitOption configures a single wait.
+type WaitOption func(*waitOpts)
+
+type waitOpts struct {
+	timeout time.Duration
+}
+
+// WithWaitTimeout bounds a wait; zero keeps the default.
+func WithWaitTimeout(timeout time.Duration) WaitOption {
+	return func(opts *waitOpts) {
+		opts.timeout = timeout
+	}
+}
+
+// WithProgress sets the callback that receives the progress of every wait the
+// client performs.
+func (c *Client) WithProgress(fn ProgressFunc) *Client {
+	c.progress = fn
+	return c
+}
+
+// WaitForAction waits until the given action completes, reporting its status
+// and progress as they change. A failed action yields an *ActionError.
+func (c *Client) WaitForAction(ctx context.Context, action *hcloud.Action, opts ...WaitOption) error {
+	waitCfg := c.waitOptions(0, opts)
+	if waitCfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitCfg.timeout)
+		defer cancel()
+	}
+
+	var last Progress
+	handleUpdate := func(update *hcloud.Action) error {
+		current := Progress{
+			Resource: progressAction,
+			Command:  update.Command,
+			Status:   string(update.Status),
+			ID:       update.ID,
+			Percent:  update.Progress,
+		}
+		if current != last {
+			last = current
+			c.report(current)
+		}
+
+		if update.Status == hcloud.ActionStatusError {
+			return &ActionError{
+				Command: update.Command,
+				Code:    update.ErrorCode,
+				Message: update.ErrorMessage,
+				ID:      update.ID,
+			}
+		}
+		return nil
+	}
+
+	if err := c.api.Action.WaitForFunc(ctx, handleUpdate, action); err != nil {
 		return fmt.Errorf("wait for action %d: %w", action.ID, err)
 	}
 
-	slog.Info("action completed", "id", action.ID)
+	slog.Info("action completed", "id", action.ID, "command", last.Command)
 	return nil
 }
 
-// WaitForServerStatus polls until the server reaches the target status.
+// WaitForServerStatus polls until the server reaches the target status,
+// reporting each status it passes through. It gives up after
+// DefaultServerStatusTimeout unless WithWaitTimeout says otherwise.
 func (c *Client) WaitForServerStatus(
 	ctx context.Context,
 	serverID int64,
 	target hcloud.ServerStatus,
+	opts ...WaitOption,
 ) error {
+	waitCfg := c.waitOptions(DefaultServerStatusTimeout, opts)
+
 	expBackoff := backoff.NewExponentialBackOff()
-	expBackoff.MaxElapsedTime = waitForStatusTimeout
+	expBackoff.MaxElapsedTime = waitCfg.timeout
 
+	var last hcloud.ServerStatus
 	operation := func() error {
 		server, _, getErr := c.api.Server.GetByID(ctx, serverID)
 		if getErr != nil {
@@ -44,6 +125,17 @@ func (c *Client) WaitForServerStatus(
 			return backoff.Permanent(fmt.Errorf("server %d: not found", serverID))
 		}
 
+		if server.Status != last {
+			last = server.Status
+			c.report(Progress{
+				Resource: progressServer,
+				Command:  "",
+				Status:   string(server.Status),
+				ID:       serverID,
+				Percent:  0,
+			})
+		}
+
 		if server.Status != target {
 			return fmt.Errorf(
 				"server %d: status %s, want %s",
@@ -61,3 +153,25 @@ func (c *Client) WaitForServerStatus(
 	slog.Info("server reached target status", "id", serverID, "status", target)
 	return nil
 }
+
+func (c *Client) waitOptions(timeout time.Duration, opts []WaitOption) waitOpts {
+	waitCfg := waitOpts{timeout: 0}
+	for _, opt := range opts {
+		opt(&waitCfg)
+	}
+
+	if waitCfg.timeout == 0 {
+		waitCfg.timeout = timeout
+	}
+	return waitCfg
+}
+
+// report logs progress at debug level, as waits poll often, and forwards it
+// to the client's progress callback when set.
+func (c *Client) report(progress Progress) {
+	slog.Debug("wait progress", "resource", progress.Resource, "id", progress.ID,
+		"command", progress.Command, "status", progress.Status, "progress", progress.Percent)
+	if c.progress != nil {
+		c.progress(progress)
+	}
+}
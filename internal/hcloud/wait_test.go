@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
 	bsdhcloud "github.com/omarluq/hetzner-blackbsd/internal/hcloud"
@@ -64,6 +66,49 @@ func TestWaitForAction(t *testing.T) {
 		err := client.WaitForAction(context.Background(), &action)
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "wait for action 1")
+
+		var actionErr *bsdhcloud.ActionError
+		require.ErrorAs(t, err, &actionErr)
+		assert.Equal(t, "action_failed", actionErr.Code)
+		assert.Equal(t, "boom", actionErr.Message)
+		assert.Contains(t, err.Error(), "action_failed: boom")
+	})
+
+	t.Run("reports progress changes", func(t *testing.T) {
+		t.Parallel()
+
+		var polls atomic.Int32
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				if polls.Add(1) == 1 {
+					writeJSON(t, writer, `{"actions": [{"id": 1, "command": "create_image",
+						"status": "running", "progress": 40}]}`)
+					return
+				}
+				writeJSON(t, writer, `{"actions": [{"id": 1, "command": "create_image",
+					"status": "success", "progress": 100}]}`)
+			}))
+		defer testServer.Close()
+
+		var updates []bsdhcloud.Progress
+		client := bsdhcloud.NewClientWithOpts(
+			hcloudsdk.WithEndpoint(testServer.URL),
+			hcloudsdk.WithPollOpts(hcloudsdk.PollOpts{BackoffFunc: hcloudsdk.ConstantBackoff(time.Millisecond)}),
+		).WithProgress(func(progress bsdhcloud.Progress) {
+			updates = append(updates, progress)
+		})
+
+		var action hcloudsdk.Action
+		action.ID = 1
+		action.Status = hcloudsdk.ActionStatusRunning
+
+		require.NoError(t, client.WaitForAction(context.Background(), &action))
+		require.Len(t, updates, 2)
+		assert.Equal(t, "create_image", updates[0].Command)
+		assert.Equal(t, 40, updates[0].Percent)
+		assert.Equal(t, "success", updates[1].Status)
+		assert.Equal(t, 100, updates[1].Percent)
 	})
 }
 
@@ -88,6 +133,30 @@ func TestWaitForServerStatus(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("reports status transitions until the timeout", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(
+			func(writer http.ResponseWriter, _ *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				writeJSON(t, writer, `{"server": {"id": 42, "status": "starting"}}`)
+			}))
+		defer testServer.Close()
+
+		var statuses []string
+		client := bsdhcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL)).
+			WithProgress(func(progress bsdhcloud.Progress) {
+				statuses = append(statuses, progress.Status)
+			})
+
+		err := client.WaitForServerStatus(
+			context.Background(), 42, hcloudsdk.ServerStatusRunning,
+			bsdhcloud.WithWaitTimeout(100*time.Millisecond),
+		)
+		require.Error(t, err)
+		assert.Equal(t, []string{"starting"}, statuses)
+	})
+
 	t.Run("returns error for missing server", func(t *testing.T) {
 		t.Parallel()
 
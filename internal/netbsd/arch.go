@@ -0,0 +1,52 @@
+package netbsd
+
+import "fmt"
+
+const (
+	// ArchAMD64 is the NetBSD port for x86-64 servers (Hetzner CX/CPX/CCX).
+	ArchAMD64 = "amd64"
+
+	// ArchAArch64 is the NetBSD port for 64-bit ARM servers (Hetzner CAX).
+	ArchAArch64 = "evbarm-aarch64"
+
+	// ServerArchX86 and ServerArchARM are the Hetzner server type architectures.
+	ServerArchX86 = "x86"
+	ServerArchARM = "arm"
+)
+
+// ServerArch returns the Hetzner server architecture a NetBSD port runs on.
+func ServerArch(arch string) string {
+	if arch == ArchAArch64 {
+		return ServerArchARM
+	}
+	return ServerArchX86
+}
+
+// VolumeDevice returns the raw-partition device of the Hetzner volume
+// attached index-th, counting from 0, on a booted NetBSD host. Volumes show up
+// as SCSI disks in attach order after the root disk sd0, so the first one is
+// sd1; the whole-disk partition is d on amd64 and c on evbarm.
+func VolumeDevice(arch string, index int) string {
+	partition := "d"
+	if arch == ArchAArch64 {
+		partition = "c"
+	}
+	return fmt.Sprintf("/dev/sd%d%s", index+1, partition)
+}
+
+// Layout describes the partitions of an installed NetBSD disk. Partition
+// numbers are 1-based; EFIPartition is 0 when the disk boots via BIOS.
+type Layout struct {
+	RootPartition int
+	EFIPartition  int
+}
+
+// LayoutFor returns the disk layout produced by installing the given port.
+// The evbarm arm64.img carries a FAT EFI system partition ahead of the root
+// filesystem; the amd64 installer puts NetBSD in the first MBR partition.
+func LayoutFor(arch string) Layout {
+	if arch == ArchAArch64 {
+		return Layout{RootPartition: 2, EFIPartition: 1}
+	}
+	return Layout{RootPartition: 1, EFIPartition: 0}
+}
@@ -3,21 +3,59 @@ package netbsd
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
 	"time"
 
 	"github.com/omarluq/hetzner-blackbsd/internal/runner"
 	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
 )
 
-const qemuTimeout = 15 * time.Minute
+const (
+	qemuTimeout = 15 * time.Minute
 
-// Installer automates NetBSD installation by downloading the ISO and running
-// QEMU with KVM acceleration inside Hetzner rescue mode.
+	// InstallStage names the stage log the QEMU console output is written to.
+	InstallStage = "install"
+
+	// layoutHashLength is the number of hex characters kept from the layout digest.
+	layoutHashLength = 12
+
+	// aavmfFirmware is the UEFI firmware for QEMU's aarch64 virt machine,
+	// shipped by Debian's qemu-efi-aarch64 package.
+	aavmfFirmware = "/usr/share/AAVMF/AAVMF_CODE.fd"
+
+	// loginTimeout bounds the first boot of the aarch64 image up to its login
+	// prompt, which includes growing the root filesystem to the disk.
+	loginTimeout = 10 * time.Minute
+)
+
+// errNoConsole is returned when the aarch64 first boot is asked of a runner
+// that cannot drive the QEMU serial console.
+var errNoConsole = errors.New("runner cannot drive an interactive console")
+
+// firstBootScript logs in to the freshly booted aarch64 image as root, which
+// has no password yet, and powers it off so QEMU exits.
+var firstBootScript = []ssh.Step{
+	{Expect: regexp.MustCompile(`login: *$`), Send: "root\n", Timeout: loginTimeout},
+	{Expect: regexp.MustCompile(`# *$`), Send: "shutdown -p now\n", Timeout: 0},
+}
+
+// Installer automates NetBSD installation by downloading the install media and
+// running QEMU with KVM acceleration inside Hetzner rescue mode. amd64 boots the
+// installer ISO; evbarm-aarch64 needs no installer, so the prebuilt arm64.img is
+// written to the disk and booted once under qemu-system-aarch64 with UEFI
+// firmware, where it grows its root filesystem and finishes its first-boot
+// setup before powering off.
 type Installer struct {
 	runner  runner.Runner
 	version string
 	arch    string
+	logDir  string
 }
 
 // New creates an Installer for the given NetBSD version and architecture.
@@ -26,11 +64,28 @@ func New(exec runner.Runner, version, arch string) *Installer {
 		runner:  exec,
 		version: version,
 		arch:    arch,
+		logDir:  "",
 	}
 }
 
-// ISODownloadURL returns the CDN URL for the NetBSD serial-console boot ISO.
+// WithLogDir tees the QEMU console output of InstallViaQEMU to
+// <dir>/install.log as it runs.
+func (inst *Installer) WithLogDir(dir string) *Installer {
+	inst.logDir = dir
+	return inst
+}
+
+// ISODownloadURL returns the CDN URL of the install media: the serial-console
+// boot ISO, or the gzipped arm64.img for evbarm-aarch64.
 func (inst *Installer) ISODownloadURL() string {
+	if inst.arch == ArchAArch64 {
+		return fmt.Sprintf(
+			"https://cdn.netbsd.org/pub/NetBSD/NetBSD-%s/%s/binary/gzimg/arm64.img.gz",
+			inst.version,
+			inst.arch,
+		)
+	}
+
 	return fmt.Sprintf(
 		"https://cdn.netbsd.org/pub/NetBSD/NetBSD-%s/%s/installation/cdrom/boot-com.iso",
 		inst.version,
@@ -38,10 +93,10 @@ func (inst *Installer) ISODownloadURL() string {
 	)
 }
 
-// DownloadISO fetches the NetBSD boot ISO to the given directory on the remote host.
+// DownloadISO fetches the install media to the given directory on the remote host.
 // It returns the remote path of the downloaded file.
 func (inst *Installer) DownloadISO(ctx context.Context, destDir string) (string, error) {
-	isoPath := fmt.Sprintf("%s/netbsd-%s-%s.iso", destDir, inst.version, inst.arch)
+	isoPath := fmt.Sprintf("%s/%s", destDir, inst.mediaName())
 	cmd := fmt.Sprintf("wget -O %s %s",
 		ssh.EscapeShellArg(isoPath),
 		ssh.EscapeShellArg(inst.ISODownloadURL()))
@@ -58,19 +113,73 @@ func (inst *Installer) DownloadISO(ctx context.Context, destDir string) (string,
 	return isoPath, nil
 }
 
-// InstallViaQEMU runs QEMU with KVM to boot the ISO and install NetBSD onto the target device.
-func (inst *Installer) InstallViaQEMU(ctx context.Context, isoPath, device string) error {
-	cmd := fmt.Sprintf(
-		"qemu-system-x86_64 -enable-kvm -m 4G -smp 4 -cdrom %s -boot d "+
-			"-drive file=%s,format=raw -nographic -serial mon:stdio",
+// EnsureISO returns the install media in destDir, downloading it only when it
+// is not already there. destDir is meant to be a persistent cache, so the
+// download goes to a temporary name first and a failed transfer never leaves
+// a truncated file behind to be reused.
+func (inst *Installer) EnsureISO(ctx context.Context, destDir string) (string, error) {
+	isoPath := fmt.Sprintf("%s/%s", destDir, inst.mediaName())
+	partPath := isoPath + ".part"
+	cmd := fmt.Sprintf("mkdir -p %s && (test -s %s || (wget -O %s %s && mv %s %s))",
+		ssh.EscapeShellArg(destDir),
 		ssh.EscapeShellArg(isoPath),
-		ssh.EscapeShellArg(device),
-	)
+		ssh.EscapeShellArg(partPath),
+		ssh.EscapeShellArg(inst.ISODownloadURL()),
+		ssh.EscapeShellArg(partPath),
+		ssh.EscapeShellArg(isoPath))
+
+	result, err := inst.runner.Exec(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("ensure iso: %w", err)
+	}
+
+	if !result.Success() {
+		return "", fmt.Errorf("ensure iso: exit code %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	return isoPath, nil
+}
 
+// LayoutHash returns a short digest of everything that determines the installed
+// disk contents for the target device. Two installs with the same version, arch
+// and layout hash produce identical disks, so the result can key a base snapshot.
+func (inst *Installer) LayoutHash(device string) string {
+	isoPath := inst.mediaName()
+	layout := inst.ISODownloadURL() + "\n" + inst.qemuCommand(isoPath, device)
+	if inst.arch == ArchAArch64 {
+		layout += "\n" + writeImageCommand(isoPath, device)
+	}
+	digest := sha256.Sum256([]byte(layout))
+	return hex.EncodeToString(digest[:])[:layoutHashLength]
+}
+
+// InstallViaQEMU runs QEMU with KVM to boot the ISO and install NetBSD onto the
+// target device. For evbarm-aarch64 it writes the image to the device and
+// boots it once, which needs a runner.Interactive to log in on the serial
+// console and power the image off. The console output is logged line by line
+// while the installer runs.
+func (inst *Installer) InstallViaQEMU(ctx context.Context, isoPath, device string) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, qemuTimeout)
 	defer cancel()
 
-	result, err := inst.runner.Exec(timeoutCtx, cmd)
+	if inst.arch == ArchAArch64 {
+		return inst.firstBoot(timeoutCtx, isoPath, device)
+	}
+
+	var opts ssh.StreamOpts
+	opts.OnStdout = func(line string) { slog.Info("qemu console", "line", line) }
+	opts.OnStderr = func(line string) { slog.Warn("qemu stderr", "line", line) }
+
+	if inst.logDir != "" {
+		logFile, err := runner.OpenStageLog(inst.logDir, InstallStage)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = logFile.Close() }()
+		opts.Log = logFile
+	}
+
+	result, err := runner.Stream(timeoutCtx, inst.runner, inst.qemuCommand(isoPath, device), opts)
 	if err != nil {
 		return fmt.Errorf("run qemu install: %w", err)
 	}
@@ -81,3 +190,86 @@ func (inst *Installer) InstallViaQEMU(ctx context.Context, isoPath, device strin
 
 	return nil
 }
+
+// firstBoot writes the gzipped aarch64 image to device and boots it under
+// qemu-system-aarch64, installing QEMU and the AAVMF firmware in rescue first
+// when they are missing. The console transcript goes to the install log.
+func (inst *Installer) firstBoot(ctx context.Context, imagePath, device string) error {
+	console, ok := inst.runner.(runner.Interactive)
+	if !ok {
+		return fmt.Errorf("run qemu install: %w", errNoConsole)
+	}
+
+	for _, cmd := range []string{qemuPackagesCommand(), writeImageCommand(imagePath, device)} {
+		result, err := console.Exec(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("prepare qemu install: %w", err)
+		}
+		if !result.Success() {
+			return fmt.Errorf("prepare qemu install: exit code %d: %s", result.ExitCode, result.Stderr)
+		}
+	}
+
+	var transcript io.Writer
+	if inst.logDir != "" {
+		logFile, err := runner.OpenStageLog(inst.logDir, InstallStage)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = logFile.Close() }()
+		transcript = logFile
+	}
+
+	slog.Info("booting aarch64 image under qemu", "device", device)
+	result, err := console.ExecExpect(ctx, inst.qemuCommand(imagePath, device), firstBootScript, transcript)
+	if err != nil {
+		return fmt.Errorf("run qemu install: %w", err)
+	}
+
+	if !result.Success() {
+		return fmt.Errorf("run qemu install: exit code %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	return nil
+}
+
+func (inst *Installer) mediaName() string {
+	if inst.arch == ArchAArch64 {
+		return fmt.Sprintf("netbsd-%s-%s.img.gz", inst.version, inst.arch)
+	}
+	return fmt.Sprintf("netbsd-%s-%s.iso", inst.version, inst.arch)
+}
+
+func (inst *Installer) qemuCommand(isoPath, device string) string {
+	if inst.arch == ArchAArch64 {
+		return fmt.Sprintf(
+			"qemu-system-aarch64 -M virt -cpu host -enable-kvm -m 4G -smp 4 "+
+				"-drive if=pflash,format=raw,readonly=on,file=%s "+
+				"-drive file=%s,format=raw,if=virtio -nographic -serial mon:stdio",
+			aavmfFirmware,
+			ssh.EscapeShellArg(device),
+		)
+	}
+
+	return fmt.Sprintf(
+		"qemu-system-x86_64 -enable-kvm -m 4G -smp 4 -cdrom %s -boot d "+
+			"-drive file=%s,format=raw -nographic -serial mon:stdio",
+		ssh.EscapeShellArg(isoPath),
+		ssh.EscapeShellArg(device),
+	)
+}
+
+// qemuPackagesCommand installs qemu-system-aarch64 and the AAVMF firmware in
+// the Debian rescue system unless they are already there.
+func qemuPackagesCommand() string {
+	return fmt.Sprintf("(command -v qemu-system-aarch64 >/dev/null && test -f %s) || "+
+		"(apt-get update -q && DEBIAN_FRONTEND=noninteractive apt-get install -y -q qemu-system-arm qemu-efi-aarch64)",
+		aavmfFirmware)
+}
+
+func writeImageCommand(imagePath, device string) string {
+	return fmt.Sprintf("gunzip -c %s | dd of=%s bs=4M conv=fsync",
+		ssh.EscapeShellArg(imagePath),
+		ssh.EscapeShellArg(device),
+	)
+}
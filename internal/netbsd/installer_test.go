@@ -3,6 +3,9 @@ package netbsd_test
 
 import (
 	"context"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/omarluq/hetzner-blackbsd/internal/netbsd"
@@ -34,6 +37,29 @@ func (mock *mockRunner) Exec(_ context.Context, command string) (ssh.CommandResu
 	return ssh.CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, nil
 }
 
+// consoleRunner is a mockRunner that can also drive an interactive console. It
+// records the expect script and writes a login prompt to the transcript.
+type consoleRunner struct {
+	*mockRunner
+
+	command string
+	script  []ssh.Step
+}
+
+func (console *consoleRunner) ExecExpect(
+	_ context.Context,
+	command string,
+	script []ssh.Step,
+	transcript io.Writer,
+) (ssh.CommandResult, error) {
+	console.command = command
+	console.script = script
+	if transcript != nil {
+		_, _ = io.WriteString(transcript, "login: ")
+	}
+	return okResult(), nil
+}
+
 func okResult() ssh.CommandResult {
 	return ssh.CommandResult{Stdout: "", Stderr: "", ExitCode: 0}
 }
@@ -95,6 +121,12 @@ func TestISODownloadURL(t *testing.T) {
 			arch:     "amd64",
 			expected: "https://cdn.netbsd.org/pub/NetBSD/NetBSD-9.3/amd64/installation/cdrom/boot-com.iso",
 		},
+		{
+			name:     "10.1 evbarm-aarch64",
+			version:  "10.1",
+			arch:     "evbarm-aarch64",
+			expected: "https://cdn.netbsd.org/pub/NetBSD/NetBSD-10.1/evbarm-aarch64/binary/gzimg/arm64.img.gz",
+		},
 	}
 
 	for _, tt := range tests {
@@ -141,6 +173,21 @@ func TestDownloadISO(t *testing.T) {
 		assert.Equal(t, "/var/tmp/netbsd-10.0-amd64.iso", path)
 	})
 
+	t.Run("downloads arm64 image for aarch64", func(t *testing.T) {
+		t.Parallel()
+
+		wgetCmd := "wget -O '/tmp/netbsd-10.1-evbarm-aarch64.img.gz' " +
+			"'https://cdn.netbsd.org/pub/NetBSD/NetBSD-10.1/evbarm-aarch64/binary/gzimg/arm64.img.gz'"
+		mock := newMock(map[string]ssh.CommandResult{wgetCmd: okResult()})
+		installer := netbsd.New(mock, "10.1", netbsd.ArchAArch64)
+
+		path, err := installer.DownloadISO(context.Background(), "/tmp")
+
+		require.NoError(t, err)
+		assert.Equal(t, "/tmp/netbsd-10.1-evbarm-aarch64.img.gz", path)
+		assert.Equal(t, wgetCmd, mock.lastCommand)
+	})
+
 	t.Run("returns error on wget failure", func(t *testing.T) {
 		t.Parallel()
 
@@ -204,6 +251,61 @@ func TestInstallViaQEMU(t *testing.T) {
 		assert.Contains(t, mock.lastCommand, "file='/dev/nvme0n1',format=raw")
 	})
 
+	t.Run("tees console output to the install log", func(t *testing.T) {
+		t.Parallel()
+
+		qemuCmd := "qemu-system-x86_64 -enable-kvm -m 4G -smp 4" +
+			" -cdrom '/tmp/iso.iso' -boot d -drive file='/dev/sda',format=raw" +
+			" -nographic -serial mon:stdio"
+		result := ssh.CommandResult{Stdout: "sysinst: installation complete\n", Stderr: "", ExitCode: 0}
+		mock := newMock(map[string]ssh.CommandResult{qemuCmd: result})
+		logDir := filepath.Join(t.TempDir(), "logs")
+		installer := netbsd.New(mock, "10.1", "amd64").WithLogDir(logDir)
+
+		require.NoError(t, installer.InstallViaQEMU(context.Background(), "/tmp/iso.iso", "/dev/sda"))
+
+		data, err := os.ReadFile(filepath.Join(logDir, netbsd.InstallStage+".log"))
+		require.NoError(t, err)
+		assert.Equal(t, "sysinst: installation complete\n", string(data))
+	})
+
+	t.Run("writes the aarch64 image and boots it once under qemu", func(t *testing.T) {
+		t.Parallel()
+
+		console := &consoleRunner{mockRunner: newMock(nil), script: nil, command: ""}
+		logDir := filepath.Join(t.TempDir(), "logs")
+		installer := netbsd.New(console, "10.1", netbsd.ArchAArch64).WithLogDir(logDir)
+
+		require.NoError(t, installer.InstallViaQEMU(context.Background(), "/tmp/arm64.img.gz", "/dev/sda"))
+
+		require.Len(t, console.commands, 2)
+		assert.Contains(t, console.commands[0], "apt-get install -y -q qemu-system-arm qemu-efi-aarch64")
+		assert.Equal(t, "gunzip -c '/tmp/arm64.img.gz' | dd of='/dev/sda' bs=4M conv=fsync", console.commands[1])
+		assert.Equal(t, "qemu-system-aarch64 -M virt -cpu host -enable-kvm -m 4G -smp 4"+
+			" -drive if=pflash,format=raw,readonly=on,file=/usr/share/AAVMF/AAVMF_CODE.fd"+
+			" -drive file='/dev/sda',format=raw,if=virtio -nographic -serial mon:stdio", console.command)
+		require.Len(t, console.script, 2)
+		assert.Equal(t, "root\n", console.script[0].Send)
+		assert.Equal(t, "shutdown -p now\n", console.script[1].Send)
+
+		data, err := os.ReadFile(filepath.Join(logDir, netbsd.InstallStage+".log"))
+		require.NoError(t, err)
+		assert.Equal(t, "login: ", string(data))
+	})
+
+	t.Run("needs a console to boot the aarch64 image", func(t *testing.T) {
+		t.Parallel()
+
+		mock := newMock(nil)
+		installer := netbsd.New(mock, "10.1", netbsd.ArchAArch64)
+
+		err := installer.InstallViaQEMU(context.Background(), "/tmp/arm64.img.gz", "/dev/sda")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "run qemu install")
+		assert.Empty(t, mock.commands)
+	})
+
 	t.Run("returns error on qemu failure", func(t *testing.T) {
 		t.Parallel()
 
@@ -230,3 +332,72 @@ func TestInstallViaQEMU(t *testing.T) {
 		assert.Contains(t, err.Error(), "run qemu install")
 	})
 }
+
+func TestLayoutHash(t *testing.T) {
+	t.Parallel()
+
+	t.Run("is stable for identical inputs", func(t *testing.T) {
+		t.Parallel()
+
+		first := netbsd.New(newMock(nil), "10.1", "amd64").LayoutHash("/dev/sda")
+		second := netbsd.New(newMock(nil), "10.1", "amd64").LayoutHash("/dev/sda")
+
+		assert.Equal(t, first, second)
+		assert.Len(t, first, 12)
+	})
+
+	t.Run("changes with version and device", func(t *testing.T) {
+		t.Parallel()
+
+		base := netbsd.New(newMock(nil), "10.1", "amd64").LayoutHash("/dev/sda")
+
+		assert.NotEqual(t, base, netbsd.New(newMock(nil), "10.0", "amd64").LayoutHash("/dev/sda"))
+		assert.NotEqual(t, base, netbsd.New(newMock(nil), "10.1", "amd64").LayoutHash("/dev/nvme0n1"))
+		assert.NotEqual(t, base, netbsd.New(newMock(nil), "10.1", netbsd.ArchAArch64).LayoutHash("/dev/sda"))
+	})
+}
+
+func TestArch(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, netbsd.ServerArchX86, netbsd.ServerArch(netbsd.ArchAMD64))
+	assert.Equal(t, netbsd.ServerArchARM, netbsd.ServerArch(netbsd.ArchAArch64))
+
+	assert.Equal(t, netbsd.Layout{RootPartition: 1, EFIPartition: 0}, netbsd.LayoutFor(netbsd.ArchAMD64))
+	assert.Equal(t, netbsd.Layout{RootPartition: 2, EFIPartition: 1}, netbsd.LayoutFor(netbsd.ArchAArch64))
+
+	assert.Equal(t, "/dev/sd1d", netbsd.VolumeDevice(netbsd.ArchAMD64, 0))
+	assert.Equal(t, "/dev/sd2c", netbsd.VolumeDevice(netbsd.ArchAArch64, 1))
+}
+
+func TestEnsureISO(t *testing.T) {
+	t.Parallel()
+
+	ensureCmd := "mkdir -p '/mnt/cache/iso' && (test -s '/mnt/cache/iso/netbsd-10.1-amd64.iso' || " +
+		"(wget -O '/mnt/cache/iso/netbsd-10.1-amd64.iso.part' " +
+		"'https://cdn.netbsd.org/pub/NetBSD/NetBSD-10.1/amd64/installation/cdrom/boot-com.iso' && " +
+		"mv '/mnt/cache/iso/netbsd-10.1-amd64.iso.part' '/mnt/cache/iso/netbsd-10.1-amd64.iso'))"
+
+	t.Run("downloads only when missing", func(t *testing.T) {
+		t.Parallel()
+
+		mock := newMock(map[string]ssh.CommandResult{ensureCmd: okResult()})
+
+		path, err := netbsd.New(mock, "10.1", "amd64").EnsureISO(context.Background(), "/mnt/cache/iso")
+
+		require.NoError(t, err)
+		assert.Equal(t, "/mnt/cache/iso/netbsd-10.1-amd64.iso", path)
+		assert.Equal(t, ensureCmd, mock.lastCommand)
+	})
+
+	t.Run("returns error on download failure", func(t *testing.T) {
+		t.Parallel()
+
+		mock := newMock(map[string]ssh.CommandResult{ensureCmd: errResult("404 Not Found")})
+
+		_, err := netbsd.New(mock, "10.1", "amd64").EnsureISO(context.Background(), "/mnt/cache/iso")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ensure iso")
+	})
+}
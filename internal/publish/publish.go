@@ -0,0 +1,110 @@
+// Package publish turns a finished build server into a reusable Hetzner snapshot.
+package publish
+
+import (
+	"context"
+	"log/slog"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/customize"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+// Opts configures a Publish run. HostKey, when set, is installed as the
+// image's ed25519 host key and kept in the snapshot; otherwise every server
+// created from the image generates its own host keys. Keep is the number of
+// image snapshots retained per version and arch; 0 keeps them all.
+type Opts struct {
+	HostKey  *ssh.KeyPair
+	BuildID  string
+	Checksum string
+	Keep     int
+}
+
+// Publisher snapshots finished BlackBSD build servers.
+type Publisher struct {
+	client  *hcloud.Client
+	version string
+	arch    string
+}
+
+// New creates a Publisher for images of the given NetBSD version and architecture.
+func New(client *hcloud.Client, version, arch string) *Publisher {
+	return &Publisher{
+		client:  client,
+		version: version,
+		arch:    arch,
+	}
+}
+
+// Publish installs opts.HostKey, when set, and cleans per-host state off the
+// server through exec, then powers it off and snapshots its disk as a
+// labelled BlackBSD image. It must run before the server is destroyed. Older
+// images beyond opts.Keep are pruned afterwards; a failed prune is logged
+// rather than failing the publish.
+func (p *Publisher) Publish(
+	ctx context.Context,
+	exec runner.Runner,
+	server *hcloudsdk.Server,
+	opts *Opts,
+) (*hcloudsdk.Image, error) {
+	customizer := customize.New(exec)
+	if opts.HostKey != nil {
+		if err := customizer.InstallHostKey(ctx, opts.HostKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := customizer.PrepareSnapshot(ctx, opts.HostKey != nil); err != nil {
+		return nil, err
+	}
+
+	if err := p.client.PowerOffServer(ctx, server); err != nil {
+		return nil, err
+	}
+
+	err := p.client.WaitForServerStatus(ctx, server.ID, hcloudsdk.ServerStatusOff,
+		hcloud.WithWaitTimeout(hcloud.PowerOffTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := p.client.PublishImage(ctx, server, hcloud.ImageMeta{
+		Version:  p.version,
+		Arch:     p.arch,
+		BuildID:  opts.BuildID,
+		Checksum: opts.Checksum,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Keep > 0 {
+		if _, pruneErr := p.Prune(ctx, opts.Keep); pruneErr != nil {
+			slog.Warn("image snapshot prune failed", "error", pruneErr)
+		}
+	}
+
+	return image, nil
+}
+
+// Prune deletes image snapshots beyond the newest keep per version and arch
+// and returns them.
+func (p *Publisher) Prune(ctx context.Context, keep int) ([]*hcloudsdk.Image, error) {
+	images, err := p.client.ListImageSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := hcloud.SnapshotsToPrune(images, keep)
+	for _, image := range pruned {
+		if _, delErr := p.client.DeleteImage(ctx, image); delErr != nil {
+			return nil, delErr
+		}
+	}
+
+	return pruned, nil
+}
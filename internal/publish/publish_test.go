@@ -0,0 +1,159 @@
+package publish_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hcloudsdk "github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/hcloud"
+	"github.com/omarluq/hetzner-blackbsd/internal/publish"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRunner struct {
+	err      error
+	commands []string
+}
+
+func (runner *mockRunner) Exec(_ context.Context, command string) (ssh.CommandResult, error) {
+	runner.commands = append(runner.commands, command)
+	return ssh.CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, runner.err
+}
+
+const imagesJSON = `{"images": [
+	{"id": 77, "type": "snapshot", "labels": {"blackbsd-netbsd-version": "10.1", "blackbsd-arch": "amd64"}},
+	{"id": 60, "type": "snapshot", "labels": {"blackbsd-netbsd-version": "10.1", "blackbsd-arch": "amd64"}},
+	{"id": 50, "type": "snapshot", "labels": {"blackbsd-netbsd-version": "10.1", "blackbsd-arch": "amd64"}}
+]}`
+
+// newAPI fakes the Hetzner endpoints a publish touches and records each call.
+func newAPI(t *testing.T) (*hcloud.Client, func() []string) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			mu.Lock()
+			calls = append(calls, request.Method+" "+request.URL.Path)
+			mu.Unlock()
+
+			writer.Header().Set("Content-Type", "application/json")
+			path := request.URL.Path
+			switch {
+			case strings.HasSuffix(path, "/actions/poweroff"):
+				writeJSON(t, writer, `{"action": {"id": 1, "status": "success"}}`)
+			case strings.HasSuffix(path, "/actions/create_image"):
+				writeJSON(t, writer, `{"image": {"id": 77, "type": "snapshot"},
+					"action": {"id": 2, "status": "success"}}`)
+			case strings.HasSuffix(path, "/servers/42"):
+				writeJSON(t, writer, `{"server": {"id": 42, "status": "off"}}`)
+			case request.Method == http.MethodDelete:
+				writer.WriteHeader(http.StatusNoContent)
+			case strings.HasSuffix(path, "/images"):
+				writeJSON(t, writer, imagesJSON)
+			}
+		}))
+	t.Cleanup(testServer.Close)
+
+	client := hcloud.NewClientWithOpts(hcloudsdk.WithEndpoint(testServer.URL))
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+func writeJSON(t *testing.T, writer http.ResponseWriter, data string) {
+	t.Helper()
+
+	_, writeErr := writer.Write([]byte(data))
+	require.NoError(t, writeErr)
+}
+
+func testServer() *hcloudsdk.Server {
+	var server hcloudsdk.Server
+	server.ID = 42
+	return &server
+}
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+
+	t.Run("cleans, snapshots and prunes", func(t *testing.T) {
+		t.Parallel()
+
+		client, calls := newAPI(t)
+		runner := &mockRunner{err: nil, commands: nil}
+
+		image, err := publish.New(client, "10.1", "amd64").Publish(context.Background(), runner, testServer(),
+			&publish.Opts{HostKey: nil, BuildID: "b1", Checksum: "abc123", Keep: 1})
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(77), image.ID)
+		require.Len(t, runner.commands, 1)
+		assert.Contains(t, runner.commands[0], "ssh_host_")
+
+		recorded := calls()
+		assert.Equal(t, "POST /servers/42/actions/poweroff", recorded[0])
+		assert.Contains(t, recorded, "POST /servers/42/actions/create_image")
+		assert.Contains(t, recorded, "DELETE /images/60")
+		assert.Contains(t, recorded, "DELETE /images/50")
+		assert.NotContains(t, recorded, "DELETE /images/77")
+	})
+
+	t.Run("installs and keeps the host key", func(t *testing.T) {
+		t.Parallel()
+
+		hostKey, err := ssh.GenerateKeyPair()
+		require.NoError(t, err)
+
+		client, _ := newAPI(t)
+		runner := &mockRunner{err: nil, commands: nil}
+
+		_, err = publish.New(client, "10.1", "amd64").Publish(context.Background(), runner, testServer(),
+			&publish.Opts{HostKey: hostKey, BuildID: "b1", Checksum: "", Keep: 0})
+
+		require.NoError(t, err)
+		require.Len(t, runner.commands, 2)
+		assert.Contains(t, runner.commands[0], hostKey.AuthorizedKey())
+		assert.Contains(t, runner.commands[1], "! -name 'ssh_host_ed25519_key*'")
+	})
+
+	t.Run("keep zero skips pruning", func(t *testing.T) {
+		t.Parallel()
+
+		client, calls := newAPI(t)
+
+		exec := &mockRunner{err: nil, commands: nil}
+		_, err := publish.New(client, "10.1", "amd64").Publish(context.Background(), exec, testServer(),
+			&publish.Opts{HostKey: nil, BuildID: "b1", Checksum: "", Keep: 0})
+
+		require.NoError(t, err)
+		for _, call := range calls() {
+			assert.NotContains(t, call, "/images")
+		}
+	})
+
+	t.Run("stops before snapshot when cleanup fails", func(t *testing.T) {
+		t.Parallel()
+
+		client, calls := newAPI(t)
+
+		exec := &mockRunner{err: assert.AnError, commands: nil}
+		_, err := publish.New(client, "10.1", "amd64").Publish(context.Background(), exec, testServer(),
+			&publish.Opts{HostKey: nil, BuildID: "b1", Checksum: "", Keep: 1})
+
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Empty(t, calls())
+	})
+}
@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+// RootUser is the login that needs no privilege escalation.
+const RootUser = "root"
+
+// Escalation names the tool that runs a command as root for a non-root login.
+type Escalation string
+
+const (
+	// EscalationDoas wraps commands in doas, the default on NetBSD.
+	EscalationDoas Escalation = "doas"
+
+	// EscalationSudo wraps commands in sudo.
+	EscalationSudo Escalation = "sudo"
+)
+
+// Wrap returns command prefixed to run as root. The command is passed to
+// sh -c as a single escaped argument, so redirections and pipes run with root
+// privileges too. The tool runs non-interactively and fails rather than
+// prompting for a password.
+func (e Escalation) Wrap(command string) string {
+	return fmt.Sprintf("%s -n sh -c %s", e, ssh.EscapeShellArg(command))
+}
+
+// Login is the user a phase is entered as and how it becomes root.
+type Login struct {
+	User       string
+	Escalation Escalation
+}
+
+// RootLogin logs in as root directly.
+func RootLogin() Login {
+	return Login{User: RootUser, Escalation: EscalationDoas}
+}
+
+// Escalate returns a runner that runs every command of exec as root. For a
+// root login exec is returned unchanged.
+func (l Login) Escalate(exec Runner) Runner {
+	if l.User == RootUser || l.User == "" {
+		return exec
+	}
+	return &escalated{runner: exec, escalation: l.Escalation}
+}
+
+// escalated wraps the commands of a runner in a privilege escalation tool.
+type escalated struct {
+	runner     Runner
+	escalation Escalation
+}
+
+func (e *escalated) Exec(ctx context.Context, command string) (ssh.CommandResult, error) {
+	return e.runner.Exec(ctx, e.escalation.Wrap(command))
+}
+
+func (e *escalated) ExecStream(ctx context.Context, command string, opts ssh.StreamOpts) (ssh.CommandResult, error) {
+	return Stream(ctx, e.runner, e.escalation.Wrap(command), opts)
+}
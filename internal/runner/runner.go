@@ -3,11 +3,63 @@ package runner
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 
 	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
 )
 
+const (
+	logDirPermissions  = 0o750
+	logFilePermissions = 0o600
+)
+
 // Runner executes commands on a remote host.
 type Runner interface {
 	Exec(ctx context.Context, command string) (ssh.CommandResult, error)
 }
+
+// Streamer is a Runner that can deliver output while a command runs.
+type Streamer interface {
+	Runner
+	ExecStream(ctx context.Context, command string, opts ssh.StreamOpts) (ssh.CommandResult, error)
+}
+
+// Interactive is a Runner that can answer a command's prompts with an expect
+// script, as for a system driven over its serial console.
+type Interactive interface {
+	Runner
+	ExecExpect(ctx context.Context, command string, script []ssh.Step, transcript io.Writer) (ssh.CommandResult, error)
+}
+
+// Stream runs command through exec's ExecStream when it is a Streamer.
+// Otherwise it falls back to Exec and replays the output through opts once
+// the command has finished, so callers need not care which kind they hold.
+func Stream(ctx context.Context, exec Runner, command string, opts ssh.StreamOpts) (ssh.CommandResult, error) {
+	if streamer, ok := exec.(Streamer); ok {
+		return streamer.ExecStream(ctx, command, opts)
+	}
+
+	result, err := exec.Exec(ctx, command)
+	if err != nil {
+		return result, err
+	}
+	return opts.Replay(result), nil
+}
+
+// OpenStageLog opens <dir>/<stage>.log for appending, creating dir as needed.
+// The caller closes the file.
+func OpenStageLog(dir, stage string) (*os.File, error) {
+	if err := os.MkdirAll(dir, logDirPermissions); err != nil {
+		return nil, fmt.Errorf("create log directory %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, stage+".log")
+	file, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFilePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("open stage log %s: %w", path, err)
+	}
+	return file, nil
+}
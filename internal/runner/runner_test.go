@@ -0,0 +1,92 @@
+package runner_test
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRunner records commands and answers them with result.
+type mockRunner struct {
+	result   ssh.CommandResult
+	commands []string
+}
+
+func (m *mockRunner) Exec(_ context.Context, command string) (ssh.CommandResult, error) {
+	m.commands = append(m.commands, command)
+	return m.result, nil
+}
+
+func newMock(stdout string) *mockRunner {
+	return &mockRunner{result: ssh.CommandResult{Stdout: stdout, Stderr: "", ExitCode: 0}, commands: nil}
+}
+
+func TestEscalationWrap(t *testing.T) {
+	t.Parallel()
+
+	t.Run("prefixes the escalation tool", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, `doas -n sh -c 'echo hi > /etc/motd'`, runner.EscalationDoas.Wrap("echo hi > /etc/motd"))
+		assert.Equal(t, `sudo -n sh -c 'id'`, runner.EscalationSudo.Wrap("id"))
+	})
+
+	t.Run("keeps escaped arguments intact", func(t *testing.T) {
+		t.Parallel()
+
+		command := "printf %s " + ssh.EscapeShellArg("it's a 'quoted' $HOME") + " > /dev/stdout"
+		wrapped := runner.EscalationDoas.Wrap(command)
+
+		// Run what doas would run, without doas.
+		output, err := exec.CommandContext(context.Background(), "sh", "-c",
+			strings.TrimPrefix(wrapped, "doas -n ")).Output()
+		require.NoError(t, err)
+		assert.Equal(t, "it's a 'quoted' $HOME", string(output))
+	})
+}
+
+func TestLoginEscalate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("leaves root commands alone", func(t *testing.T) {
+		t.Parallel()
+
+		mock := newMock("")
+		_, err := runner.RootLogin().Escalate(mock).Exec(context.Background(), "id")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id"}, mock.commands)
+	})
+
+	t.Run("wraps commands of other users", func(t *testing.T) {
+		t.Parallel()
+
+		mock := newMock("")
+		login := runner.Login{User: "security", Escalation: runner.EscalationSudo}
+		_, err := login.Escalate(mock).Exec(context.Background(), "id")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sudo -n sh -c 'id'"}, mock.commands)
+	})
+
+	t.Run("streams wrapped commands", func(t *testing.T) {
+		t.Parallel()
+
+		mock := newMock("one\ntwo\n")
+		login := runner.Login{User: "security", Escalation: runner.EscalationDoas}
+
+		var lines []string
+		var opts ssh.StreamOpts
+		opts.OnStdout = func(line string) { lines = append(lines, line) }
+
+		result, err := runner.Stream(context.Background(), login.Escalate(mock), "dmesg", opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"doas -n sh -c 'dmesg'"}, mock.commands)
+		assert.Equal(t, []string{"one", "two"}, lines)
+		assert.Equal(t, "one\ntwo", result.Stdout)
+	})
+}
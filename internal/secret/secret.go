@@ -0,0 +1,47 @@
+// Package secret holds credentials that must never reach logs or disk.
+package secret
+
+import "log/slog"
+
+const redacted = "[REDACTED]"
+
+// Secret is a credential that is kept in memory only. It formats as
+// [REDACTED] under fmt, slog and text marshaling so it cannot leak into logs.
+type Secret struct {
+	value string
+}
+
+// New wraps value as a Secret.
+func New(value string) Secret {
+	return Secret{value: value}
+}
+
+// Reveal returns the secret value. Only pass it to the code that authenticates.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+// IsZero reports whether the secret is empty.
+func (s Secret) IsZero() bool {
+	return s.value == ""
+}
+
+// String implements fmt.Stringer.
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer.
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// LogValue implements slog.LogValuer.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
@@ -0,0 +1,58 @@
+package secret_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecret(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reveals value", func(t *testing.T) {
+		t.Parallel()
+
+		password := secret.New("hunter2")
+
+		assert.Equal(t, "hunter2", password.Reveal())
+		assert.False(t, password.IsZero())
+		assert.True(t, secret.Secret{}.IsZero())
+	})
+
+	t.Run("redacts formatting", func(t *testing.T) {
+		t.Parallel()
+
+		password := secret.New("hunter2")
+		wrapped := struct{ Password secret.Secret }{Password: password}
+
+		for _, formatted := range []string{
+			fmt.Sprint(password),
+			fmt.Sprintf("%v %+v %#v %s", password, password, password, password),
+			fmt.Sprintf("%v %+v %#v", wrapped, wrapped, wrapped),
+		} {
+			assert.NotContains(t, formatted, "hunter2")
+		}
+	})
+
+	t.Run("redacts slog and json", func(t *testing.T) {
+		t.Parallel()
+
+		password := secret.New("hunter2")
+
+		var logs bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&logs, nil))
+		logger.Info("rescue", "password", password)
+		assert.NotContains(t, logs.String(), "hunter2")
+		assert.Contains(t, logs.String(), "[REDACTED]")
+
+		encoded, err := json.Marshal(map[string]secret.Secret{"password": password})
+		require.NoError(t, err)
+		assert.NotContains(t, string(encoded), "hunter2")
+	})
+}
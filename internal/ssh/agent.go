@@ -0,0 +1,170 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AgentSocketEnv names the environment variable holding the ssh-agent socket.
+const AgentSocketEnv = "SSH_AUTH_SOCK"
+
+var (
+	// ErrNoAgent is wrapped when no ssh-agent socket is configured.
+	ErrNoAgent = errors.New(AgentSocketEnv + " is not set")
+
+	// ErrAgentKeyNotFound is wrapped when ssh-agent does not hold the wanted key.
+	ErrAgentKeyNotFound = errors.New("key not found in ssh-agent")
+)
+
+// LoadAgentKeyPair returns a key pair whose signatures are made by the
+// ssh-agent listening on socket, usually the value of SSH_AUTH_SOCK. That
+// covers keys on security keys and other hardware tokens. keyPath selects the
+// agent key matching <keyPath>.pub, or keyPath itself when it names a public
+// key; empty uses the agent's first key. A certificate for the key is used
+// when the agent holds one or <keyPath>-cert.pub exists. Close the key pair
+// when done.
+func LoadAgentKeyPair(ctx context.Context, socket, keyPath string) (*KeyPair, error) {
+	if socket == "" {
+		return nil, &Error{Message: "connect to ssh-agent", Err: ErrNoAgent}
+	}
+
+	var want ssh.PublicKey
+	keyPath = strings.TrimSuffix(expandPath(keyPath), ".pub")
+	if keyPath != "" {
+		key, err := readPublicKey(keyPath + ".pub")
+		if err != nil {
+			return nil, err
+		}
+		want = key
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, &Error{Message: "connect to ssh-agent", Err: err}
+	}
+
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		CloseQuietly(conn)
+		return nil, &Error{Message: "list ssh-agent keys", Err: err}
+	}
+
+	keys, err := agentKeyPair(signers, want, conn, keyPath)
+	if err != nil {
+		CloseQuietly(conn)
+		return nil, err
+	}
+
+	slog.Info("using ssh-agent key", "fingerprint", keys.Fingerprint(), "type", keys.PublicKey().Type())
+	return keys, nil
+}
+
+// agentCert is a certificate held by ssh-agent with the signer that uses it.
+type agentCert struct {
+	cert   *ssh.Certificate
+	signer ssh.Signer
+}
+
+// keySigner presents the signer of an agent-held certificate as its plain
+// key, for agents that hold a key only together with its certificate.
+type keySigner struct {
+	ssh.AlgorithmSigner
+
+	key ssh.PublicKey
+}
+
+func (s keySigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+// agentKeyPair picks the agent key matching want, or the first one, and
+// certifies it with a certificate the agent holds for the same key or, failing
+// that, with <keyPath>-cert.pub.
+func agentKeyPair(signers []ssh.Signer, want ssh.PublicKey, conn net.Conn, keyPath string) (*KeyPair, error) {
+	plain, certs := splitAgentKeys(signers)
+
+	chosen, ok := findAgentKey(plain, certs, want)
+	if !ok {
+		return nil, &Error{Message: "select ssh-agent key", Err: ErrAgentKeyNotFound}
+	}
+
+	for _, held := range certs {
+		if sameKey(held.cert.Key, chosen.PublicKey()) {
+			keys := &KeyPair{signer: chosen, certSigner: nil, agent: conn, private: nil}
+			if err := keys.certify(held.cert); err != nil {
+				return nil, err
+			}
+			return keys, nil
+		}
+	}
+
+	if keyPath == "" {
+		return &KeyPair{signer: chosen, certSigner: nil, agent: conn, private: nil}, nil
+	}
+	return withCertificate(chosen, conn, keyPath)
+}
+
+// splitAgentKeys separates plain keys from certificates. The agent client
+// reports both as opaque keys, so certificates are recognised by parsing.
+func splitAgentKeys(signers []ssh.Signer) ([]ssh.Signer, []agentCert) {
+	var plain []ssh.Signer
+	var certs []agentCert
+	for _, signer := range signers {
+		parsed, err := ssh.ParsePublicKey(signer.PublicKey().Marshal())
+		if cert, ok := parsed.(*ssh.Certificate); err == nil && ok {
+			certs = append(certs, agentCert{cert: cert, signer: signer})
+			continue
+		}
+		plain = append(plain, signer)
+	}
+	return plain, certs
+}
+
+// findAgentKey returns the first plain key matching want, or any key when
+// want is nil, falling back to the key behind a matching certificate.
+func findAgentKey(plain []ssh.Signer, certs []agentCert, want ssh.PublicKey) (ssh.Signer, bool) {
+	for _, signer := range plain {
+		if want == nil || sameKey(signer.PublicKey(), want) {
+			return signer, true
+		}
+	}
+
+	for _, held := range certs {
+		signer, ok := held.signer.(ssh.AlgorithmSigner)
+		if ok && (want == nil || sameKey(held.cert.Key, want)) {
+			return keySigner{AlgorithmSigner: signer, key: held.cert.Key}, true
+		}
+	}
+	return nil, false
+}
+
+// readPublicKey reads a public key in authorized_keys format. A certificate
+// yields the key it certifies.
+func readPublicKey(path string) (ssh.PublicKey, error) {
+	data, err := readKeyFile(path)
+	if err != nil {
+		return nil, &Error{Message: "read public key", Err: err}
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, &Error{Message: "parse public key " + path, Err: err}
+	}
+
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return cert.Key, nil
+	}
+	return key, nil
+}
+
+func sameKey(a, b ssh.PublicKey) bool {
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
@@ -0,0 +1,169 @@
+package ssh_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startTestAgent serves keyring as an ssh-agent on a unix socket and returns
+// the socket path.
+func startTestAgent(t *testing.T, keyring agent.Agent) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "agent")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "agent.sock")
+	var config net.ListenConfig
+	listener, err := config.Listen(context.Background(), "unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	return socket
+}
+
+func addAgentKey(t *testing.T, keyring agent.Agent) gossh.Signer {
+	t.Helper()
+
+	private, signer := newTestKey(t)
+	var added agent.AddedKey
+	added.PrivateKey = private
+	require.NoError(t, keyring.Add(added))
+	return signer
+}
+
+func writePublicKey(t *testing.T, key gossh.PublicKey) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path+".pub", gossh.MarshalAuthorizedKey(key), 0o600))
+	return path
+}
+
+func TestLoadAgentKeyPair(t *testing.T) {
+	t.Parallel()
+
+	keyring := agent.NewKeyring()
+	first := addAgentKey(t, keyring)
+	second := addAgentKey(t, keyring)
+	socket := startTestAgent(t, keyring)
+
+	t.Run("selects the key matching the public key file", func(t *testing.T) {
+		t.Parallel()
+
+		keys, err := ssh.LoadAgentKeyPair(context.Background(), socket, writePublicKey(t, second.PublicKey()))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = keys.Close() })
+
+		assert.Equal(t, second.PublicKey().Marshal(), keys.PublicKey().Marshal())
+	})
+
+	t.Run("uses the first key without a key path", func(t *testing.T) {
+		t.Parallel()
+
+		keys, err := ssh.LoadAgentKeyPair(context.Background(), socket, "")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = keys.Close() })
+
+		assert.Equal(t, first.PublicKey().Marshal(), keys.PublicKey().Marshal())
+	})
+
+	t.Run("authenticates through the agent", func(t *testing.T) {
+		t.Parallel()
+
+		keys, err := ssh.LoadAgentKeyPair(context.Background(), socket, writePublicKey(t, first.PublicKey()))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = keys.Close() })
+
+		var serverConfig gossh.ServerConfig
+		serverConfig.PublicKeyCallback = func(_ gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if string(key.Marshal()) != string(first.PublicKey().Marshal()) {
+				return nil, ssh.ErrAgentKeyNotFound
+			}
+			return &gossh.Permissions{CriticalOptions: nil, Extensions: nil}, nil
+		}
+		host, port := startTestServer(t, &serverConfig, echoHandler)
+
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+		t.Cleanup(func() { _ = client.Close() })
+		result, err := client.Exec(context.Background(), "hello")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", result.Stdout)
+	})
+
+	t.Run("fails for a key the agent does not hold", func(t *testing.T) {
+		t.Parallel()
+
+		_, other := newTestKey(t)
+		_, err := ssh.LoadAgentKeyPair(context.Background(), socket, writePublicKey(t, other.PublicKey()))
+		require.ErrorIs(t, err, ssh.ErrAgentKeyNotFound)
+	})
+
+	t.Run("fails without an agent socket", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ssh.LoadAgentKeyPair(context.Background(), "", "")
+		require.ErrorIs(t, err, ssh.ErrNoAgent)
+	})
+}
+
+func TestLoadAgentKeyPairCertificate(t *testing.T) {
+	t.Parallel()
+
+	_, ca := newTestKey(t)
+	keyring := agent.NewKeyring()
+
+	private, signer := newTestKey(t)
+	cert := certify(t, ca, signer.PublicKey())
+	var added agent.AddedKey
+	added.PrivateKey = private
+	added.Certificate = cert
+	require.NoError(t, keyring.Add(added))
+	socket := startTestAgent(t, keyring)
+
+	keys, err := ssh.LoadAgentKeyPair(context.Background(), socket, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = keys.Close() })
+
+	loaded, ok := keys.Certificate()
+	require.True(t, ok)
+	assert.Equal(t, cert.Marshal(), loaded.Marshal())
+	assert.Equal(t, signer.PublicKey().Marshal(), keys.PublicKey().Marshal())
+
+	var checker gossh.CertChecker
+	checker.IsUserAuthority = func(auth gossh.PublicKey) bool {
+		return string(auth.Marshal()) == string(ca.PublicKey().Marshal())
+	}
+	var serverConfig gossh.ServerConfig
+	serverConfig.PublicKeyCallback = checker.Authenticate
+	host, port := startTestServer(t, &serverConfig, echoHandler)
+
+	client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+	t.Cleanup(func() { _ = client.Close() })
+	result, err := client.Exec(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Stdout)
+}
@@ -5,14 +5,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
 )
 
 const (
@@ -21,39 +27,55 @@ const (
 )
 
 // Client wraps golang.org/x/crypto/ssh with higher-level operations.
+// It keeps one authenticated connection per client and opens a session on
+// it for every command; see conn.go.
 type Client struct {
-	config  *ssh.ClientConfig
-	host    string
-	keyPath string
-	port    int
+	config    *ssh.ClientConfig
+	conn      *ssh.Client
+	sftp      *sftp.Client
+	dialer    Dialer
+	host      string
+	port      int
+	keepalive time.Duration
+	ptyCols   int
+	ptyRows   int
+	mu        sync.Mutex
+	closed    bool
 }
 
 // NewClient creates a new SSH client for the given host using key authentication.
 func NewClient(host, keyPath string) (*Client, error) {
-	expandedPath := expandPath(keyPath)
-
-	key, err := readKeyFile(expandedPath)
+	keys, err := LoadKeyPair(keyPath)
 	if err != nil {
-		return nil, &Error{Message: "read private key", Err: err}
+		return nil, err
 	}
 
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		return nil, &Error{Message: "parse private key", Err: err}
-	}
+	return NewClientWithKeyPair(host, keys), nil
+}
 
+// NewClientWithKeyPair creates a new SSH client authenticating with an in-memory key pair.
+// Until WithHostKeys is set, the client trusts the first host key it sees and
+// rejects any other key for its lifetime.
+func NewClientWithKeyPair(host string, keys *KeyPair) *Client {
 	var clientConfig ssh.ClientConfig
 	clientConfig.User = "root"
-	clientConfig.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
-	clientConfig.HostKeyCallback = insecureHostKeyFallback
+	clientConfig.Auth = []ssh.AuthMethod{keys.authMethod()}
+	clientConfig.HostKeyCallback = NewHostKeys().Callback("")
 	clientConfig.Timeout = defaultTimeout
 
 	return &Client{
-		host:    host,
-		port:    defaultPort,
-		keyPath: expandedPath,
-		config:  &clientConfig,
-	}, nil
+		config:    &clientConfig,
+		conn:      nil,
+		sftp:      nil,
+		dialer:    nil,
+		host:      host,
+		port:      defaultPort,
+		keepalive: DefaultKeepalive,
+		ptyCols:   defaultPtyCols,
+		ptyRows:   defaultPtyRows,
+		mu:        sync.Mutex{},
+		closed:    false,
+	}
 }
 
 // readKeyFile reads an SSH private key from a validated path.
@@ -62,25 +84,61 @@ func readKeyFile(keyPath string) ([]byte, error) {
 	return os.ReadFile(cleaned)
 }
 
+// WithUser sets the login user, root by default. An empty user keeps root.
+func (c *Client) WithUser(user string) *Client {
+	if user != "" {
+		c.config.User = user
+	}
+	return c
+}
+
 // WithPort sets a custom SSH port.
 func (c *Client) WithPort(port int) *Client {
 	c.port = port
 	return c
 }
 
+// WithHostKeys verifies the host's key against store for phase. When the store
+// already trusts a key for the host, the client asks the server for that key
+// type, so a server with several host keys presents the expected one.
+func (c *Client) WithHostKeys(store *HostKeys, phase Phase) *Client {
+	c.config.HostKeyCallback = store.Callback(phase)
+	if key, ok := store.Known(c.host, phase); ok {
+		c.config.HostKeyAlgorithms = hostKeyAlgorithms(key)
+	}
+	return c
+}
+
+// WithPasswordFallback adds password authentication after the key, so a
+// session still succeeds when key injection failed, as can happen in rescue
+// mode. An empty password leaves the client unchanged.
+func (c *Client) WithPasswordFallback(password secret.Secret) *Client {
+	if password.IsZero() {
+		return c
+	}
+
+	challenge := func(_, _ string, questions []string, _ []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range answers {
+			answers[i] = password.Reveal()
+		}
+		return answers, nil
+	}
+
+	c.config.Auth = append(c.config.Auth,
+		ssh.Password(password.Reveal()),
+		ssh.KeyboardInteractive(challenge),
+	)
+	return c
+}
+
 // Exec runs a command on the remote host and returns the result.
 func (c *Client) Exec(ctx context.Context, command string) (CommandResult, error) {
-	conn, err := c.dial(ctx)
+	session, err := c.session(ctx)
 	if err != nil {
 		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, err
 	}
-	defer closeQuietly(conn)
-
-	session, err := conn.NewSession()
-	if err != nil {
-		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, &Error{Message: "create session", Err: err}
-	}
-	defer closeQuietly(session)
+	defer CloseQuietly(session)
 
 	var stdout, stderr bytes.Buffer
 	session.Stdout = &stdout
@@ -103,26 +161,29 @@ func (c *Client) Exec(ctx context.Context, command string) (CommandResult, error
 	}, nil
 }
 
-// WaitForReady waits until the host accepts SSH connections.
+// WaitForReady waits until the host accepts SSH connections. The connection
+// it establishes is kept for the commands that follow.
 func (c *Client) WaitForReady(ctx context.Context) error {
 	backoffPolicy := backoff.NewExponentialBackOff()
 	backoffPolicy.MaxElapsedTime = 5 * time.Minute
 	backoffPolicy.InitialInterval = 2 * time.Second
 
 	retryOperation := func() error {
-		conn, dialErr := c.dial(ctx)
+		_, dialErr := c.connect(ctx)
+		if errors.Is(dialErr, ErrHostKeyMismatch) || errors.Is(dialErr, ErrClosed) {
+			return backoff.Permanent(dialErr)
+		}
 		if dialErr != nil {
 			slog.Debug("ssh not ready yet", "host", c.host, "err", dialErr)
 			return dialErr
 		}
-		closeQuietly(conn)
 		return nil
 	}
 
 	if err := backoff.Retry(retryOperation, backoff.WithContext(backoffPolicy, ctx)); err != nil {
 		return &Error{
 			Message: fmt.Sprintf("host %s not reachable after timeout", c.host),
-			Err:     err,
+			Err:     fmt.Errorf("%w: %w", ErrNotReady, err),
 		}
 	}
 
@@ -131,9 +192,13 @@ func (c *Client) WaitForReady(ctx context.Context) error {
 }
 
 func (c *Client) dial(ctx context.Context) (*ssh.Client, error) {
-	addr := fmt.Sprintf("%s:%d", c.host, c.port)
+	addr := c.addr()
+
+	var dialer Dialer = &net.Dialer{}
+	if c.dialer != nil {
+		dialer = c.dialer
+	}
 
-	var dialer net.Dialer
 	netConn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, &Error{Message: "connect to " + addr, Err: err}
@@ -141,25 +206,21 @@ func (c *Client) dial(ctx context.Context) (*ssh.Client, error) {
 
 	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, c.config)
 	if err != nil {
-		closeQuietly(netConn)
+		CloseQuietly(netConn)
 		return nil, &Error{Message: "ssh handshake", Err: err}
 	}
 
 	return ssh.NewClient(sshConn, chans, reqs), nil
 }
 
-// insecureHostKeyFallback accepts any host key. Rescue mode servers have
-// ephemeral host keys that change on each provisioning cycle, making
-// host-key verification impractical for this use case.
-func insecureHostKeyFallback(_ string, _ net.Addr, _ ssh.PublicKey) error {
-	return nil
-}
-
-type closer interface {
-	Close() error
+// addr returns host:port, bracketing IPv6 literals.
+func (c *Client) addr() string {
+	return net.JoinHostPort(c.host, strconv.Itoa(c.port))
 }
 
-func closeQuietly(resource closer) {
+// CloseQuietly closes resource, logging a failure at debug level, for the
+// deferred closes whose error has nowhere useful to go.
+func CloseQuietly(resource io.Closer) {
 	if err := resource.Close(); err != nil {
 		slog.Debug("close error", "error", err)
 	}
@@ -1,13 +1,17 @@
 package ssh_test
 
 import (
+	"context"
+	"errors"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
 	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func TestCommandResultSuccess(t *testing.T) {
@@ -178,3 +182,92 @@ AAAEAbGOvY2Nt3h4PRbzz+D3T/5s1UTIjDVbBmy5pPSxffxadTxs997cflgqdUhMo12v4A
 
 	return keyFile
 }
+
+func TestClientAddr(t *testing.T) {
+	t.Parallel()
+
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	t.Run("joins IPv4 host and port", func(t *testing.T) {
+		t.Parallel()
+
+		client := ssh.NewClientWithKeyPair("192.0.2.10", keys)
+		assert.Equal(t, "192.0.2.10:22", client.AddrForTest())
+	})
+
+	t.Run("brackets IPv6 host", func(t *testing.T) {
+		t.Parallel()
+
+		client := ssh.NewClientWithKeyPair("2001:db8:1:2::1", keys)
+		assert.Equal(t, "[2001:db8:1:2::1]:22", client.AddrForTest())
+	})
+}
+
+func TestPasswordFallback(t *testing.T) {
+	t.Parallel()
+
+	var serverConfig gossh.ServerConfig
+	serverConfig.PasswordCallback = func(_ gossh.ConnMetadata, password []byte) (*gossh.Permissions, error) {
+		if string(password) == "hunter2" {
+			return &gossh.Permissions{CriticalOptions: nil, Extensions: nil}, nil
+		}
+		return nil, errors.New("wrong password")
+	}
+	host, port := startTestServer(t, &serverConfig, echoHandler)
+
+	// The server rejects every key, like rescue mode when key injection failed.
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	t.Run("authenticates with password after key is rejected", func(t *testing.T) {
+		t.Parallel()
+
+		client := ssh.NewClientWithKeyPair(host, keys).
+			WithPort(port).
+			WithPasswordFallback(secret.New("hunter2"))
+
+		result, execErr := client.Exec(context.Background(), "hello")
+
+		require.NoError(t, execErr)
+		assert.Equal(t, "hello", result.Stdout)
+	})
+
+	t.Run("fails without password", func(t *testing.T) {
+		t.Parallel()
+
+		client := ssh.NewClientWithKeyPair(host, keys).
+			WithPort(port).
+			WithPasswordFallback(secret.Secret{})
+
+		_, execErr := client.Exec(context.Background(), "hello")
+
+		require.Error(t, execErr)
+		assert.Contains(t, execErr.Error(), "handshake")
+	})
+}
+
+func TestWithUser(t *testing.T) {
+	t.Parallel()
+
+	var serverConfig gossh.ServerConfig
+	serverConfig.PublicKeyCallback = func(conn gossh.ConnMetadata, _ gossh.PublicKey) (*gossh.Permissions, error) {
+		if conn.User() != "security" {
+			return nil, errors.New("root login disabled")
+		}
+		return &gossh.Permissions{CriticalOptions: nil, Extensions: nil}, nil
+	}
+	host, port := startTestServer(t, &serverConfig, echoHandler)
+
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	_, err = ssh.NewClientWithKeyPair(host, keys).WithPort(port).Exec(context.Background(), "hello")
+	require.Error(t, err)
+
+	client := ssh.NewClientWithKeyPair(host, keys).WithPort(port).WithUser("security")
+	t.Cleanup(func() { _ = client.Close() })
+	result, err := client.Exec(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Stdout)
+}
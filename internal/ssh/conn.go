@@ -0,0 +1,247 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultKeepalive is how often an idle connection is probed.
+	DefaultKeepalive = 15 * time.Second
+
+	keepaliveRequest = "keepalive@openssh.com"
+)
+
+// ErrClosed is returned by operations on a client after Close.
+var ErrClosed = errors.New("client closed")
+
+var (
+	errKeepaliveTimeout   = errors.New("keepalive timed out")
+	errConnectionReplaced = errors.New("connection replaced while starting sftp")
+)
+
+// WithKeepalive sets how often the connection is probed; a failed probe drops
+// the connection so the next operation reconnects. Zero disables keepalives.
+func (c *Client) WithKeepalive(interval time.Duration) *Client {
+	c.keepalive = interval
+	return c
+}
+
+// Close closes the client's connection and SFTP subsystem. The client cannot
+// be used afterwards.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	return c.dropLocked()
+}
+
+// session opens a session on the shared connection. When the cached
+// connection turns out to be dead it is replaced once, so a dropped
+// connection is re-established transparently before a command starts.
+func (c *Client) session(ctx context.Context) (*ssh.Session, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := conn.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	slog.Debug("ssh connection lost, reconnecting", "host", c.host, "error", err)
+	c.drop(conn)
+
+	conn, err = c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err = conn.NewSession()
+	if err != nil {
+		return nil, &Error{Message: "create session", Err: err}
+	}
+	return session, nil
+}
+
+// sftpClient returns the SFTP subsystem of the shared connection, starting it
+// on first use and again after a reconnect. The subsystem is started without
+// holding the lock; when the connection was replaced meanwhile it is closed
+// and started once more on the current connection.
+func (c *Client) sftpClient(ctx context.Context) (*sftp.Client, error) {
+	client, current, err := c.startSFTP(ctx)
+	if err != nil || current {
+		return client, err
+	}
+
+	client, current, err = c.startSFTP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !current {
+		CloseQuietly(client)
+		return nil, &Error{Message: "create sftp client", Err: errConnectionReplaced}
+	}
+	return client, nil
+}
+
+// startSFTP returns the cached SFTP subsystem or starts one on the shared
+// connection and caches it. current is false when the connection was dropped
+// or replaced while the subsystem started; the client is then not cached and
+// the caller must close it.
+func (c *Client) startSFTP(ctx context.Context) (*sftp.Client, bool, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	if c.sftp != nil && c.conn == conn {
+		defer c.mu.Unlock()
+		return c.sftp, true, nil
+	}
+	c.mu.Unlock()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return nil, false, &Error{Message: "create sftp client", Err: err}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.conn != conn:
+		CloseQuietly(client)
+		return nil, false, nil
+	case c.sftp != nil:
+		CloseQuietly(client)
+		return c.sftp, true, nil
+	default:
+		c.sftp = client
+		return client, true, nil
+	}
+}
+
+// connect returns the shared connection, dialing it when there is none. The
+// dial runs without holding the lock so Close and drop are not blocked by a
+// slow handshake; when another caller connected meanwhile, its connection is
+// kept and the new one closed.
+func (c *Client) connect(ctx context.Context) (*ssh.Client, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, &Error{Message: "connect to " + c.addr(), Err: ErrClosed}
+	}
+	if c.conn != nil {
+		defer c.mu.Unlock()
+		return c.conn, nil
+	}
+	c.mu.Unlock()
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.closed:
+		CloseQuietly(conn)
+		return nil, &Error{Message: "connect to " + c.addr(), Err: ErrClosed}
+	case c.conn != nil:
+		CloseQuietly(conn)
+		return c.conn, nil
+	default:
+		c.conn = conn
+		go c.watch(conn)
+		return conn, nil
+	}
+}
+
+// watch sends keepalives on conn until a probe fails or the connection
+// closes, and then drops it so the next operation reconnects.
+func (c *Client) watch(conn *ssh.Client) {
+	done := make(chan struct{})
+	go func() {
+		_ = conn.Wait()
+		close(done)
+	}()
+
+	var tick <-chan time.Time
+	if c.keepalive > 0 {
+		ticker := time.NewTicker(c.keepalive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			c.drop(conn)
+			return
+		case <-tick:
+			if err := probe(conn, c.keepalive); err != nil {
+				slog.Debug("ssh keepalive failed", "host", c.host, "error", err)
+				c.drop(conn)
+				return
+			}
+		}
+	}
+}
+
+// probe sends a keepalive request and waits up to timeout for the reply. The
+// reply's status does not matter; only a live transport can deliver one.
+func probe(conn *ssh.Client, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := conn.SendRequest(keepaliveRequest, true, nil)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return errKeepaliveTimeout
+	}
+}
+
+// drop closes conn if it is still the shared connection.
+func (c *Client) drop(conn *ssh.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == conn {
+		_ = c.dropLocked()
+	}
+}
+
+// dropLocked closes the shared connection; the caller holds the lock.
+func (c *Client) dropLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	if c.sftp != nil {
+		CloseQuietly(c.sftp)
+		c.sftp = nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return &Error{Message: "close connection", Err: err}
+	}
+	return nil
+}
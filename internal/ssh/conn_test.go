@@ -0,0 +1,121 @@
+package ssh_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// countingServer starts an echo server that counts authenticated connections.
+func countingServer(t *testing.T) (string, int, *atomic.Int32) {
+	t.Helper()
+
+	var connections atomic.Int32
+	var serverConfig gossh.ServerConfig
+	serverConfig.PasswordCallback = func(_ gossh.ConnMetadata, _ []byte) (*gossh.Permissions, error) {
+		connections.Add(1)
+		return &gossh.Permissions{CriticalOptions: nil, Extensions: nil}, nil
+	}
+
+	host, port := startTestServer(t, &serverConfig, echoHandler)
+	return host, port, &connections
+}
+
+func TestPersistentConnection(t *testing.T) {
+	t.Parallel()
+
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	newClient := func(host string, port int) *ssh.Client {
+		client := ssh.NewClientWithKeyPair(host, keys).
+			WithPort(port).
+			WithPasswordFallback(secret.New("hunter2")).
+			WithKeepalive(20 * time.Millisecond)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("runs every command over one connection", func(t *testing.T) {
+		t.Parallel()
+
+		host, port, connections := countingServer(t)
+		client := newClient(host, port)
+
+		require.NoError(t, client.WaitForReady(context.Background()))
+		for range 3 {
+			result, execErr := client.Exec(context.Background(), "hello")
+			require.NoError(t, execErr)
+			assert.Equal(t, "hello", result.Stdout)
+		}
+
+		// Let a few keepalives go by; they must not disturb the connection.
+		time.Sleep(100 * time.Millisecond)
+		_, againErr := client.Exec(context.Background(), "again")
+		require.NoError(t, againErr)
+		assert.Equal(t, int32(1), connections.Load())
+	})
+
+	t.Run("reconnects after the connection drops", func(t *testing.T) {
+		t.Parallel()
+
+		host, port, connections := countingServer(t)
+		client := newClient(host, port)
+
+		_, execErr := client.Exec(context.Background(), "hello")
+		require.NoError(t, execErr)
+
+		client.DropConnectionForTest()
+
+		result, execErr := client.Exec(context.Background(), "hello")
+		require.NoError(t, execErr)
+		assert.Equal(t, "hello", result.Stdout)
+		assert.Equal(t, int32(2), connections.Load())
+	})
+
+	t.Run("keeps one connection when commands connect at once", func(t *testing.T) {
+		t.Parallel()
+
+		host, port, connections := countingServer(t)
+		client := newClient(host, port)
+
+		var group sync.WaitGroup
+		for range 4 {
+			group.Go(func() {
+				_, execErr := client.Exec(context.Background(), "hello")
+				assert.NoError(t, execErr)
+			})
+		}
+		group.Wait()
+
+		dialed := connections.Load()
+		for range 3 {
+			_, execErr := client.Exec(context.Background(), "again")
+			require.NoError(t, execErr)
+		}
+		assert.Equal(t, dialed, connections.Load(), "later commands reuse the kept connection")
+	})
+
+	t.Run("refuses to run after Close", func(t *testing.T) {
+		t.Parallel()
+
+		host, port, _ := countingServer(t)
+		client := newClient(host, port)
+
+		_, execErr := client.Exec(context.Background(), "hello")
+		require.NoError(t, execErr)
+		require.NoError(t, client.Close())
+
+		_, execErr = client.Exec(context.Background(), "hello")
+		require.ErrorIs(t, execErr, ssh.ErrClosed)
+		require.NoError(t, client.Close())
+	})
+}
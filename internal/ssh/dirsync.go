@@ -0,0 +1,438 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// ErrNotDirectory is wrapped when the source of a directory transfer is not
+// a directory.
+var ErrNotDirectory = errors.New("not a directory")
+
+// Compare decides when a file already at the destination is left alone.
+type Compare int
+
+const (
+	// CompareMetadata skips files whose size and modification time match,
+	// like rsync without --checksum.
+	CompareMetadata Compare = iota
+
+	// CompareHash skips files whose size and SHA-256 match. Both copies are
+	// read in full, so it suits trees whose mtimes cannot be trusted.
+	CompareHash
+
+	// CompareNever copies every file.
+	CompareNever
+)
+
+// DirOpts configures UploadDir and DownloadDir. Include and Exclude are
+// path.Match globs: a pattern containing a slash is matched against the
+// slash-separated path relative to the root, any other against the base
+// name. Files are copied when Include is empty or one of its patterns
+// matches, unless an Exclude pattern does; an excluded directory is skipped
+// with everything in it.
+type DirOpts struct {
+	Include []string
+	Exclude []string
+	Compare Compare
+}
+
+// UploadDir mirrors the local directory tree at localDir into remoteDir via
+// SFTP. Modes and modification times are preserved and symlinks are
+// recreated rather than followed. Files and directories at the destination
+// that are missing locally are left in place.
+func (c *Client) UploadDir(ctx context.Context, localDir, remoteDir string, opts DirOpts) error {
+	sftpClient, err := c.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return syncTree(ctx, localTree{}, remoteTree{client: sftpClient},
+		filepath.Clean(expandPath(localDir)), remoteDir, opts)
+}
+
+// DownloadDir mirrors the remote directory tree at remoteDir into localDir
+// via SFTP, the reverse of UploadDir.
+func (c *Client) DownloadDir(ctx context.Context, remoteDir, localDir string, opts DirOpts) error {
+	sftpClient, err := c.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return syncTree(ctx, remoteTree{client: sftpClient}, localTree{},
+		remoteDir, filepath.Clean(expandPath(localDir)), opts)
+}
+
+// tree is a filesystem a directory transfer reads from or writes to.
+type tree interface {
+	Join(elem ...string) string
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.FileInfo, error)
+	ReadLink(name string) (string, error)
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	MkdirAll(name string) error
+	Symlink(target, name string) error
+	Remove(name string) error
+	Chmod(name string, mode fs.FileMode) error
+	Chtimes(name string, mtime time.Time) error
+}
+
+// dirSync copies one tree into another.
+type dirSync struct {
+	src     tree
+	dst     tree
+	opts    DirOpts
+	copied  int
+	skipped int
+}
+
+func syncTree(ctx context.Context, src, dst tree, srcRoot, dstRoot string, opts DirOpts) error {
+	info, err := src.Stat(srcRoot)
+	if err != nil {
+		return &Error{Message: "stat " + srcRoot, Err: err}
+	}
+	if !info.IsDir() {
+		return &Error{Message: "sync " + srcRoot, Err: ErrNotDirectory}
+	}
+
+	started := time.Now()
+	syncer := &dirSync{src: src, dst: dst, opts: opts, copied: 0, skipped: 0}
+	if err = syncer.dir(ctx, srcRoot, dstRoot, "", info); err != nil {
+		return err
+	}
+
+	slog.Info("directory synced", "source", srcRoot, "destination", dstRoot,
+		"copied", syncer.copied, "unchanged", syncer.skipped, "duration", time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// dir copies the directory srcPath, at rel below the root, to dstPath. Its
+// mode and mtime are set once its entries are written, since writing them
+// changes the mtime. A symlink or file at dstPath is replaced, so the tree is
+// never written through a link to somewhere else.
+func (s *dirSync) dir(ctx context.Context, srcPath, dstPath, rel string, info fs.FileInfo) error {
+	if existing, found := lookup(s.dst, dstPath); found && !existing.IsDir() {
+		if err := s.dst.Remove(dstPath); err != nil {
+			return &Error{Message: "replace " + dstPath, Err: err}
+		}
+	}
+
+	if err := s.dst.MkdirAll(dstPath); err != nil {
+		return &Error{Message: "create directory " + dstPath, Err: err}
+	}
+
+	entries, err := s.src.ReadDir(srcPath)
+	if err != nil {
+		return &Error{Message: "read directory " + srcPath, Err: err}
+	}
+
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			return &Error{Message: "sync " + srcPath, Err: err}
+		}
+
+		entryRel := path.Join(rel, entry.Name())
+		if err = s.entry(ctx, s.src.Join(srcPath, entry.Name()), s.dst.Join(dstPath, entry.Name()),
+			entryRel, entry); err != nil {
+			return err
+		}
+	}
+
+	return s.setAttributes(dstPath, info)
+}
+
+func (s *dirSync) entry(ctx context.Context, srcPath, dstPath, rel string, info fs.FileInfo) error {
+	if matchAny(s.opts.Exclude, rel) {
+		return nil
+	}
+
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		return s.dir(ctx, srcPath, dstPath, rel, info)
+	case len(s.opts.Include) > 0 && !matchAny(s.opts.Include, rel):
+		return nil
+	case mode&fs.ModeSymlink != 0:
+		return s.symlink(srcPath, dstPath)
+	case mode.IsRegular():
+		return s.file(srcPath, dstPath, info)
+	default:
+		slog.Debug("skipping special file", "path", srcPath, "mode", mode)
+		return nil
+	}
+}
+
+// symlink recreates the link at srcPath with the same target, which may
+// point outside the tree.
+func (s *dirSync) symlink(srcPath, dstPath string) error {
+	target, err := s.src.ReadLink(srcPath)
+	if err != nil {
+		return &Error{Message: "read symlink " + srcPath, Err: err}
+	}
+
+	if existing, found := lookup(s.dst, dstPath); found {
+		if existing.Mode()&fs.ModeSymlink != 0 {
+			if current, linkErr := s.dst.ReadLink(dstPath); linkErr == nil && current == target {
+				s.skipped++
+				return nil
+			}
+		}
+		if err = s.dst.Remove(dstPath); err != nil {
+			return &Error{Message: "replace " + dstPath, Err: err}
+		}
+	}
+
+	if err = s.dst.Symlink(target, dstPath); err != nil {
+		return &Error{Message: "create symlink " + dstPath, Err: err}
+	}
+	s.copied++
+	return nil
+}
+
+func (s *dirSync) file(srcPath, dstPath string, info fs.FileInfo) error {
+	unchanged, err := s.unchanged(srcPath, dstPath, info)
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		s.skipped++
+		return nil
+	}
+
+	if existing, found := lookup(s.dst, dstPath); found && existing.Mode()&fs.ModeSymlink != 0 {
+		// Write a file in place of the link, not through it.
+		if err = s.dst.Remove(dstPath); err != nil {
+			return &Error{Message: "replace " + dstPath, Err: err}
+		}
+	}
+
+	if err = s.copyFile(srcPath, dstPath); err != nil {
+		return err
+	}
+	s.copied++
+	return s.setAttributes(dstPath, info)
+}
+
+func (s *dirSync) copyFile(srcPath, dstPath string) error {
+	src, err := s.src.Open(srcPath)
+	if err != nil {
+		return &Error{Message: "open " + srcPath, Err: err}
+	}
+	defer CloseQuietly(src)
+
+	dst, err := s.dst.Create(dstPath)
+	if err != nil {
+		return &Error{Message: "create " + dstPath, Err: err}
+	}
+
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return &Error{Message: "copy " + srcPath, Err: err}
+	}
+	return nil
+}
+
+// unchanged reports whether the destination already holds the file as
+// s.opts.Compare defines it.
+func (s *dirSync) unchanged(srcPath, dstPath string, info fs.FileInfo) (bool, error) {
+	existing, found := lookup(s.dst, dstPath)
+	if !found || !existing.Mode().IsRegular() || existing.Size() != info.Size() {
+		return false, nil
+	}
+
+	switch s.opts.Compare {
+	case CompareMetadata:
+		// SFTP carries whole seconds.
+		return existing.ModTime().Unix() == info.ModTime().Unix(), nil
+	case CompareHash:
+		srcSum, err := hashFile(s.src, srcPath)
+		if err != nil {
+			return false, err
+		}
+		dstSum, err := hashFile(s.dst, dstPath)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(srcSum, dstSum), nil
+	case CompareNever:
+	}
+	return false, nil
+}
+
+// setAttributes copies the permission bits, setuid, setgid and sticky
+// included, and the mtime of info to dstPath.
+func (s *dirSync) setAttributes(dstPath string, info fs.FileInfo) error {
+	mode := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if err := s.dst.Chmod(dstPath, mode); err != nil {
+		return &Error{Message: "set mode of " + dstPath, Err: err}
+	}
+	if err := s.dst.Chtimes(dstPath, info.ModTime()); err != nil {
+		return &Error{Message: "set mtime of " + dstPath, Err: err}
+	}
+	return nil
+}
+
+// lookup returns the entry at name without following a symlink, if any.
+func lookup(files tree, name string) (fs.FileInfo, bool) {
+	info, err := files.Lstat(name)
+	return info, err == nil
+}
+
+func hashFile(files tree, name string) ([]byte, error) {
+	file, err := files.Open(name)
+	if err != nil {
+		return nil, &Error{Message: "open " + name, Err: err}
+	}
+	defer CloseQuietly(file)
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return nil, &Error{Message: "hash " + name, Err: err}
+	}
+	return hash.Sum(nil), nil
+}
+
+// matchAny reports whether one of patterns matches rel, or its base name for
+// patterns without a slash. Malformed patterns match nothing.
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// localTree is the local filesystem.
+type localTree struct{}
+
+func (localTree) Join(elem ...string) string { return filepath.Join(elem...) }
+
+func (localTree) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (localTree) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (localTree) ReadDir(name string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, fmt.Errorf("read directory: %w", err)
+	}
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			return nil, fmt.Errorf("stat %s: %w", entry.Name(), infoErr)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localTree) ReadLink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (localTree) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Clean(name))
+}
+
+func (localTree) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(filepath.Clean(name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, downloadFilePermissions)
+}
+
+func (localTree) MkdirAll(name string) error {
+	return os.MkdirAll(name, 0o750)
+}
+
+func (localTree) Symlink(target, name string) error {
+	return os.Symlink(target, name)
+}
+
+func (localTree) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (localTree) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (localTree) Chtimes(name string, mtime time.Time) error {
+	return os.Chtimes(name, mtime, mtime)
+}
+
+// remoteTree is the remote filesystem, reached over SFTP.
+type remoteTree struct {
+	client *sftp.Client
+}
+
+func (r remoteTree) Join(elem ...string) string { return r.client.Join(elem...) }
+
+func (r remoteTree) Stat(name string) (fs.FileInfo, error) {
+	return r.client.Stat(name)
+}
+
+func (r remoteTree) Lstat(name string) (fs.FileInfo, error) {
+	return r.client.Lstat(name)
+}
+
+func (r remoteTree) ReadDir(name string) ([]fs.FileInfo, error) {
+	return r.client.ReadDir(name)
+}
+
+func (r remoteTree) ReadLink(name string) (string, error) {
+	return r.client.ReadLink(name)
+}
+
+func (r remoteTree) Open(name string) (io.ReadCloser, error) {
+	return r.client.Open(name)
+}
+
+func (r remoteTree) Create(name string) (io.WriteCloser, error) {
+	return r.client.Create(name)
+}
+
+func (r remoteTree) MkdirAll(name string) error {
+	return r.client.MkdirAll(name)
+}
+
+func (r remoteTree) Symlink(target, name string) error {
+	return r.client.Symlink(target, name)
+}
+
+func (r remoteTree) Remove(name string) error {
+	return r.client.Remove(name)
+}
+
+func (r remoteTree) Chmod(name string, mode fs.FileMode) error {
+	return r.client.Chmod(name, mode)
+}
+
+func (r remoteTree) Chtimes(name string, mtime time.Time) error {
+	return r.client.Chtimes(name, mtime, mtime)
+}
@@ -0,0 +1,177 @@
+package ssh_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMtime is a modification time that a copy would not get by accident.
+var testMtime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// writeTestTree creates a small overlay-like tree and returns its root.
+func writeTestTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]os.FileMode{
+		"etc/motd":            0o644,
+		"usr/local/bin/tool":  0o755,
+		"usr/local/bin/suid":  0o755 | os.ModeSetuid,
+		"var/log/build.log":   0o640,
+		"var/log/old/gc.log":  0o600,
+		"tmp/scratch/ignored": 0o600,
+	}
+	for name, mode := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte("contents of "+name), mode))
+		require.NoError(t, os.Chmod(path, mode))
+		require.NoError(t, os.Chtimes(path, testMtime, testMtime))
+	}
+	require.NoError(t, os.Symlink("../etc/motd", filepath.Join(root, "usr", "motd")))
+	require.NoError(t, os.Chmod(filepath.Join(root, "tmp"), 0o750|os.ModeSticky))
+
+	return root
+}
+
+func TestUploadDir(t *testing.T) {
+	t.Parallel()
+
+	host, port := startTestServer(t, openServerConfig(), echoHandler)
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	newClient := func() *ssh.Client {
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("preserves contents, modes, mtimes and symlinks", func(t *testing.T) {
+		t.Parallel()
+
+		source := writeTestTree(t)
+		remote := filepath.Join(t.TempDir(), "overlay")
+
+		var opts ssh.DirOpts
+		require.NoError(t, newClient().UploadDir(context.Background(), source, remote, opts))
+
+		tool := filepath.Join(remote, "usr", "local", "bin", "tool")
+		got, err := os.ReadFile(tool)
+		require.NoError(t, err)
+		assert.Equal(t, "contents of usr/local/bin/tool", string(got))
+
+		info, err := os.Stat(tool)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+		assert.True(t, testMtime.Equal(info.ModTime()))
+
+		info, err = os.Stat(filepath.Join(remote, "var", "log", "old", "gc.log"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		info, err = os.Stat(filepath.Join(remote, "usr", "local", "bin", "suid"))
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSetuid, info.Mode()&os.ModeSetuid)
+
+		info, err = os.Stat(filepath.Join(remote, "tmp"))
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSticky, info.Mode()&os.ModeSticky)
+
+		target, err := os.Readlink(filepath.Join(remote, "usr", "motd"))
+		require.NoError(t, err)
+		assert.Equal(t, "../etc/motd", target)
+	})
+
+	t.Run("skips unchanged files by size and mtime", func(t *testing.T) {
+		t.Parallel()
+
+		source := writeTestTree(t)
+		remote := t.TempDir()
+		client := newClient()
+
+		var opts ssh.DirOpts
+		require.NoError(t, client.UploadDir(context.Background(), source, remote, opts))
+
+		// Same size and mtime, different contents: only a hash tells them apart.
+		motd := filepath.Join(remote, "etc", "motd")
+		require.NoError(t, os.WriteFile(motd, []byte("CONTENTS OF etc/motd"), 0o644))
+		require.NoError(t, os.Chtimes(motd, testMtime, testMtime))
+
+		require.NoError(t, client.UploadDir(context.Background(), source, remote, opts))
+		got, err := os.ReadFile(motd)
+		require.NoError(t, err)
+		assert.Equal(t, "CONTENTS OF etc/motd", string(got))
+
+		opts.Compare = ssh.CompareHash
+		require.NoError(t, client.UploadDir(context.Background(), source, remote, opts))
+		got, err = os.ReadFile(motd)
+		require.NoError(t, err)
+		assert.Equal(t, "contents of etc/motd", string(got))
+	})
+
+	t.Run("replaces a symlinked directory instead of following it", func(t *testing.T) {
+		t.Parallel()
+
+		source := writeTestTree(t)
+		remote := t.TempDir()
+		elsewhere := t.TempDir()
+		require.NoError(t, os.Symlink(elsewhere, filepath.Join(remote, "etc")))
+
+		var opts ssh.DirOpts
+		require.NoError(t, newClient().UploadDir(context.Background(), source, remote, opts))
+
+		info, err := os.Lstat(filepath.Join(remote, "etc"))
+		require.NoError(t, err)
+		assert.True(t, info.IsDir())
+		assert.FileExists(t, filepath.Join(remote, "etc", "motd"))
+		assert.NoFileExists(t, filepath.Join(elsewhere, "motd"))
+	})
+
+	t.Run("fails when the source is not a directory", func(t *testing.T) {
+		t.Parallel()
+
+		file := filepath.Join(writeTestTree(t), "etc", "motd")
+
+		var opts ssh.DirOpts
+		err := newClient().UploadDir(context.Background(), file, t.TempDir(), opts)
+		require.ErrorIs(t, err, ssh.ErrNotDirectory)
+	})
+}
+
+func TestDownloadDir(t *testing.T) {
+	t.Parallel()
+
+	host, port := startTestServer(t, openServerConfig(), echoHandler)
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+	t.Cleanup(func() { _ = client.Close() })
+
+	remote := writeTestTree(t)
+	local := filepath.Join(t.TempDir(), "logs")
+
+	var opts ssh.DirOpts
+	opts.Include = []string{"*.log"}
+	opts.Exclude = []string{"log/old"}
+	require.NoError(t, client.DownloadDir(context.Background(), filepath.Join(remote, "var"), local, opts))
+
+	got, err := os.ReadFile(filepath.Join(local, "log", "build.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "contents of var/log/build.log", string(got))
+
+	info, err := os.Stat(filepath.Join(local, "log", "build.log"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	assert.True(t, testMtime.Equal(info.ModTime()))
+
+	assert.NoDirExists(t, filepath.Join(local, "log", "old"))
+}
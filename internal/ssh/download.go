@@ -0,0 +1,408 @@
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultChunkSize is the size of the ranges a download fetches.
+	DefaultChunkSize = 8 << 20
+
+	// DefaultParallel is how many ranges a download fetches at once.
+	DefaultParallel = 4
+
+	// PartSuffix marks a download in progress; it is resumed from there.
+	PartSuffix = ".part"
+
+	// ChunksSuffix, appended to a .part file's name, names the sidecar that
+	// records which chunks of it are complete.
+	ChunksSuffix = ".chunks"
+
+	// chunksHeader identifies the remote file and chunk size a sidecar's
+	// chunk indexes refer to.
+	chunksHeader = "blackbsd-download size=%d mtime=%d chunk=%d\n"
+)
+
+// ErrChecksumMismatch is wrapped when a downloaded file does not match the
+// expected SHA-256 checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// DownloadProgress is a snapshot of a running download. Done includes bytes
+// resumed from an earlier attempt; the rate and ETA only count this one.
+type DownloadProgress struct {
+	Path           string
+	Done           int64
+	Total          int64
+	BytesPerSecond float64
+	ETA            time.Duration
+}
+
+// DownloadOpts configures Download. SHA256, the expected hex digest, is
+// checked before the file is moved into place; empty skips the check. Zero
+// ChunkSize and Parallel use DefaultChunkSize and DefaultParallel. Progress
+// is called after every chunk, one call at a time.
+type DownloadOpts struct {
+	Progress  func(DownloadProgress)
+	SHA256    string
+	ChunkSize int64
+	Parallel  int
+}
+
+// DownloadFile transfers a remote file to the local filesystem via SFTP with
+// the default DownloadOpts.
+func (c *Client) DownloadFile(ctx context.Context, remotePath, localPath string) error {
+	var opts DownloadOpts
+	return c.Download(ctx, remotePath, localPath, opts)
+}
+
+// Download transfers a remote file to localPath via SFTP. The data goes to
+// <localPath>.part first, fetched in chunks over parallel SFTP requests, and
+// every chunk written is recorded in a <localPath>.part.chunks sidecar. A
+// .part file left by an interrupted download is resumed by fetching only the
+// chunks its sidecar does not record; without a matching sidecar it starts
+// over. Only once the whole file matches opts.SHA256 is it renamed into
+// place; on a mismatch the .part file is removed so the next attempt starts
+// over.
+func (c *Client) Download(ctx context.Context, remotePath, localPath string, opts DownloadOpts) error {
+	expandedLocal := filepath.Clean(expandPath(localPath))
+
+	sftpClient, err := c.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	info, err := sftpClient.Stat(remotePath)
+	if err != nil {
+		return &Error{Message: "stat remote file", Err: err}
+	}
+
+	partPath := expandedLocal + PartSuffix
+	transfer, err := openTransfer(partPath, remotePath, info, opts)
+	if err != nil {
+		return err
+	}
+
+	if err = errors.Join(transfer.run(ctx, sftpClient), transfer.close()); err != nil {
+		return err
+	}
+
+	if err = verifySHA256(partPath, opts.SHA256); err != nil {
+		if errors.Is(err, ErrChecksumMismatch) {
+			transfer.discard()
+		}
+		return err
+	}
+
+	if err = os.Rename(partPath, expandedLocal); err != nil {
+		return &Error{Message: "move downloaded file into place", Err: err}
+	}
+
+	transfer.finish()
+	return nil
+}
+
+// transfer fetches the chunks of one download that are not on disk yet.
+type transfer struct {
+	started  time.Time
+	progress func(DownloadProgress)
+	part     *os.File
+	chunks   *os.File
+	remote   string
+	done     []bool
+	total    int64
+	resumed  int64
+	fetched  int64
+	chunk    int64
+	parallel int
+	mu       sync.Mutex
+}
+
+// openTransfer opens the part file and chunk sidecar for downloading the
+// remote file described by info, picking up the chunks an earlier attempt
+// recorded.
+func openTransfer(partPath, remotePath string, info os.FileInfo, opts DownloadOpts) (*transfer, error) {
+	chunk := opts.ChunkSize
+	if chunk <= 0 {
+		chunk = DefaultChunkSize
+	}
+
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+
+	part, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, downloadFilePermissions)
+	if err != nil {
+		return nil, &Error{Message: "create local file", Err: err}
+	}
+
+	header := fmt.Sprintf(chunksHeader, info.Size(), info.ModTime().UnixNano(), chunk)
+	done, chunks, err := openChunks(part, partPath+ChunksSuffix, header, (info.Size()+chunk-1)/chunk)
+	if err != nil {
+		CloseQuietly(part)
+		return nil, err
+	}
+
+	transfer := &transfer{
+		started:  time.Now(),
+		progress: opts.Progress,
+		part:     part,
+		chunks:   chunks,
+		remote:   remotePath,
+		done:     done,
+		total:    info.Size(),
+		resumed:  0,
+		fetched:  0,
+		chunk:    chunk,
+		parallel: 0,
+		mu:       sync.Mutex{},
+	}
+
+	pending := 0
+	for index, complete := range done {
+		if complete {
+			transfer.resumed += transfer.chunkSize(index)
+		} else {
+			pending++
+		}
+	}
+	transfer.parallel = min(parallel, max(pending, 1))
+
+	if transfer.resumed > 0 {
+		slog.Info("resuming download", "path", partPath, "done", transfer.resumed, "size", transfer.total)
+	}
+	return transfer, nil
+}
+
+// openChunks returns which of count chunks the sidecar at path records as
+// written to part, and the sidecar opened for recording more. A sidecar with
+// another header was written for a different remote file or chunk size, and
+// without one nothing in part can be trusted: either way part is emptied
+// and the sidecar started afresh.
+func openChunks(part *os.File, path, header string, count int64) ([]bool, *os.File, error) {
+	done := make([]bool, count)
+
+	if recorded, ok := readChunks(path, header, count); ok {
+		chunks, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_APPEND, downloadFilePermissions)
+		if err != nil {
+			return nil, nil, &Error{Message: "open chunk record", Err: err}
+		}
+		for _, index := range recorded {
+			done[index] = true
+		}
+		return done, chunks, nil
+	}
+
+	if err := part.Truncate(0); err != nil {
+		return nil, nil, &Error{Message: "truncate partial file", Err: err}
+	}
+
+	chunks, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, downloadFilePermissions)
+	if err != nil {
+		return nil, nil, &Error{Message: "create chunk record", Err: err}
+	}
+
+	if _, err = io.WriteString(chunks, header); err != nil {
+		CloseQuietly(chunks)
+		return nil, nil, &Error{Message: "write chunk record", Err: err}
+	}
+	return done, chunks, nil
+}
+
+// readChunks parses the sidecar at path, returning the chunk indexes it
+// records when its header matches. A last line cut short by an interrupted
+// write has no newline and is ignored.
+func readChunks(path, header string, count int64) ([]int64, bool) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, false
+	}
+
+	records, found := strings.CutPrefix(string(data), header)
+	if !found {
+		return nil, false
+	}
+
+	var recorded []int64
+	for len(records) > 0 {
+		line, rest, complete := strings.Cut(records, "\n")
+		if !complete {
+			break
+		}
+		records = rest
+
+		index, parseErr := strconv.ParseInt(line, 10, 64)
+		if parseErr != nil || index < 0 || index >= count {
+			return nil, false
+		}
+		recorded = append(recorded, index)
+	}
+	return recorded, true
+}
+
+// run fetches the chunks not written yet concurrently.
+func (t *transfer) run(ctx context.Context, sftpClient *sftp.Client) error {
+	chunks := make(chan int, len(t.done))
+	for index, done := range t.done {
+		if !done {
+			chunks <- index
+		}
+	}
+	close(chunks)
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	for range t.parallel {
+		group.Go(func() error { return t.worker(groupCtx, sftpClient, chunks) })
+	}
+	return group.Wait()
+}
+
+func (t *transfer) worker(ctx context.Context, sftpClient *sftp.Client, chunks <-chan int) error {
+	remote, err := sftpClient.Open(t.remote)
+	if err != nil {
+		return &Error{Message: "open remote file", Err: err}
+	}
+	defer CloseQuietly(remote)
+
+	buf := make([]byte, t.chunk)
+	for index := range chunks {
+		if err = ctx.Err(); err != nil {
+			return &Error{Message: "download file", Err: err}
+		}
+
+		if err = t.fetch(remote, buf, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *transfer) fetch(remote *sftp.File, buf []byte, index int) error {
+	offset := int64(index) * t.chunk
+	data := buf[:t.chunkSize(index)]
+
+	// A short read means the remote file shrank under us.
+	read, err := remote.ReadAt(data, offset)
+	if err != nil && (!errors.Is(err, io.EOF) || read < len(data)) {
+		return &Error{Message: fmt.Sprintf("download file at offset %d", offset), Err: err}
+	}
+
+	if _, err := t.part.WriteAt(data, offset); err != nil {
+		return &Error{Message: "write local file", Err: err}
+	}
+
+	return t.complete(index, int64(len(data)))
+}
+
+// chunkSize returns the length of chunk index; only the last one is short.
+func (t *transfer) chunkSize(index int) int64 {
+	return min(t.chunk, t.total-int64(index)*t.chunk)
+}
+
+// complete records a written chunk in the sidecar and reports progress. The
+// chunk is recorded only after its data was written, so a process killed in
+// between leaves it to be fetched again.
+func (t *transfer) complete(index int, size int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := fmt.Fprintf(t.chunks, "%d\n", index); err != nil {
+		return &Error{Message: "record downloaded chunk", Err: err}
+	}
+
+	t.done[index] = true
+	t.fetched += size
+
+	if t.progress == nil {
+		return nil
+	}
+
+	elapsed := time.Since(t.started).Seconds()
+	update := DownloadProgress{
+		Path:           t.part.Name(),
+		Done:           t.resumed + t.fetched,
+		Total:          t.total,
+		BytesPerSecond: 0,
+		ETA:            0,
+	}
+	if elapsed > 0 {
+		update.BytesPerSecond = float64(t.fetched) / elapsed
+		remaining := float64(t.total - update.Done)
+		update.ETA = time.Duration(remaining / update.BytesPerSecond * float64(time.Second))
+	}
+	t.progress(update)
+	return nil
+}
+
+// close closes the part file and its sidecar, which are kept for resuming.
+func (t *transfer) close() error {
+	partErr := t.part.Close()
+	chunksErr := t.chunks.Close()
+	if err := errors.Join(partErr, chunksErr); err != nil {
+		return &Error{Message: "close local file", Err: err}
+	}
+	return nil
+}
+
+// discard removes the part file and its sidecar so the next attempt starts
+// over.
+func (t *transfer) discard() {
+	_ = os.Remove(t.part.Name())
+	_ = os.Remove(t.chunks.Name())
+}
+
+// finish removes the sidecar of a download moved into place.
+func (t *transfer) finish() {
+	if err := os.Remove(t.chunks.Name()); err != nil {
+		slog.Warn("remove chunk record", "path", t.chunks.Name(), "error", err)
+	}
+	t.logDone()
+}
+
+func (t *transfer) logDone() {
+	elapsed := time.Since(t.started)
+	slog.Info("download complete", "path", strings.TrimSuffix(t.part.Name(), PartSuffix), "size", t.total,
+		"fetched", t.fetched, "duration", elapsed.Round(time.Millisecond))
+}
+
+// verifySHA256 checks the file at path against want, a hex SHA-256 digest.
+func verifySHA256(path, want string) error {
+	if want == "" {
+		return nil
+	}
+
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return &Error{Message: "open downloaded file", Err: err}
+	}
+	defer CloseQuietly(file)
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return &Error{Message: "hash downloaded file", Err: err}
+	}
+
+	got := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return &Error{
+			Message: "verify " + path,
+			Err:     fmt.Errorf("%w: expected sha256 %s, got %s", ErrChecksumMismatch, want, got),
+		}
+	}
+	return nil
+}
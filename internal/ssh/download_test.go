@@ -0,0 +1,168 @@
+package ssh_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRemoteFile writes size bytes of a repeating pattern to a file served
+// by the test server and returns its path, contents and hex SHA-256.
+func writeRemoteFile(t *testing.T, size int) (string, []byte, string) {
+	t.Helper()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+	path := filepath.Join(t.TempDir(), "remote.img")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	sum := sha256.Sum256(data)
+	return path, data, hex.EncodeToString(sum[:])
+}
+
+func TestDownload(t *testing.T) {
+	t.Parallel()
+
+	host, port := startTestServer(t, openServerConfig(), echoHandler)
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	newClient := func() *ssh.Client {
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("fetches chunks in parallel and verifies the checksum", func(t *testing.T) {
+		t.Parallel()
+
+		remote, data, sum := writeRemoteFile(t, 10_000)
+		local := filepath.Join(t.TempDir(), "local.img")
+
+		var mu sync.Mutex
+		var last ssh.DownloadProgress
+		var opts ssh.DownloadOpts
+		opts.SHA256 = sum
+		opts.ChunkSize = 1024
+		opts.Parallel = 4
+		opts.Progress = func(progress ssh.DownloadProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			last = progress
+		}
+
+		require.NoError(t, newClient().Download(context.Background(), remote, local, opts))
+
+		got, err := os.ReadFile(local)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+		assert.NoFileExists(t, local+ssh.PartSuffix)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, int64(len(data)), last.Done)
+		assert.Equal(t, int64(len(data)), last.Total)
+	})
+
+	t.Run("resumes only the chunks recorded as written", func(t *testing.T) {
+		t.Parallel()
+
+		remote, data, _ := writeRemoteFile(t, 5000)
+		local := filepath.Join(t.TempDir(), "local.img")
+		client := newClient()
+
+		// Interrupt the download once its first chunk is recorded.
+		ctx, cancel := context.WithCancel(context.Background())
+		var opts ssh.DownloadOpts
+		opts.ChunkSize = 1000
+		opts.Parallel = 1
+		opts.Progress = func(ssh.DownloadProgress) { cancel() }
+		require.ErrorIs(t, client.Download(ctx, remote, local, opts), context.Canceled)
+		assert.FileExists(t, local+ssh.PartSuffix+ssh.ChunksSuffix)
+
+		// A marker in the recorded chunk proves it is not fetched again.
+		part, err := os.OpenFile(local+ssh.PartSuffix, os.O_WRONLY, 0)
+		require.NoError(t, err)
+		marker := bytes.Repeat([]byte("X"), 1000)
+		_, err = part.WriteAt(marker, 0)
+		require.NoError(t, err)
+		require.NoError(t, part.Close())
+
+		opts.Progress = nil
+		require.NoError(t, client.Download(context.Background(), remote, local, opts))
+
+		got, err := os.ReadFile(local)
+		require.NoError(t, err)
+		assert.Equal(t, marker, got[:len(marker)])
+		assert.Equal(t, data[len(marker):], got[len(marker):])
+		assert.NoFileExists(t, local+ssh.PartSuffix+ssh.ChunksSuffix)
+	})
+
+	t.Run("starts over from a partial file without a chunk record", func(t *testing.T) {
+		t.Parallel()
+
+		remote, data, _ := writeRemoteFile(t, 5000)
+		local := filepath.Join(t.TempDir(), "local.img")
+
+		// Written out of order by a killed process, the part file may have
+		// holes anywhere, so none of it is trusted even without a checksum.
+		require.NoError(t, os.WriteFile(local+ssh.PartSuffix, bytes.Repeat([]byte("X"), 2048), 0o600))
+
+		var opts ssh.DownloadOpts
+		opts.ChunkSize = 1000
+		require.NoError(t, newClient().Download(context.Background(), remote, local, opts))
+
+		got, err := os.ReadFile(local)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+	})
+
+	t.Run("restarts when the partial file is larger than the remote", func(t *testing.T) {
+		t.Parallel()
+
+		remote, data, sum := writeRemoteFile(t, 3000)
+		local := filepath.Join(t.TempDir(), "local.img")
+		require.NoError(t, os.WriteFile(local+ssh.PartSuffix, bytes.Repeat([]byte("X"), 4000), 0o600))
+
+		var opts ssh.DownloadOpts
+		opts.SHA256 = sum
+		require.NoError(t, newClient().Download(context.Background(), remote, local, opts))
+
+		got, err := os.ReadFile(local)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+	})
+
+	t.Run("removes the partial file on a checksum mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		remote, _, _ := writeRemoteFile(t, 3000)
+		local := filepath.Join(t.TempDir(), "local.img")
+
+		var opts ssh.DownloadOpts
+		opts.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+		err := newClient().Download(context.Background(), remote, local, opts)
+		require.ErrorIs(t, err, ssh.ErrChecksumMismatch)
+
+		assert.NoFileExists(t, local)
+		assert.NoFileExists(t, local+ssh.PartSuffix)
+		assert.NoFileExists(t, local+ssh.PartSuffix+ssh.ChunksSuffix)
+	})
+
+	t.Run("fails for a missing remote file", func(t *testing.T) {
+		t.Parallel()
+
+		local := filepath.Join(t.TempDir(), "local.img")
+		err := newClient().DownloadFile(context.Background(), filepath.Join(t.TempDir(), "missing"), local)
+		require.Error(t, err)
+		assert.NoFileExists(t, local)
+	})
+}
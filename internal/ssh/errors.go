@@ -1,7 +1,13 @@
 // Package ssh provides an SSH client wrapper using golang.org/x/crypto/ssh.
 package ssh
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotReady is wrapped by WaitForReady when the host never accepts SSH.
+var ErrNotReady = errors.New("host not ready")
 
 // Error is the base error for SSH operations.
 type Error struct {
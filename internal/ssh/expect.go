@@ -0,0 +1,234 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultStepTimeout bounds a step that sets no Timeout.
+	DefaultStepTimeout = 30 * time.Second
+
+	// ScreenLines is how much trailing output an ExpectError reports.
+	ScreenLines = 24
+
+	// expectBufferSize caps the unmatched output kept for matching; older
+	// output is dropped, so patterns should match near the latest prompt.
+	expectBufferSize = 64 << 10
+)
+
+// ErrExpectTimeout is wrapped when a step's pattern does not appear within
+// its timeout.
+var ErrExpectTimeout = errors.New("expected output did not appear")
+
+// ansiEscape matches the terminal control sequences curses programs such as
+// sysinst draw with, which are dropped from reported screens.
+var ansiEscape = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|[()][0-9A-Za-z]|[=>78])`)
+
+// Terminal is the interactive stream an expect script runs against: the PTY
+// of a remote command, a serial console, or an in-memory stand-in in tests.
+// Reads return output as it appears; writes are typed input.
+type Terminal interface {
+	io.Reader
+	io.Writer
+}
+
+// Step is one exchange of an expect script: wait until Expect matches the
+// output that arrived since the previous match, then type Send. A nil Expect
+// sends right away. Zero Timeout uses DefaultStepTimeout.
+type Step struct {
+	Expect  *regexp.Regexp
+	Send    string
+	Timeout time.Duration
+}
+
+// ExpectError reports a step whose pattern did not match, with the last
+// ScreenLines lines of output to show what the terminal displayed instead.
+type ExpectError struct {
+	Err     error
+	Pattern string
+	Screen  string
+	Step    int
+}
+
+func (e *ExpectError) Error() string {
+	return fmt.Sprintf("expect step %d (%s): %v; last output:\n%s", e.Step+1, e.Pattern, e.Err, e.Screen)
+}
+
+func (e *ExpectError) Unwrap() error {
+	return e.Err
+}
+
+// Expecter runs expect scripts against a Terminal. It reads the terminal in
+// the background from creation until the terminal reaches EOF, so output is
+// never left unread between steps.
+type Expecter struct {
+	terminal   Terminal
+	transcript io.Writer
+	changed    chan struct{}
+	done       chan struct{}
+	readErr    error
+	pending    []byte
+	screen     []byte
+	mu         sync.Mutex
+}
+
+// NewExpecter starts reading terminal. Everything read is also written to
+// transcript when it is not nil.
+func NewExpecter(terminal Terminal, transcript io.Writer) *Expecter {
+	expecter := &Expecter{
+		terminal:   terminal,
+		transcript: transcript,
+		changed:    make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		readErr:    nil,
+		pending:    nil,
+		screen:     nil,
+		mu:         sync.Mutex{},
+	}
+	go expecter.read()
+	return expecter
+}
+
+// Run executes the steps of script in order and stops at the first one
+// that fails, returning an *ExpectError.
+func (e *Expecter) Run(ctx context.Context, script []Step) error {
+	for index, step := range script {
+		if err := e.expect(ctx, step); err != nil {
+			pattern := "<none>"
+			if step.Expect != nil {
+				pattern = step.Expect.String()
+			}
+			return &ExpectError{Err: err, Pattern: pattern, Screen: e.Screen(), Step: index}
+		}
+
+		if step.Send == "" {
+			continue
+		}
+		if _, err := io.WriteString(e.terminal, step.Send); err != nil {
+			return &ExpectError{Err: fmt.Errorf("send: %w", err), Pattern: "", Screen: e.Screen(), Step: index}
+		}
+	}
+	return nil
+}
+
+// Done is closed once the terminal has reached EOF or failed and all its
+// output has been read.
+func (e *Expecter) Done() <-chan struct{} {
+	return e.done
+}
+
+// Screen returns the last ScreenLines lines of output without terminal
+// control sequences.
+func (e *Expecter) Screen() string {
+	e.mu.Lock()
+	raw := string(e.screen)
+	e.mu.Unlock()
+
+	text := ansiEscape.ReplaceAllString(raw, "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > ScreenLines {
+		lines = lines[len(lines)-ScreenLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// expect waits for step.Expect to match the pending output and consumes the
+// output up to the end of the match.
+func (e *Expecter) expect(ctx context.Context, step Step) error {
+	if step.Expect == nil {
+		return nil
+	}
+
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = DefaultStepTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		matched, readErr := e.match(step.Expect)
+		if matched {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("terminal closed: %w", readErr)
+		}
+
+		select {
+		case <-e.changed:
+		case <-timer.C:
+			return fmt.Errorf("%w after %s", ErrExpectTimeout, timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *Expecter) match(pattern *regexp.Regexp) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if loc := pattern.FindIndex(e.pending); loc != nil {
+		e.pending = e.pending[loc[1]:]
+		return true, nil
+	}
+	return false, e.readErr
+}
+
+func (e *Expecter) read() {
+	defer close(e.done)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := e.terminal.Read(buf)
+		if n > 0 {
+			e.append(buf[:n])
+		}
+		if err != nil {
+			e.mu.Lock()
+			e.readErr = err
+			e.mu.Unlock()
+			e.notify()
+			return
+		}
+	}
+}
+
+func (e *Expecter) append(data []byte) {
+	if e.transcript != nil {
+		_, _ = e.transcript.Write(data)
+	}
+
+	e.mu.Lock()
+	e.pending = keepTail(append(e.pending, data...), expectBufferSize)
+	e.screen = keepTail(append(e.screen, data...), expectBufferSize)
+	e.mu.Unlock()
+	e.notify()
+}
+
+func (e *Expecter) notify() {
+	select {
+	case e.changed <- struct{}{}:
+	default:
+	}
+}
+
+// keepTail returns the last limit bytes of data.
+func keepTail(data []byte, limit int) []byte {
+	if len(data) <= limit {
+		return data
+	}
+	return bytes.Clone(data[len(data)-limit:])
+}
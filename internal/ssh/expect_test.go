@@ -0,0 +1,207 @@
+package ssh_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTerminal is an in-memory stand-in for a PTY: the program side writes
+// output and reads what the script types.
+type fakeTerminal struct {
+	output *io.PipeReader
+	input  *io.PipeWriter
+}
+
+func (f *fakeTerminal) Read(data []byte) (int, error)  { return f.output.Read(data) }
+func (f *fakeTerminal) Write(data []byte) (int, error) { return f.input.Write(data) }
+
+// startFakeTerminal runs program against a fakeTerminal, closing the output
+// when program returns.
+func startFakeTerminal(t *testing.T, program func(out io.Writer, in *bufio.Reader)) *fakeTerminal {
+	t.Helper()
+
+	outputReader, outputWriter := io.Pipe()
+	inputReader, inputWriter := io.Pipe()
+	t.Cleanup(func() {
+		_ = inputWriter.Close()
+		_ = outputReader.Close()
+	})
+
+	go func() {
+		program(outputWriter, bufio.NewReader(inputReader))
+		_ = outputWriter.Close()
+	}()
+
+	return &fakeTerminal{output: outputReader, input: inputWriter}
+}
+
+// installer asks a sysinst-like sequence of questions and echoes the answers.
+func installer(out io.Writer, in *bufio.Reader) {
+	for _, prompt := range []string{"\x1b[2J\x1b[1;1HInstall NetBSD? [y/n] ", "Disk to use: "} {
+		_, _ = io.WriteString(out, prompt)
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		_, _ = fmt.Fprintf(out, "%s\r\n", strings.TrimSpace(answer))
+	}
+	_, _ = io.WriteString(out, "Installation complete.\r\n")
+}
+
+func installScript() []ssh.Step {
+	return []ssh.Step{
+		{Expect: regexp.MustCompile(`Install NetBSD\? \[y/n\]`), Send: "y\n", Timeout: time.Second},
+		{Expect: regexp.MustCompile(`Disk to use: `), Send: "wd0\n", Timeout: time.Second},
+		{Expect: regexp.MustCompile(`complete\.`), Send: "", Timeout: time.Second},
+	}
+}
+
+func TestExpecter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("answers prompts and captures the transcript", func(t *testing.T) {
+		t.Parallel()
+
+		var transcript bytes.Buffer
+		expecter := ssh.NewExpecter(startFakeTerminal(t, installer), &transcript)
+
+		require.NoError(t, expecter.Run(context.Background(), installScript()))
+		<-expecter.Done()
+
+		assert.Contains(t, transcript.String(), "Disk to use: wd0\r\n")
+		assert.True(t, strings.HasSuffix(expecter.Screen(), "Installation complete."))
+	})
+
+	t.Run("reports the last screen on a timeout", func(t *testing.T) {
+		t.Parallel()
+
+		expecter := ssh.NewExpecter(startFakeTerminal(t, installer), nil)
+		script := []ssh.Step{
+			{Expect: regexp.MustCompile(`Install NetBSD`), Send: "y\n", Timeout: time.Second},
+			{Expect: regexp.MustCompile(`Keyboard type`), Send: "", Timeout: 50 * time.Millisecond},
+		}
+
+		err := expecter.Run(context.Background(), script)
+		require.ErrorIs(t, err, ssh.ErrExpectTimeout)
+
+		var expectErr *ssh.ExpectError
+		require.ErrorAs(t, err, &expectErr)
+		assert.Equal(t, 1, expectErr.Step)
+		assert.Equal(t, "Keyboard type", expectErr.Pattern)
+		assert.Equal(t, "Install NetBSD? [y/n] y\nDisk to use: ", expectErr.Screen)
+		assert.Contains(t, err.Error(), "Disk to use:")
+	})
+
+	t.Run("fails when the terminal closes first", func(t *testing.T) {
+		t.Parallel()
+
+		expecter := ssh.NewExpecter(startFakeTerminal(t, func(out io.Writer, _ *bufio.Reader) {
+			_, _ = io.WriteString(out, "panic: boot failed\r\n")
+		}), nil)
+
+		err := expecter.Run(context.Background(), installScript())
+		require.ErrorIs(t, err, io.EOF)
+		assert.Contains(t, err.Error(), "panic: boot failed")
+	})
+
+	t.Run("stops when the context ends", func(t *testing.T) {
+		t.Parallel()
+
+		expecter := ssh.NewExpecter(startFakeTerminal(t, func(_ io.Writer, in *bufio.Reader) {
+			_, _ = in.ReadString('\n')
+		}), nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := expecter.Run(ctx, installScript())
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("keeps only the last lines of the screen", func(t *testing.T) {
+		t.Parallel()
+
+		expecter := ssh.NewExpecter(startFakeTerminal(t, func(out io.Writer, _ *bufio.Reader) {
+			for i := 1; i <= 100; i++ {
+				_, _ = fmt.Fprintf(out, "line %d\r\n", i)
+			}
+		}), nil)
+		<-expecter.Done()
+
+		lines := strings.Split(expecter.Screen(), "\n")
+		assert.Len(t, lines, ssh.ScreenLines)
+		assert.Equal(t, "line 100", lines[len(lines)-1])
+	})
+}
+
+// lockedBuffer is a bytes.Buffer safe for a writer and a reader goroutine.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (l *lockedBuffer) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(data)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+func TestExecExpect(t *testing.T) {
+	t.Parallel()
+
+	handler := func(_ string, stdin io.Reader, stdout, _ io.Writer) uint32 {
+		installer(stdout, bufio.NewReader(stdin))
+		return 0
+	}
+	host, port := startTestServer(t, openServerConfig(), handler)
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	newClient := func() *ssh.Client {
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port).WithPtySize(132, 50)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("drives the command through its prompts", func(t *testing.T) {
+		t.Parallel()
+
+		var transcript lockedBuffer
+		result, err := newClient().ExecExpect(context.Background(), "sysinst", installScript(), &transcript)
+		require.NoError(t, err)
+
+		assert.Equal(t, 0, result.ExitCode)
+		assert.Contains(t, result.Stdout, "Installation complete.")
+		assert.Equal(t, result.Stdout, transcript.String())
+	})
+
+	t.Run("stops the command when a step fails", func(t *testing.T) {
+		t.Parallel()
+
+		script := []ssh.Step{{Expect: regexp.MustCompile(`Keyboard type`), Send: "", Timeout: 50 * time.Millisecond}}
+		result, err := newClient().ExecExpect(context.Background(), "sysinst", script, nil)
+
+		var expectErr *ssh.ExpectError
+		require.ErrorAs(t, err, &expectErr)
+		assert.Contains(t, expectErr.Screen, "Install NetBSD? [y/n]")
+		assert.Contains(t, result.Stdout, "Install NetBSD?")
+	})
+}
@@ -1,3 +1,19 @@
 package ssh
 
 var ExpandPath = expandPath
+
+func (c *Client) AddrForTest() string {
+	return c.addr()
+}
+
+// DropConnectionForTest closes the shared connection behind the client's back,
+// as a network failure would.
+func (c *Client) DropConnectionForTest() {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn != nil {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,149 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// Forward is a port forward started by ForwardLocal or ForwardRemote. It
+// runs until the context it was started with is canceled or Close is called;
+// either closes the listener and every connection passing through it.
+type Forward struct {
+	listener net.Listener
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Addr returns the address the forward listens on, which tells the port
+// picked for a listen address with port 0.
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Done is closed once the forward has stopped, also when its listener fails,
+// as a remote listener does when the connection drops.
+func (f *Forward) Done() <-chan struct{} {
+	return f.done
+}
+
+// Close stops the forward and waits for its connections to close.
+func (f *Forward) Close() error {
+	f.cancel()
+	<-f.done
+	return nil
+}
+
+// ForwardLocal listens on localAddr and forwards every connection to
+// remoteAddr as dialed from the remote host, like ssh -L. Connections are
+// opened through DialContext, so a dropped SSH connection is re-established
+// for the next one.
+func (c *Client) ForwardLocal(ctx context.Context, localAddr, remoteAddr string) (*Forward, error) {
+	var config net.ListenConfig
+	listener, err := config.Listen(ctx, "tcp", localAddr)
+	if err != nil {
+		return nil, &Error{Message: "listen on " + localAddr, Err: err}
+	}
+
+	slog.Info("forwarding local port", "listen", listener.Addr().String(), "remote", remoteAddr, "host", c.host)
+	return serveForward(ctx, listener, func(ctx context.Context) (net.Conn, error) {
+		return c.DialContext(ctx, "tcp", remoteAddr)
+	}), nil
+}
+
+// ForwardRemote asks the remote host to listen on remoteAddr and forwards
+// every connection to localAddr as dialed from here, like ssh -R. The remote
+// listener lives on the current connection: if that drops, the forward
+// stops and Done is closed.
+func (c *Client) ForwardRemote(ctx context.Context, remoteAddr, localAddr string) (*Forward, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := conn.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, &Error{Message: "listen on remote " + remoteAddr, Err: err}
+	}
+
+	slog.Info("forwarding remote port", "listen", listener.Addr().String(), "local", localAddr, "host", c.host)
+	return serveForward(ctx, listener, func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", localAddr)
+	}), nil
+}
+
+// serveForward accepts connections on listener and pipes each to a
+// connection from dial until ctx is canceled.
+func serveForward(
+	ctx context.Context,
+	listener net.Listener,
+	dial func(context.Context) (net.Conn, error),
+) *Forward {
+	forwardCtx, cancel := context.WithCancel(ctx)
+	forward := &Forward{listener: listener, cancel: cancel, done: make(chan struct{})}
+	context.AfterFunc(forwardCtx, func() { CloseQuietly(listener) })
+
+	go func() {
+		defer close(forward.done)
+
+		var conns sync.WaitGroup
+		defer conns.Wait()
+		defer cancel()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if forwardCtx.Err() == nil {
+					slog.Warn("port forward stopped", "listen", listener.Addr().String(), "error", err)
+				}
+				return
+			}
+			conns.Go(func() { pipeForward(forwardCtx, conn, dial) })
+		}
+	}()
+
+	return forward
+}
+
+// pipeForward copies between conn and a connection from dial in both
+// directions, passing on half-closes, until both are done or ctx ends.
+func pipeForward(ctx context.Context, conn net.Conn, dial func(context.Context) (net.Conn, error)) {
+	defer CloseQuietly(conn)
+
+	target, err := dial(ctx)
+	if err != nil {
+		slog.Warn("port forward connection failed", "from", conn.RemoteAddr().String(), "error", err)
+		return
+	}
+	defer CloseQuietly(target)
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+		_ = target.Close()
+	})
+	defer stop()
+
+	upstream := make(chan struct{})
+	go func() {
+		defer close(upstream)
+		_, _ = io.Copy(target, conn)
+		closeWrite(target)
+	}()
+
+	_, _ = io.Copy(conn, target)
+	closeWrite(conn)
+	<-upstream
+}
+
+// closeWrite signals EOF to the peer of conn while still reading from it,
+// for connections that support half-closing.
+func closeWrite(conn net.Conn) {
+	if halfCloser, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = halfCloser.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
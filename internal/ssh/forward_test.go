@@ -0,0 +1,135 @@
+package ssh_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startEchoListener runs a TCP server that echoes everything back and
+// half-closes once its peer has, returning the address to dial.
+func startEchoListener(t *testing.T) string {
+	t.Helper()
+
+	var config net.ListenConfig
+	listener, err := config.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = io.Copy(conn, conn)
+				if tcpConn, ok := conn.(*net.TCPConn); ok {
+					_ = tcpConn.CloseWrite()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// roundTrip sends message through addr, half-closes and returns the reply.
+func roundTrip(t *testing.T, addr, message string) string {
+	t.Helper()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	_, err = io.WriteString(conn, message)
+	require.NoError(t, err)
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	require.True(t, ok)
+	require.NoError(t, tcpConn.CloseWrite())
+
+	reply, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(reply)
+}
+
+func TestForward(t *testing.T) {
+	t.Parallel()
+
+	host, port := startTestServer(t, openServerConfig(), echoHandler)
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+	echoAddr := startEchoListener(t)
+
+	newClient := func() *ssh.Client {
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("forwards a local port to the remote side", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		forward, err := newClient().ForwardLocal(ctx, "127.0.0.1:0", echoAddr)
+		require.NoError(t, err)
+
+		assert.Equal(t, "ping", roundTrip(t, forward.Addr().String(), "ping"))
+		assert.Equal(t, "pong", roundTrip(t, forward.Addr().String(), "pong"))
+
+		cancel()
+		<-forward.Done()
+
+		var dialer net.Dialer
+		_, err = dialer.DialContext(context.Background(), "tcp", forward.Addr().String())
+		require.Error(t, err)
+	})
+
+	t.Run("forwards a remote port to the local side", func(t *testing.T) {
+		t.Parallel()
+
+		forward, err := newClient().ForwardRemote(context.Background(), "127.0.0.1:0", echoAddr)
+		require.NoError(t, err)
+
+		assert.Equal(t, "hello", roundTrip(t, forward.Addr().String(), "hello"))
+
+		require.NoError(t, forward.Close())
+		select {
+		case <-forward.Done():
+		default:
+			t.Fatal("forward still running after Close")
+		}
+	})
+
+	t.Run("stops a remote forward when the client closes", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient()
+		forward, err := client.ForwardRemote(context.Background(), "127.0.0.1:0", echoAddr)
+		require.NoError(t, err)
+
+		require.NoError(t, client.Close())
+		select {
+		case <-forward.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("forward still running after the connection closed")
+		}
+	})
+
+	t.Run("fails to listen on a bad address", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newClient().ForwardLocal(context.Background(), "256.0.0.1:0", echoAddr)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,211 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Phase names the system a build server is expected to be running. The same
+// address presents different host keys in rescue mode and in installed NetBSD.
+type Phase string
+
+const (
+	// PhaseRescue is the Hetzner rescue system; its host keys change every boot.
+	PhaseRescue Phase = "rescue"
+
+	// PhaseNetBSD is the installed NetBSD system.
+	PhaseNetBSD Phase = "netbsd"
+
+	// PhaseBastion is a jump host build servers are reached through.
+	PhaseBastion Phase = "bastion"
+
+	pinnedMarker = "pinned"
+
+	knownHostsPermissions = 0o600
+	knownHostsDirMode     = 0o700
+)
+
+// ErrHostKeyMismatch is wrapped when a host presents a key other than the one
+// trusted for its current phase.
+var ErrHostKeyMismatch = errors.New("host key mismatch")
+
+// HostKeys is a per-build known_hosts store. Keys are remembered per host and
+// phase: unless a key was pinned, the first key a host presents in a phase is
+// trusted, and any other key in that phase is rejected afterwards. Booting a
+// host into a phase anew, such as a fresh rescue system, must be announced
+// with Expect. A store created by LoadHostKeys is saved after every change.
+type HostKeys struct {
+	known map[hostPhase]knownKey
+	path  string
+	mu    sync.Mutex
+}
+
+type hostPhase struct {
+	host  string
+	phase Phase
+}
+
+type knownKey struct {
+	key    ssh.PublicKey
+	pinned bool
+}
+
+// NewHostKeys returns an empty in-memory store.
+func NewHostKeys() *HostKeys {
+	return &HostKeys{known: make(map[hostPhase]knownKey), path: "", mu: sync.Mutex{}}
+}
+
+// LoadHostKeys returns a store backed by the known_hosts file at path, which
+// need not exist yet. The phase of each entry is kept in its comment.
+func LoadHostKeys(path string) (*HostKeys, error) {
+	store := NewHostKeys()
+	store.path = filepath.Clean(expandPath(path))
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, &Error{Message: "read known hosts", Err: err}
+	}
+
+	for len(bytes.TrimSpace(data)) > 0 {
+		_, hosts, key, comment, rest, parseErr := ssh.ParseKnownHosts(data)
+		if parseErr != nil {
+			return nil, &Error{Message: "parse known hosts " + store.path, Err: parseErr}
+		}
+		data = rest
+
+		fields := strings.Fields(comment)
+		if len(fields) == 0 {
+			continue
+		}
+
+		pinned := len(fields) > 1 && fields[1] == pinnedMarker
+		for _, host := range hosts {
+			store.known[hostPhase{host: host, phase: Phase(fields[0])}] = knownKey{key: key, pinned: pinned}
+		}
+	}
+
+	return store, nil
+}
+
+// Pin trusts only key for host in phase, replacing any key seen before. It is
+// used for host keys the build generates and installs itself.
+func (h *HostKeys) Pin(host string, phase Phase, key ssh.PublicKey) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.known[hostPhase{host: host, phase: phase}] = knownKey{key: key, pinned: true}
+	slog.Info("host key pinned", "host", host, "phase", phase, "fingerprint", ssh.FingerprintSHA256(key))
+	return h.save()
+}
+
+// Expect announces that host is booting into phase with new host keys, so the
+// next key it presents there is trusted on first use. Pinned keys are kept.
+func (h *HostKeys) Expect(host string, phase Phase) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry := hostPhase{host: host, phase: phase}
+	if h.known[entry].pinned {
+		return nil
+	}
+
+	delete(h.known, entry)
+	return h.save()
+}
+
+// Known returns the key trusted for host in phase, if any.
+func (h *HostKeys) Known(host string, phase Phase) (ssh.PublicKey, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	known, ok := h.known[hostPhase{host: host, phase: phase}]
+	return known.key, ok
+}
+
+// Callback returns a host key callback that verifies hosts in phase.
+func (h *HostKeys) Callback(phase Phase) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		return h.verify(hostOnly(hostname), phase, key)
+	}
+}
+
+func (h *HostKeys) verify(host string, phase Phase, key ssh.PublicKey) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry := hostPhase{host: host, phase: phase}
+	known, ok := h.known[entry]
+	if !ok {
+		h.known[entry] = knownKey{key: key, pinned: false}
+		slog.Info("host key trusted on first use", "host", host, "phase", phase,
+			"fingerprint", ssh.FingerprintSHA256(key))
+		return h.save()
+	}
+
+	if sameKey(known.key, key) {
+		return nil
+	}
+
+	return &Error{
+		Message: fmt.Sprintf("verify host key of %s in %s phase", host, phase),
+		Err: fmt.Errorf("%w: expected %s, got %s", ErrHostKeyMismatch,
+			ssh.FingerprintSHA256(known.key), ssh.FingerprintSHA256(key)),
+	}
+}
+
+// save writes the store to its file; the caller holds the lock.
+func (h *HostKeys) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	lines := make([]string, 0, len(h.known))
+	for entry, known := range h.known {
+		comment := string(entry.phase)
+		if known.pinned {
+			comment += " " + pinnedMarker
+		}
+		lines = append(lines, knownhosts.Line([]string{entry.host}, known.key)+" "+comment+"\n")
+	}
+	slices.Sort(lines)
+
+	if err := os.MkdirAll(filepath.Dir(h.path), knownHostsDirMode); err != nil {
+		return &Error{Message: "create known hosts directory", Err: err}
+	}
+
+	if err := os.WriteFile(h.path, []byte(strings.Join(lines, "")), knownHostsPermissions); err != nil {
+		return &Error{Message: "write known hosts", Err: err}
+	}
+	return nil
+}
+
+// hostKeyAlgorithms returns the algorithms that make a server present key.
+func hostKeyAlgorithms(key ssh.PublicKey) []string {
+	if key.Type() == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256}
+	}
+	return []string{key.Type()}
+}
+
+// hostOnly strips the port from a host:port address.
+func hostOnly(hostname string) string {
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return hostname
+	}
+	return host
+}
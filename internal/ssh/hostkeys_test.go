@@ -0,0 +1,125 @@
+package ssh_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func openServerConfig() *gossh.ServerConfig {
+	var serverConfig gossh.ServerConfig
+	serverConfig.NoClientAuth = true
+	return &serverConfig
+}
+
+func TestHostKeys(t *testing.T) {
+	t.Parallel()
+
+	// Both servers listen on 127.0.0.1, so to the store they are one host
+	// presenting two different keys.
+	host, firstPort := startTestServer(t, openServerConfig(), echoHandler)
+	_, secondPort := startTestServer(t, openServerConfig(), echoHandler)
+
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	exec := func(store *ssh.HostKeys, phase ssh.Phase, port int) error {
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port).WithHostKeys(store, phase)
+		_, execErr := client.Exec(context.Background(), "hello")
+		return execErr
+	}
+
+	t.Run("rejects a changed key within a phase", func(t *testing.T) {
+		t.Parallel()
+
+		store := ssh.NewHostKeys()
+		require.NoError(t, exec(store, ssh.PhaseRescue, firstPort))
+		require.NoError(t, exec(store, ssh.PhaseRescue, firstPort))
+
+		execErr := exec(store, ssh.PhaseRescue, secondPort)
+		require.ErrorIs(t, execErr, ssh.ErrHostKeyMismatch)
+	})
+
+	t.Run("trusts a new key after an expected transition", func(t *testing.T) {
+		t.Parallel()
+
+		store := ssh.NewHostKeys()
+		require.NoError(t, exec(store, ssh.PhaseRescue, firstPort))
+		require.NoError(t, exec(store, ssh.PhaseNetBSD, secondPort))
+
+		require.NoError(t, store.Expect(host, ssh.PhaseRescue))
+		require.NoError(t, exec(store, ssh.PhaseRescue, secondPort))
+	})
+
+	t.Run("only accepts a pinned key", func(t *testing.T) {
+		t.Parallel()
+
+		probe := ssh.NewHostKeys()
+		require.NoError(t, exec(probe, ssh.PhaseNetBSD, firstPort))
+		serverKey, ok := probe.Known(host, ssh.PhaseNetBSD)
+		require.True(t, ok)
+
+		other, genErr := ssh.GenerateKeyPair()
+		require.NoError(t, genErr)
+
+		store := ssh.NewHostKeys()
+		require.NoError(t, store.Pin(host, ssh.PhaseNetBSD, other.PublicKey()))
+		require.ErrorIs(t, exec(store, ssh.PhaseNetBSD, firstPort), ssh.ErrHostKeyMismatch)
+
+		require.NoError(t, store.Pin(host, ssh.PhaseNetBSD, serverKey))
+		require.NoError(t, store.Expect(host, ssh.PhaseNetBSD))
+		require.NoError(t, exec(store, ssh.PhaseNetBSD, firstPort))
+	})
+
+	t.Run("WaitForReady gives up on a mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		store := ssh.NewHostKeys()
+		require.NoError(t, exec(store, ssh.PhaseRescue, firstPort))
+
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(secondPort).WithHostKeys(store, ssh.PhaseRescue)
+		require.ErrorIs(t, client.WaitForReady(context.Background()), ssh.ErrHostKeyMismatch)
+	})
+}
+
+func TestLoadHostKeys(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "build", "known_hosts")
+
+	missing, err := ssh.LoadHostKeys(path)
+	require.NoError(t, err)
+	_, ok := missing.Known("2001:db8::1", ssh.PhaseRescue)
+	assert.False(t, ok)
+
+	rescueKey, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+	nativeKey, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	require.NoError(t, missing.Pin("2001:db8::1", ssh.PhaseNetBSD, nativeKey.PublicKey()))
+	require.NoError(t, missing.Pin("2001:db8::1", ssh.PhaseRescue, rescueKey.PublicKey()))
+	require.NoError(t, missing.Expect("203.0.113.7", ssh.PhaseRescue))
+
+	loaded, err := ssh.LoadHostKeys(path)
+	require.NoError(t, err)
+
+	key, ok := loaded.Known("2001:db8::1", ssh.PhaseNetBSD)
+	require.True(t, ok)
+	assert.Equal(t, nativeKey.AuthorizedKey(), strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key))))
+
+	key, ok = loaded.Known("2001:db8::1", ssh.PhaseRescue)
+	require.True(t, ok)
+	assert.Equal(t, rescueKey.AuthorizedKey(), strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key))))
+
+	// Pins survive the round trip, so an expected transition keeps them.
+	require.NoError(t, loaded.Expect("2001:db8::1", ssh.PhaseNetBSD))
+	_, ok = loaded.Known("2001:db8::1", ssh.PhaseNetBSD)
+	assert.True(t, ok)
+}
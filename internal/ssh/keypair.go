@@ -0,0 +1,242 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+)
+
+const (
+	exportKeyPermissions = 0o600
+
+	// certificateSuffix names the OpenSSH certificate kept next to a key.
+	certificateSuffix = "-cert.pub"
+)
+
+var (
+	// ErrKeyNotExportable is returned when exporting a key pair that was loaded from disk.
+	ErrKeyNotExportable = errors.New("key pair was not generated in memory")
+
+	// ErrPassphraseRequired is wrapped when an encrypted key is loaded without
+	// a way to obtain its passphrase.
+	ErrPassphraseRequired = errors.New("private key is encrypted")
+
+	// ErrCertificateMismatch is wrapped when a certificate does not certify the
+	// key it was found next to.
+	ErrCertificateMismatch = errors.New("certificate does not match key")
+)
+
+// PassphraseFunc supplies the passphrase of the encrypted private key at
+// keyPath. It is only called for keys that turn out to be encrypted.
+type PassphraseFunc func(keyPath string) (secret.Secret, error)
+
+// KeyPair holds an SSH signer and, for generated keys, its private key material.
+// Generated keys live only in memory unless explicitly exported. A key may
+// come with an OpenSSH certificate, and its signer may live in ssh-agent.
+type KeyPair struct {
+	signer     ssh.Signer
+	certSigner ssh.Signer
+	agent      io.Closer
+	private    ed25519.PrivateKey
+}
+
+// GenerateKeyPair creates a fresh in-memory ed25519 key pair.
+func GenerateKeyPair() (*KeyPair, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, &Error{Message: "generate ed25519 key", Err: err}
+	}
+
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil, &Error{Message: "create signer", Err: err}
+	}
+
+	return &KeyPair{signer: signer, certSigner: nil, agent: nil, private: private}, nil
+}
+
+// LoadKeyPair reads an unencrypted private key from keyPath, together with
+// the certificate in <keyPath>-cert.pub when there is one.
+func LoadKeyPair(keyPath string) (*KeyPair, error) {
+	return LoadKeyPairWithPassphrase(keyPath, nil)
+}
+
+// LoadKeyPairWithPassphrase is LoadKeyPair for keys that may be encrypted:
+// passphrase is asked for the passphrase when the key needs one.
+func LoadKeyPairWithPassphrase(keyPath string, passphrase PassphraseFunc) (*KeyPair, error) {
+	path := expandPath(keyPath)
+	key, err := readKeyFile(path)
+	if err != nil {
+		return nil, &Error{Message: "read private key", Err: err}
+	}
+
+	signer, err := parsePrivateKey(path, key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return withCertificate(signer, nil, path)
+}
+
+func parsePrivateKey(path string, key []byte, passphrase PassphraseFunc) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, &Error{Message: "parse private key", Err: err}
+		}
+		return signer, nil
+	}
+
+	if passphrase == nil {
+		return nil, &Error{Message: "parse private key " + path, Err: ErrPassphraseRequired}
+	}
+
+	phrase, err := passphrase(path)
+	if err != nil {
+		return nil, &Error{Message: "read passphrase for " + path, Err: err}
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(phrase.Reveal()))
+	if err != nil {
+		return nil, &Error{Message: "decrypt private key " + path, Err: err}
+	}
+	return signer, nil
+}
+
+// withCertificate builds a key pair for signer, certified by the OpenSSH
+// certificate at <keyPath>-cert.pub when that file exists.
+func withCertificate(signer ssh.Signer, agentConn io.Closer, keyPath string) (*KeyPair, error) {
+	keys := &KeyPair{signer: signer, certSigner: nil, agent: agentConn, private: nil}
+
+	data, err := readKeyFile(keyPath + certificateSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, &Error{Message: "read certificate", Err: err}
+	}
+
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, &Error{Message: "parse certificate " + keyPath + certificateSuffix, Err: err}
+	}
+
+	cert, ok := parsed.(*ssh.Certificate)
+	if !ok {
+		return nil, &Error{Message: "parse certificate " + keyPath + certificateSuffix, Err: ErrCertificateMismatch}
+	}
+
+	if err = keys.certify(cert); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// certify makes the key pair authenticate with cert before the plain key.
+func (k *KeyPair) certify(cert *ssh.Certificate) error {
+	certSigner, err := ssh.NewCertSigner(cert, k.signer)
+	if err != nil {
+		return &Error{Message: "use certificate", Err: fmt.Errorf("%w: %w", ErrCertificateMismatch, err)}
+	}
+
+	k.certSigner = certSigner
+	return nil
+}
+
+// Signer returns the signer used for public key authentication: the
+// certificate's when the key has one, the plain key's otherwise.
+func (k *KeyPair) Signer() ssh.Signer {
+	if k.certSigner != nil {
+		return k.certSigner
+	}
+	return k.signer
+}
+
+// Certificate returns the key's OpenSSH certificate, if it has one.
+func (k *KeyPair) Certificate() (*ssh.Certificate, bool) {
+	if k.certSigner == nil {
+		return nil, false
+	}
+
+	cert, ok := k.certSigner.PublicKey().(*ssh.Certificate)
+	return cert, ok
+}
+
+// PublicKey returns the public half of the key pair. For a certified key it
+// is the plain key, as installed in authorized_keys, not the certificate.
+func (k *KeyPair) PublicKey() ssh.PublicKey {
+	return k.signer.PublicKey()
+}
+
+// AuthorizedKey returns the public key in authorized_keys format.
+func (k *KeyPair) AuthorizedKey() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.signer.PublicKey())))
+}
+
+// Fingerprint returns the SHA256 fingerprint of the public key.
+func (k *KeyPair) Fingerprint() string {
+	return ssh.FingerprintSHA256(k.signer.PublicKey())
+}
+
+// Close releases the connection to ssh-agent of an agent-backed key pair.
+// Other key pairs need no closing.
+func (k *KeyPair) Close() error {
+	if k.agent == nil {
+		return nil
+	}
+
+	if err := k.agent.Close(); err != nil {
+		return &Error{Message: "close ssh-agent connection", Err: err}
+	}
+	return nil
+}
+
+// authMethod offers the certificate first, if any, then the plain key, so a
+// server that does not trust the certificate authority still accepts the key.
+func (k *KeyPair) authMethod() ssh.AuthMethod {
+	if k.certSigner != nil {
+		return ssh.PublicKeys(k.certSigner, k.signer)
+	}
+	return ssh.PublicKeys(k.signer)
+}
+
+// PrivateKeyPEM returns the private key in OpenSSH format, as needed to
+// install a generated key as a server's host key.
+func (k *KeyPair) PrivateKeyPEM() ([]byte, error) {
+	if k.private == nil {
+		return nil, &Error{Message: "export private key", Err: ErrKeyNotExportable}
+	}
+
+	block, err := ssh.MarshalPrivateKey(k.private, "blackbsd-build")
+	if err != nil {
+		return nil, &Error{Message: "marshal private key", Err: err}
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// Export writes the private key in OpenSSH format to path with 0600 permissions.
+// It is intended for debugging only; build keys otherwise never touch disk.
+func (k *KeyPair) Export(path string) error {
+	private, err := k.PrivateKeyPEM()
+	if err != nil {
+		return err
+	}
+
+	cleaned := filepath.Clean(expandPath(path))
+	if err = os.WriteFile(cleaned, private, exportKeyPermissions); err != nil {
+		return &Error{Message: "write private key", Err: err}
+	}
+
+	return nil
+}
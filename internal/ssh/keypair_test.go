@@ -0,0 +1,229 @@
+package ssh_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	t.Parallel()
+
+	t.Run("produces distinct ed25519 keys", func(t *testing.T) {
+		t.Parallel()
+
+		first, err := ssh.GenerateKeyPair()
+		require.NoError(t, err)
+
+		second, err := ssh.GenerateKeyPair()
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(first.AuthorizedKey(), "ssh-ed25519 "))
+		assert.NotEqual(t, first.AuthorizedKey(), second.AuthorizedKey())
+		assert.True(t, strings.HasPrefix(first.Fingerprint(), "SHA256:"))
+	})
+
+	t.Run("exports a loadable private key with owner-only permissions", func(t *testing.T) {
+		t.Parallel()
+
+		keys, err := ssh.GenerateKeyPair()
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "build_key")
+		require.NoError(t, keys.Export(path))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		loaded, err := ssh.LoadKeyPair(path)
+		require.NoError(t, err)
+		assert.Equal(t, keys.AuthorizedKey(), loaded.AuthorizedKey())
+	})
+}
+
+func TestLoadKeyPair(t *testing.T) {
+	t.Parallel()
+
+	t.Run("loads key from disk", func(t *testing.T) {
+		t.Parallel()
+
+		keys, err := ssh.LoadKeyPair(createTempKey(t))
+
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(keys.AuthorizedKey(), "ssh-ed25519 "))
+	})
+
+	t.Run("loaded key is not exportable", func(t *testing.T) {
+		t.Parallel()
+
+		keys, err := ssh.LoadKeyPair(createTempKey(t))
+		require.NoError(t, err)
+
+		exportErr := keys.Export(filepath.Join(t.TempDir(), "copy"))
+		require.ErrorIs(t, exportErr, ssh.ErrKeyNotExportable)
+	})
+
+	t.Run("fails for missing file", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ssh.LoadKeyPair("/nonexistent/key")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "read private key")
+	})
+}
+
+// writeKey writes private to a file, encrypted when passphrase is
+// not empty, and returns its path.
+func writeKey(t *testing.T, private ed25519.PrivateKey, passphrase string) string {
+	t.Helper()
+
+	var block *pem.Block
+	var err error
+	if passphrase == "" {
+		block, err = gossh.MarshalPrivateKey(private, "test")
+	} else {
+		block, err = gossh.MarshalPrivateKeyWithPassphrase(private, "test", []byte(passphrase))
+	}
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+	return path
+}
+
+// certify signs a user certificate for key with ca.
+func certify(t *testing.T, ca gossh.Signer, key gossh.PublicKey) *gossh.Certificate {
+	t.Helper()
+
+	var cert gossh.Certificate
+	cert.Key = key
+	cert.CertType = gossh.UserCert
+	cert.KeyId = "test"
+	cert.ValidPrincipals = []string{"root"}
+	cert.ValidBefore = gossh.CertTimeInfinity
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	return &cert
+}
+
+func newTestKey(t *testing.T) (ed25519.PrivateKey, gossh.Signer) {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := gossh.NewSignerFromKey(private)
+	require.NoError(t, err)
+	return private, signer
+}
+
+func TestLoadKeyPairWithPassphrase(t *testing.T) {
+	t.Parallel()
+
+	private, signer := newTestKey(t)
+	path := writeKey(t, private, "correct horse")
+	want := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	t.Run("needs a passphrase for an encrypted key", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ssh.LoadKeyPair(path)
+		require.ErrorIs(t, err, ssh.ErrPassphraseRequired)
+	})
+
+	t.Run("decrypts with the supplied passphrase", func(t *testing.T) {
+		t.Parallel()
+
+		var asked string
+		keys, err := ssh.LoadKeyPairWithPassphrase(path, func(keyPath string) (secret.Secret, error) {
+			asked = keyPath
+			return secret.New("correct horse"), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, path, asked)
+		assert.Equal(t, want, keys.AuthorizedKey())
+	})
+
+	t.Run("rejects a wrong passphrase", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ssh.LoadKeyPairWithPassphrase(path, func(string) (secret.Secret, error) {
+			return secret.New("battery staple"), nil
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "decrypt private key")
+	})
+
+	t.Run("does not ask for an unencrypted key", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ssh.LoadKeyPairWithPassphrase(createTempKey(t), func(string) (secret.Secret, error) {
+			return secret.Secret{}, errors.New("unexpected prompt")
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestKeyPairCertificate(t *testing.T) {
+	t.Parallel()
+
+	_, ca := newTestKey(t)
+
+	t.Run("authenticates with a certificate next to the key", func(t *testing.T) {
+		t.Parallel()
+
+		private, signer := newTestKey(t)
+		path := writeKey(t, private, "")
+		cert := certify(t, ca, signer.PublicKey())
+		require.NoError(t, os.WriteFile(path+"-cert.pub", gossh.MarshalAuthorizedKey(cert), 0o600))
+
+		keys, err := ssh.LoadKeyPair(path)
+		require.NoError(t, err)
+
+		loaded, ok := keys.Certificate()
+		require.True(t, ok)
+		assert.Equal(t, cert.Marshal(), loaded.Marshal())
+		assert.Equal(t, signer.PublicKey().Marshal(), keys.PublicKey().Marshal())
+
+		// The server only trusts certificates signed by the CA.
+		var checker gossh.CertChecker
+		checker.IsUserAuthority = func(auth gossh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+		}
+		var serverConfig gossh.ServerConfig
+		serverConfig.PublicKeyCallback = checker.Authenticate
+		host, port := startTestServer(t, &serverConfig, echoHandler)
+
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+		t.Cleanup(func() { _ = client.Close() })
+		result, err := client.Exec(context.Background(), "hello")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", result.Stdout)
+	})
+
+	t.Run("rejects a certificate for another key", func(t *testing.T) {
+		t.Parallel()
+
+		private, _ := newTestKey(t)
+		_, other := newTestKey(t)
+		path := writeKey(t, private, "")
+		cert := certify(t, ca, other.PublicKey())
+		require.NoError(t, os.WriteFile(path+"-cert.pub", gossh.MarshalAuthorizedKey(cert), 0o600))
+
+		_, err := ssh.LoadKeyPair(path)
+		require.ErrorIs(t, err, ssh.ErrCertificateMismatch)
+	})
+}
@@ -0,0 +1,170 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ErrUnsupportedProxy is wrapped when a proxy URL has a scheme other than
+// socks5, socks5h or http.
+var ErrUnsupportedProxy = errors.New("unsupported proxy scheme")
+
+// Dialer opens the network connection an SSH client runs over. Proxies from
+// NewProxyDialer and clients connected to a jump host are Dialers.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// WithDialer makes the client connect through dialer instead of dialing the
+// host directly. Nil restores direct connections.
+func (c *Client) WithDialer(dialer Dialer) *Client {
+	c.dialer = dialer
+	return c
+}
+
+// WithJumpHost tunnels the client's connection through jump, a client for a
+// bastion host, like OpenSSH's ProxyJump. Host keys are checked at each hop:
+// jump verifies the bastion and the client the host behind it. Closing the
+// client leaves jump open.
+func (c *Client) WithJumpHost(jump *Client) *Client {
+	return c.WithDialer(jump)
+}
+
+// DialContext opens a connection to addr from the remote host, so that a
+// Client can serve as the jump host of another. A dead connection is
+// re-established once, as for sessions.
+func (c *Client) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnel, err := conn.DialContext(ctx, network, addr)
+	if err == nil {
+		return tunnel, nil
+	}
+
+	if ctx.Err() == nil {
+		slog.Debug("ssh connection lost, reconnecting", "host", c.host, "error", err)
+		c.drop(conn)
+
+		if conn, err = c.connect(ctx); err != nil {
+			return nil, err
+		}
+		if tunnel, err = conn.DialContext(ctx, network, addr); err == nil {
+			return tunnel, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("dial %s via %s", addr, c.addr()), Err: err}
+}
+
+// NewProxyDialer returns a Dialer that connects through the proxy at rawURL:
+// socks5:// (or socks5h://) for a SOCKS5 proxy, http:// for an HTTP proxy
+// supporting CONNECT. Credentials in the URL are sent to the proxy.
+func NewProxyDialer(rawURL string) (Dialer, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, &Error{Message: "parse proxy url", Err: err}
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+
+		socks, socksErr := proxy.SOCKS5("tcp", proxyURL.Host, auth, proxy.Direct)
+		if socksErr != nil {
+			return nil, &Error{Message: "create socks5 proxy", Err: socksErr}
+		}
+
+		dialer, ok := socks.(Dialer)
+		if !ok {
+			return nil, &Error{Message: "create socks5 proxy", Err: ErrUnsupportedProxy}
+		}
+		return dialer, nil
+	case "http":
+		return &httpProxy{address: proxyURL.Host, user: proxyURL.User}, nil
+	default:
+		return nil, &Error{Message: "create proxy " + proxyURL.Redacted(), Err: ErrUnsupportedProxy}
+	}
+}
+
+// httpProxy tunnels connections through an HTTP proxy with CONNECT.
+type httpProxy struct {
+	user    *url.Userinfo
+	address string
+}
+
+func (p *httpProxy) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, p.address)
+	if err != nil {
+		return nil, &Error{Message: "connect to proxy " + p.address, Err: err}
+	}
+
+	// Bound the CONNECT exchange by ctx; the tunnel itself has no deadline.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tunnel, err := p.connect(conn, addr)
+	if err != nil {
+		CloseQuietly(conn)
+		return nil, &Error{Message: fmt.Sprintf("connect to %s via proxy %s", addr, p.address), Err: err}
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+func (p *httpProxy) connect(conn net.Conn, addr string) (net.Conn, error) {
+	request := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if p.user != nil {
+		password, _ := p.user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.user.Username() + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+
+	if _, err := conn.Write([]byte(request + "\r\n")); err != nil {
+		return nil, fmt.Errorf("send CONNECT: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return nil, fmt.Errorf("read CONNECT response: %w", err)
+	}
+	CloseQuietly(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy refused CONNECT: %s", response.Status)
+	}
+
+	// The SSH server speaks first, so its banner may already be buffered.
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads through a bufio.Reader that may hold data read past a
+// proxy's response.
+type bufferedConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+func (b *bufferedConn) Read(data []byte) (int, error) {
+	return b.reader.Read(data)
+}
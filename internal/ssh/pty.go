@@ -10,27 +10,30 @@ import (
 )
 
 const (
-	ptyCols = 80
-	ptyRows = 40
+	defaultPtyCols = 80
+	defaultPtyRows = 40
 )
 
+// WithPtySize sets the terminal size of interactive commands, 80x40 by
+// default. Curses programs lay out their screens for it, so expect patterns
+// may depend on it.
+func (c *Client) WithPtySize(cols, rows int) *Client {
+	c.ptyCols = cols
+	c.ptyRows = rows
+	return c
+}
+
 // ExecInteractive runs a command with a PTY and pipes the given input.
 // This is used for QEMU serial console interaction where install commands
 // are piped through an interactive terminal session.
 func (c *Client) ExecInteractive(ctx context.Context, command string, input io.Reader) (CommandResult, error) {
-	conn, err := c.dial(ctx)
+	session, err := c.session(ctx)
 	if err != nil {
 		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, err
 	}
-	defer closeQuietly(conn)
-
-	session, err := conn.NewSession()
-	if err != nil {
-		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, &Error{Message: "create session", Err: err}
-	}
-	defer closeQuietly(session)
+	defer CloseQuietly(session)
 
-	if err = session.RequestPty("xterm", ptyRows, ptyCols, ssh.TerminalModes{}); err != nil {
+	if err = session.RequestPty("xterm", c.ptyRows, c.ptyCols, ssh.TerminalModes{}); err != nil {
 		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, &Error{Message: "request pty", Err: err}
 	}
 
@@ -60,3 +63,114 @@ func (c *Client) ExecInteractive(ctx context.Context, command string, input io.R
 		ExitCode: exitCode,
 	}, nil
 }
+
+// ExecExpect runs a command with a PTY and answers its prompts with script,
+// as for an installer driven over a serial console. Output is also copied to
+// transcript when it is not nil. Once the script has finished, stdin is
+// closed and the command's result returned; when a step fails the command is
+// stopped and the *ExpectError returned along with the output so far.
+func (c *Client) ExecExpect(
+	ctx context.Context,
+	command string,
+	script []Step,
+	transcript io.Writer,
+) (CommandResult, error) {
+	session, err := c.session(ctx)
+	if err != nil {
+		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, err
+	}
+	defer CloseQuietly(session)
+
+	if err = session.RequestPty("xterm", c.ptyRows, c.ptyCols, ssh.TerminalModes{}); err != nil {
+		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, &Error{Message: "request pty", Err: err}
+	}
+
+	terminal, err := sessionTerminal(session)
+	if err != nil {
+		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	session.Stderr = &stderr
+	sink := io.Writer(&stdout)
+	if transcript != nil {
+		sink = io.MultiWriter(&stdout, transcript)
+	}
+
+	if err = session.Start(command); err != nil {
+		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0},
+			&Error{Message: "start interactive command", Err: err}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	// Both buffers are complete once the session and the terminal are done.
+	expecter := NewExpecter(terminal, sink)
+	result := func(exitCode int) CommandResult {
+		<-expecter.Done()
+		return CommandResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode}
+	}
+
+	if err = expecter.Run(ctx, script); err != nil {
+		CloseQuietly(session)
+		<-done
+		return result(0), err
+	}
+	CloseQuietly(terminal.stdin)
+
+	exitCode, err := waitExpect(ctx, session, done)
+	return result(exitCode), err
+}
+
+// waitExpect waits for the command of session to exit once its script has
+// finished, with done receiving the result of session.Wait. The command is
+// stopped when ctx ends first.
+func waitExpect(ctx context.Context, session io.Closer, done <-chan error) (int, error) {
+	var runErr error
+	select {
+	case runErr = <-done:
+	case <-ctx.Done():
+		CloseQuietly(session)
+		<-done
+		return 0, &Error{Message: "run interactive command", Err: ctx.Err()}
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case runErr == nil:
+		return 0, nil
+	case errors.As(runErr, &exitErr):
+		return exitErr.ExitStatus(), nil
+	default:
+		return 0, &Error{Message: "run interactive command", Err: runErr}
+	}
+}
+
+// ptyTerminal is the Terminal of a session: its output and its input.
+type ptyTerminal struct {
+	stdout io.Reader
+	stdin  io.WriteCloser
+}
+
+func sessionTerminal(session *ssh.Session) (*ptyTerminal, error) {
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, &Error{Message: "open stdin", Err: err}
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, &Error{Message: "open stdout", Err: err}
+	}
+
+	return &ptyTerminal{stdout: stdout, stdin: stdin}, nil
+}
+
+func (t *ptyTerminal) Read(data []byte) (int, error) {
+	return t.stdout.Read(data)
+}
+
+func (t *ptyTerminal) Write(data []byte) (int, error) {
+	return t.stdin.Write(data)
+}
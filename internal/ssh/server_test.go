@@ -0,0 +1,270 @@
+package ssh_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// execHandler runs a command on the test server and returns its exit status.
+type execHandler func(command string, stdin io.Reader, stdout, stderr io.Writer) uint32
+
+// startTestServer runs an in-process SSH server on a loopback port that
+// serves exec requests with handler. It returns the host and port to dial.
+func startTestServer(tb testing.TB, config *gossh.ServerConfig, handler execHandler) (string, int) {
+	tb.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(tb, err)
+
+	signer, err := gossh.NewSignerFromKey(hostKey)
+	require.NoError(tb, err)
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go serveTestConn(conn, config, handler)
+		}
+	}()
+
+	host, portStr, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(tb, err)
+
+	port, err := strconv.Atoi(portStr)
+	require.NoError(tb, err)
+
+	return host, port
+}
+
+func serveTestConn(conn net.Conn, config *gossh.ServerConfig, handler execHandler) {
+	serverConn, chans, reqs, err := gossh.NewServerConn(conn, config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer func() { _ = serverConn.Close() }()
+
+	go serveTestGlobalRequests(serverConn, reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go serveTestTunnel(newChannel)
+			continue
+		}
+
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(gossh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+
+		channel, requests, acceptErr := newChannel.Accept()
+		if acceptErr != nil {
+			return
+		}
+		go serveTestSession(channel, requests, handler)
+	}
+}
+
+// serveTestTunnel connects a direct-tcpip channel, as opened by a client
+// using the server as a jump host, to its target address.
+func serveTestTunnel(newChannel gossh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := gossh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(context.Background(), "tcp",
+		net.JoinHostPort(target.Host, strconv.FormatUint(uint64(target.Port), 10)))
+	if err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go gossh.DiscardRequests(requests)
+
+	pipeTestChannel(channel, conn)
+}
+
+// serveTestGlobalRequests answers tcpip-forward requests, as sent for remote
+// port forwards, by listening on the requested address for the lifetime of
+// the connection. Other requests are refused.
+func serveTestGlobalRequests(serverConn *gossh.ServerConn, reqs <-chan *gossh.Request) {
+	var listeners []net.Listener
+	defer func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}()
+
+	for req := range reqs {
+		var bind struct {
+			Addr string
+			Port uint32
+		}
+		if req.Type != "tcpip-forward" || gossh.Unmarshal(req.Payload, &bind) != nil {
+			_ = req.Reply(false, nil)
+			continue
+		}
+
+		var config net.ListenConfig
+		listener, err := config.Listen(context.Background(), "tcp",
+			net.JoinHostPort(bind.Addr, strconv.FormatUint(uint64(bind.Port), 10)))
+		if err != nil {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		listeners = append(listeners, listener)
+
+		port := uint32(listener.Addr().(*net.TCPAddr).Port) //nolint:gosec // Ports fit in a uint32.
+		_ = req.Reply(true, gossh.Marshal(struct{ Port uint32 }{Port: port}))
+		go acceptTestForward(serverConn, listener, bind.Addr, port)
+	}
+}
+
+// acceptTestForward opens a forwarded-tcpip channel to the client for every
+// connection to listener.
+func acceptTestForward(serverConn *gossh.ServerConn, listener net.Listener, addr string, port uint32) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			origin, _ := conn.RemoteAddr().(*net.TCPAddr)
+			payload := gossh.Marshal(struct {
+				Addr       string
+				Port       uint32
+				OriginAddr string
+				OriginPort uint32
+			}{
+				Addr:       addr,
+				Port:       port,
+				OriginAddr: origin.IP.String(),
+				OriginPort: uint32(origin.Port), //nolint:gosec // Ports fit in a uint32.
+			})
+
+			channel, requests, openErr := serverConn.OpenChannel("forwarded-tcpip", payload)
+			if openErr != nil {
+				_ = conn.Close()
+				return
+			}
+			go gossh.DiscardRequests(requests)
+
+			pipeTestChannel(channel, conn)
+		}()
+	}
+}
+
+// pipeTestChannel copies between channel and conn, passing on half-closes,
+// until both directions end.
+func pipeTestChannel(channel gossh.Channel, conn net.Conn) {
+	upstream := make(chan struct{})
+	go func() {
+		defer close(upstream)
+		_, _ = io.Copy(channel, conn)
+		_ = channel.CloseWrite()
+	}()
+
+	_, _ = io.Copy(conn, channel)
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.CloseWrite()
+	}
+	<-upstream
+	_ = conn.Close()
+	_ = channel.Close()
+}
+
+func serveTestSession(channel gossh.Channel, requests <-chan *gossh.Request, handler execHandler) {
+	defer func() { _ = channel.Close() }()
+
+	for req := range requests {
+		if req.Type == "subsystem" {
+			name, ok := parseExecPayload(req.Payload)
+			_ = req.Reply(ok && name == "sftp", nil)
+			if ok && name == "sftp" {
+				serveTestSFTP(channel)
+			}
+			return
+		}
+
+		if req.Type != "exec" {
+			_ = req.Reply(req.Type == "pty-req" || req.Type == "env", nil)
+			continue
+		}
+
+		command, ok := parseExecPayload(req.Payload)
+		_ = req.Reply(ok, nil)
+		if !ok {
+			return
+		}
+
+		status := handler(command, channel, channel, channel.Stderr())
+
+		var payload [4]byte
+		binary.BigEndian.PutUint32(payload[:], status)
+		_, _ = channel.SendRequest("exit-status", false, payload[:])
+		return
+	}
+}
+
+// serveTestSFTP serves the local filesystem over SFTP on channel.
+func serveTestSFTP(channel gossh.Channel) {
+	server, err := sftp.NewServer(channel)
+	if err != nil {
+		return
+	}
+	_ = server.Serve()
+}
+
+// parseExecPayload decodes the length-prefixed command of an exec request.
+func parseExecPayload(payload []byte) (string, bool) {
+	const lengthSize = 4
+	if len(payload) < lengthSize {
+		return "", false
+	}
+
+	length := binary.BigEndian.Uint32(payload)
+	if int(length) != len(payload)-lengthSize {
+		return "", false
+	}
+	return string(payload[lengthSize:]), true
+}
+
+// echoHandler writes the command back on stdout and exits 0.
+func echoHandler(command string, _ io.Reader, stdout, _ io.Writer) uint32 {
+	if _, err := io.WriteString(stdout, command); err != nil && !errors.Is(err, io.EOF) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,176 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultTailLines is how many trailing lines of each stream a streamed
+	// CommandResult keeps when StreamOpts.TailLines is zero.
+	DefaultTailLines = 50
+
+	// maxLineLength bounds a partial line; longer lines are split.
+	maxLineLength = 64 * 1024
+)
+
+// StreamOpts configures where ExecStream delivers a command's output while it
+// runs. OnStdout and OnStderr receive complete lines; carriage returns end a
+// line too, so progress meters such as dd status=progress arrive as they
+// update. Stdout and Stderr receive the raw bytes and Log a copy of both,
+// typically a per-stage log file. Every field is optional.
+type StreamOpts struct {
+	Stdout    io.Writer
+	Stderr    io.Writer
+	Log       io.Writer
+	OnStdout  func(line string)
+	OnStderr  func(line string)
+	TailLines int
+}
+
+// ExecStream runs a command and streams its output through opts as it
+// arrives. Only the last opts.TailLines lines of each stream are kept in the
+// result, enough for an error message. Cancelling ctx closes the session.
+func (c *Client) ExecStream(ctx context.Context, command string, opts StreamOpts) (CommandResult, error) {
+	session, err := c.session(ctx)
+	if err != nil {
+		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, err
+	}
+	defer CloseQuietly(session)
+
+	stdout, stderr := opts.sinks()
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if err = session.Start(command); err != nil {
+		return CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, &Error{Message: "start command", Err: err}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	var runErr error
+	select {
+	case runErr = <-done:
+	case <-ctx.Done():
+		CloseQuietly(session)
+		<-done
+		return stdout.result(stderr, 0), &Error{Message: "run command", Err: ctx.Err()}
+	}
+
+	exitCode := 0
+	if runErr != nil {
+		var exitErr *ssh.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return stdout.result(stderr, 0), &Error{Message: "run command", Err: runErr}
+		}
+		exitCode = exitErr.ExitStatus()
+	}
+
+	return stdout.result(stderr, exitCode), nil
+}
+
+// Replay sends the buffered output of a finished command through opts, as if
+// it had been streamed, and returns the result trimmed to the tail. It lets
+// runners without streaming support honour StreamOpts.
+func (opts StreamOpts) Replay(result CommandResult) CommandResult {
+	stdout, stderr := opts.sinks()
+	_, _ = io.WriteString(stdout, result.Stdout)
+	_, _ = io.WriteString(stderr, result.Stderr)
+	return stdout.result(stderr, result.ExitCode)
+}
+
+func (opts StreamOpts) sinks() (*lineSink, *lineSink) {
+	tailLines := opts.TailLines
+	if tailLines <= 0 {
+		tailLines = DefaultTailLines
+	}
+
+	// Both streams may write to the shared log concurrently.
+	var logMu sync.Mutex
+	stdout := newLineSink(opts.Stdout, opts.Log, &logMu, opts.OnStdout, tailLines)
+	stderr := newLineSink(opts.Stderr, opts.Log, &logMu, opts.OnStderr, tailLines)
+	return stdout, stderr
+}
+
+// lineSink is the writer behind one output stream: it copies raw bytes to its
+// writers, splits them into lines for the callback and keeps a bounded tail.
+type lineSink struct {
+	raw     io.Writer
+	log     io.Writer
+	logMu   *sync.Mutex
+	onLine  func(string)
+	tail    []string
+	partial []byte
+	limit   int
+}
+
+func newLineSink(raw, log io.Writer, logMu *sync.Mutex, onLine func(string), limit int) *lineSink {
+	return &lineSink{
+		raw:     raw,
+		log:     log,
+		logMu:   logMu,
+		onLine:  onLine,
+		tail:    make([]string, 0, limit),
+		partial: nil,
+		limit:   limit,
+	}
+}
+
+// Write never fails, so a broken log or callback cannot stall the command.
+func (s *lineSink) Write(data []byte) (int, error) {
+	if s.raw != nil {
+		_, _ = s.raw.Write(data)
+	}
+
+	if s.log != nil {
+		s.logMu.Lock()
+		_, _ = s.log.Write(data)
+		s.logMu.Unlock()
+	}
+
+	for _, b := range data {
+		if b == '\n' || b == '\r' {
+			s.emit()
+			continue
+		}
+
+		s.partial = append(s.partial, b)
+		if len(s.partial) >= maxLineLength {
+			s.emit()
+		}
+	}
+	return len(data), nil
+}
+
+func (s *lineSink) emit() {
+	if len(s.partial) == 0 {
+		return
+	}
+
+	line := string(s.partial)
+	s.partial = s.partial[:0]
+
+	if s.onLine != nil {
+		s.onLine(line)
+	}
+
+	if len(s.tail) == s.limit {
+		s.tail = append(s.tail[:0], s.tail[1:]...)
+	}
+	s.tail = append(s.tail, line)
+}
+
+func (s *lineSink) String() string {
+	s.emit()
+	return strings.Join(s.tail, "\n")
+}
+
+func (s *lineSink) result(stderr *lineSink, exitCode int) CommandResult {
+	return CommandResult{Stdout: s.String(), Stderr: stderr.String(), ExitCode: exitCode}
+}
@@ -0,0 +1,137 @@
+package ssh_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamHandler prints numbered lines for "count", a progress meter for
+// "progress" and ticks for "hang" until the client leaves, exiting 3 on "fail".
+func streamHandler(command string, _ io.Reader, stdout, stderr io.Writer) uint32 {
+	switch command {
+	case "count":
+		for i := 1; i <= 100; i++ {
+			_, _ = fmt.Fprintf(stdout, "line %d\n", i)
+		}
+		_, _ = io.WriteString(stderr, "done\n")
+	case "progress":
+		_, _ = io.WriteString(stdout, "10%\r50%\r100%\n")
+	case "hang":
+		// Print until the client goes away.
+		for {
+			if _, err := io.WriteString(stdout, "tick\n"); err != nil {
+				return 0
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	case "fail":
+		_, _ = io.WriteString(stderr, "boom\n")
+		return 3
+	}
+	return 0
+}
+
+func TestExecStream(t *testing.T) {
+	t.Parallel()
+
+	host, port := startTestServer(t, openServerConfig(), streamHandler)
+	keys, err := ssh.GenerateKeyPair()
+	require.NoError(t, err)
+
+	newClient := func() *ssh.Client {
+		client := ssh.NewClientWithKeyPair(host, keys).WithPort(port)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("delivers lines and keeps a bounded tail", func(t *testing.T) {
+		t.Parallel()
+
+		var lines []string
+		var logBuf bytes.Buffer
+		var opts ssh.StreamOpts
+		opts.OnStdout = func(line string) { lines = append(lines, line) }
+		opts.Log = &logBuf
+		opts.TailLines = 3
+
+		result, execErr := newClient().ExecStream(context.Background(), "count", opts)
+		require.NoError(t, execErr)
+
+		assert.Len(t, lines, 100)
+		assert.Equal(t, "line 1", lines[0])
+		assert.Equal(t, "line 98\nline 99\nline 100", result.Stdout)
+		assert.Equal(t, "done", result.Stderr)
+		assert.Equal(t, 0, result.ExitCode)
+		assert.Contains(t, logBuf.String(), "line 100\n")
+		assert.Contains(t, logBuf.String(), "done\n")
+	})
+
+	t.Run("splits progress meters on carriage returns", func(t *testing.T) {
+		t.Parallel()
+
+		var lines []string
+		var opts ssh.StreamOpts
+		opts.OnStdout = func(line string) { lines = append(lines, line) }
+
+		_, execErr := newClient().ExecStream(context.Background(), "progress", opts)
+		require.NoError(t, execErr)
+		assert.Equal(t, []string{"10%", "50%", "100%"}, lines)
+	})
+
+	t.Run("reports the exit code", func(t *testing.T) {
+		t.Parallel()
+
+		var stderr bytes.Buffer
+		var opts ssh.StreamOpts
+		opts.Stderr = &stderr
+
+		result, execErr := newClient().ExecStream(context.Background(), "fail", opts)
+		require.NoError(t, execErr)
+		assert.Equal(t, 3, result.ExitCode)
+		assert.Equal(t, "boom", result.Stderr)
+		assert.Equal(t, "boom\n", stderr.String())
+	})
+
+	t.Run("stops when the context is cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var once sync.Once
+		var opts ssh.StreamOpts
+		opts.OnStdout = func(string) { once.Do(func() { time.AfterFunc(10*time.Millisecond, cancel) }) }
+
+		result, execErr := newClient().ExecStream(ctx, "hang", opts)
+		require.ErrorIs(t, execErr, context.Canceled)
+		assert.Contains(t, result.Stdout, "tick")
+	})
+}
+
+func TestStreamOptsReplay(t *testing.T) {
+	t.Parallel()
+
+	var stdout, stderr []string
+	var opts ssh.StreamOpts
+	opts.OnStdout = func(line string) { stdout = append(stdout, line) }
+	opts.OnStderr = func(line string) { stderr = append(stderr, line) }
+	opts.TailLines = 2
+
+	result := opts.Replay(ssh.CommandResult{Stdout: "a\nb\nc", Stderr: "warn\n", ExitCode: 1})
+
+	assert.Equal(t, []string{"a", "b", "c"}, stdout)
+	assert.Equal(t, []string{"warn"}, stderr)
+	assert.Equal(t, "b\nc", result.Stdout)
+	assert.Equal(t, 1, result.ExitCode)
+	assert.False(t, strings.HasSuffix(result.Stderr, "\n"))
+}
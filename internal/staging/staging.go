@@ -0,0 +1,75 @@
+// Package staging mounts Hetzner volumes on build servers so artifacts and
+// caches live on persistent storage rather than the tmpfs-backed rescue root.
+package staging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/runner"
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+)
+
+const (
+	// ArtifactsMount is where the per-build artifacts volume is mounted.
+	ArtifactsMount = "/mnt/artifacts"
+
+	// CacheMount is where the shared cache volume is mounted.
+	CacheMount = "/mnt/cache"
+
+	// ISOCacheDir holds downloaded NetBSD install media on the cache volume.
+	ISOCacheDir = CacheMount + "/iso"
+
+	// PackageCacheDir holds pkgsrc binary packages on the cache volume.
+	PackageCacheDir = CacheMount + "/packages"
+
+	// filesystemLabel names the filesystem created on blank volumes.
+	filesystemLabel = "blackbsd"
+
+	// ext2MagicOffset is the byte offset of the ext2 superblock magic, which
+	// reads as ext2Magic in a little-endian hex dump.
+	ext2MagicOffset = 1080
+	ext2Magic       = "ef53"
+)
+
+// MountRescue mounts the volume at device inside the Linux rescue system. A
+// blank volume is formatted first, as ext2 because NetBSD's ext2fs driver
+// can mount that read-write too.
+func MountRescue(ctx context.Context, exec runner.Runner, device, mountPoint string) error {
+	command := fmt.Sprintf("(blkid %[1]s >/dev/null || mkfs.ext2 -q -L %[3]s %[1]s) && "+
+		"mkdir -p %[2]s && mount %[1]s %[2]s",
+		ssh.EscapeShellArg(device), ssh.EscapeShellArg(mountPoint), filesystemLabel)
+
+	return run(ctx, exec, "mount volume", command)
+}
+
+// MountNetBSD mounts an ext2 volume on a booted NetBSD host; see
+// netbsd.VolumeDevice for the device name. A volume without an ext2
+// superblock, such as one created for this build, is formatted first, as
+// MountRescue does in rescue mode.
+func MountNetBSD(ctx context.Context, exec runner.Runner, device, mountPoint string) error {
+	command := fmt.Sprintf("([ \"$(dd if=%[1]s bs=1 skip=%[4]d count=2 2>/dev/null | od -An -tx2 | tr -d ' ')\" "+
+		"= %[5]s ] || newfs_ext2fs -v %[3]s %[1]s) && mkdir -p %[2]s && mount -t ext2fs %[1]s %[2]s",
+		ssh.EscapeShellArg(device), ssh.EscapeShellArg(mountPoint), filesystemLabel, ext2MagicOffset, ext2Magic)
+
+	return run(ctx, exec, "mount volume", command)
+}
+
+// Unmount flushes and unmounts mountPoint so the volume can be detached.
+func Unmount(ctx context.Context, exec runner.Runner, mountPoint string) error {
+	return run(ctx, exec, "unmount volume", "sync && umount "+ssh.EscapeShellArg(mountPoint))
+}
+
+func run(ctx context.Context, exec runner.Runner, action, command string) error {
+	result, err := exec.Exec(ctx, command)
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+
+	if !result.Success() {
+		return fmt.Errorf("%s: exited %d: %s", action, result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package staging_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/ssh"
+	"github.com/omarluq/hetzner-blackbsd/internal/staging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRunner struct {
+	err      error
+	result   ssh.CommandResult
+	commands []string
+}
+
+func (runner *mockRunner) Exec(_ context.Context, command string) (ssh.CommandResult, error) {
+	runner.commands = append(runner.commands, command)
+	return runner.result, runner.err
+}
+
+func newMock() *mockRunner {
+	return &mockRunner{err: nil, result: ssh.CommandResult{Stdout: "", Stderr: "", ExitCode: 0}, commands: nil}
+}
+
+func TestMountRescue(t *testing.T) {
+	t.Parallel()
+
+	t.Run("formats blank volume and mounts it", func(t *testing.T) {
+		t.Parallel()
+
+		runner := newMock()
+
+		err := staging.MountRescue(context.Background(), runner, "/dev/disk/by-id/scsi-0HC_Volume_9", "/mnt/cache")
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"(blkid '/dev/disk/by-id/scsi-0HC_Volume_9' >/dev/null || " +
+				"mkfs.ext2 -q -L blackbsd '/dev/disk/by-id/scsi-0HC_Volume_9') && " +
+				"mkdir -p '/mnt/cache' && mount '/dev/disk/by-id/scsi-0HC_Volume_9' '/mnt/cache'",
+		}, runner.commands)
+	})
+
+	t.Run("returns error when mount fails", func(t *testing.T) {
+		t.Parallel()
+
+		runner := newMock()
+		runner.result = ssh.CommandResult{Stdout: "", Stderr: "wrong fs type\n", ExitCode: 32}
+
+		err := staging.MountRescue(context.Background(), runner, "/dev/sdb", "/mnt/cache")
+
+		require.Error(t, err)
+		assert.Equal(t, "mount volume: exited 32: wrong fs type", err.Error())
+	})
+}
+
+func TestMountNetBSD(t *testing.T) {
+	t.Parallel()
+
+	runner := newMock()
+
+	require.NoError(t, staging.MountNetBSD(context.Background(), runner, "/dev/sd1d", staging.ArtifactsMount))
+	assert.Equal(t, []string{
+		"([ \"$(dd if='/dev/sd1d' bs=1 skip=1080 count=2 2>/dev/null | od -An -tx2 | tr -d ' ')\" = ef53 ] " +
+			"|| newfs_ext2fs -v blackbsd '/dev/sd1d') && mkdir -p '/mnt/artifacts' && " +
+			"mount -t ext2fs '/dev/sd1d' '/mnt/artifacts'",
+	}, runner.commands)
+}
+
+func TestUnmount(t *testing.T) {
+	t.Parallel()
+
+	runner := newMock()
+	runner.err = assert.AnError
+
+	err := staging.Unmount(context.Background(), runner, staging.CacheMount)
+
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{"sync && umount '/mnt/cache'"}, runner.commands)
+}
@@ -0,0 +1,451 @@
+// Package vnc implements the subset of the RFB (VNC) protocol needed to
+// capture screenshots of a server console.
+package vnc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/des" //nolint:gosec // VNC authentication is defined in terms of DES.
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+	"net/url"
+	"slices"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+)
+
+const (
+	protocolVersion = "RFB 003.008\n"
+
+	securityNone    = 1
+	securityVNCAuth = 2
+
+	msgSetPixelFormat           = 0
+	msgSetEncodings             = 2
+	msgFramebufferUpdateRequest = 3
+
+	msgFramebufferUpdate   = 0
+	msgSetColourMapEntries = 1
+	msgBell                = 2
+	msgServerCutText       = 3
+
+	encodingRaw   = 0
+	bytesPerPixel = 4
+
+	challengeSize  = 16
+	maxReasonBytes = 1 << 16
+)
+
+// ErrAuthFailed is returned when the server rejects the VNC password.
+var ErrAuthFailed = errors.New("vnc: authentication failed")
+
+// Client is a connected RFB session that can capture the framebuffer.
+type Client struct {
+	conn   io.ReadWriteCloser
+	reader *bufio.Reader
+	fb     *image.RGBA
+	name   string
+}
+
+// DialWebSocket connects to a VNC server tunnelled over a websocket, as
+// returned by the Hetzner console API, and performs the RFB handshake.
+func DialWebSocket(ctx context.Context, rawURL string, password secret.Secret) (*Client, error) {
+	origin, err := originOf(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := websocket.NewConfig(rawURL, origin)
+	if err != nil {
+		return nil, fmt.Errorf("vnc: websocket config: %w", err)
+	}
+	config.Protocol = []string{"binary"}
+
+	conn, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("vnc: dial websocket: %w", err)
+	}
+	conn.PayloadType = websocket.BinaryFrame
+
+	return Handshake(ctx, conn, password)
+}
+
+// Handshake performs the RFB handshake over conn. An empty password only
+// accepts servers that offer no authentication.
+func Handshake(ctx context.Context, conn io.ReadWriteCloser, password secret.Secret) (*Client, error) {
+	client := &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		fb:     nil,
+		name:   "",
+	}
+
+	err := client.withContext(ctx, func() error { return client.handshake(password) })
+	if err != nil {
+		closeErr := conn.Close()
+		return nil, errors.Join(err, closeErr)
+	}
+	return client, nil
+}
+
+// Name returns the desktop name announced by the server.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Screenshot requests a full framebuffer update and returns a copy of the screen.
+func (c *Client) Screenshot(ctx context.Context) (*image.RGBA, error) {
+	var screen *image.RGBA
+	err := c.withContext(ctx, func() error {
+		if err := c.requestUpdate(); err != nil {
+			return err
+		}
+		if err := c.awaitUpdate(); err != nil {
+			return err
+		}
+
+		screen = image.NewRGBA(c.fb.Rect)
+		copy(screen.Pix, c.fb.Pix)
+		return nil
+	})
+	return screen, err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// EncryptChallenge returns the VNC authentication response to challenge:
+// the challenge DES-encrypted with the password, whose bytes are bit-reversed
+// and truncated or zero-padded to eight bytes.
+func EncryptChallenge(challenge []byte, password string) ([]byte, error) {
+	key := make([]byte, des.BlockSize)
+	copy(key, password)
+	for i, b := range key {
+		key[i] = bits.Reverse8(b)
+	}
+
+	block, err := des.NewCipher(key) //nolint:gosec // VNC authentication is defined in terms of DES.
+	if err != nil {
+		return nil, fmt.Errorf("vnc: des cipher: %w", err)
+	}
+
+	response := make([]byte, len(challenge))
+	for offset := 0; offset+des.BlockSize <= len(challenge); offset += des.BlockSize {
+		block.Encrypt(response[offset:], challenge[offset:offset+des.BlockSize])
+	}
+	return response, nil
+}
+
+// withContext runs fn, closing the connection if ctx ends first so blocked
+// reads return.
+func (c *Client) withContext(ctx context.Context, fn func() error) error {
+	stop := context.AfterFunc(ctx, func() { _ = c.conn.Close() })
+	err := fn()
+	if !stop() && ctx.Err() != nil {
+		return fmt.Errorf("vnc: %w", ctx.Err())
+	}
+	return err
+}
+
+func (c *Client) handshake(password secret.Secret) error {
+	version := make([]byte, len(protocolVersion))
+	if _, err := io.ReadFull(c.reader, version); err != nil {
+		return fmt.Errorf("vnc: read protocol version: %w", err)
+	}
+	if !bytes.HasPrefix(version, []byte("RFB ")) {
+		return fmt.Errorf("vnc: unexpected protocol version %q", version)
+	}
+
+	if _, err := c.conn.Write([]byte(protocolVersion)); err != nil {
+		return fmt.Errorf("vnc: write protocol version: %w", err)
+	}
+
+	if err := c.authenticate(password); err != nil {
+		return err
+	}
+
+	// ClientInit: share the desktop with other viewers.
+	if _, err := c.conn.Write([]byte{1}); err != nil {
+		return fmt.Errorf("vnc: write client init: %w", err)
+	}
+
+	if err := c.readServerInit(); err != nil {
+		return err
+	}
+
+	return c.setPixelFormat()
+}
+
+func (c *Client) authenticate(password secret.Secret) error {
+	count, err := c.reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("vnc: read security types: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("vnc: server refused connection: %s", c.readReason())
+	}
+
+	types := make([]byte, count)
+	if _, err = io.ReadFull(c.reader, types); err != nil {
+		return fmt.Errorf("vnc: read security types: %w", err)
+	}
+
+	securityType, err := chooseSecurity(types, password)
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.conn.Write([]byte{securityType}); err != nil {
+		return fmt.Errorf("vnc: write security type: %w", err)
+	}
+
+	if securityType == securityVNCAuth {
+		if err = c.answerChallenge(password); err != nil {
+			return err
+		}
+	}
+
+	var result uint32
+	if err = binary.Read(c.reader, binary.BigEndian, &result); err != nil {
+		return fmt.Errorf("vnc: read security result: %w", err)
+	}
+	if result != 0 {
+		return fmt.Errorf("%w: %s", ErrAuthFailed, c.readReason())
+	}
+	return nil
+}
+
+func chooseSecurity(types []byte, password secret.Secret) (byte, error) {
+	switch {
+	case !password.IsZero() && slices.Contains(types, securityVNCAuth):
+		return securityVNCAuth, nil
+	case slices.Contains(types, securityNone):
+		return securityNone, nil
+	case slices.Contains(types, securityVNCAuth):
+		return 0, fmt.Errorf("%w: server requires a password", ErrAuthFailed)
+	default:
+		return 0, fmt.Errorf("vnc: no supported security type in %v", types)
+	}
+}
+
+func (c *Client) answerChallenge(password secret.Secret) error {
+	challenge := make([]byte, challengeSize)
+	if _, err := io.ReadFull(c.reader, challenge); err != nil {
+		return fmt.Errorf("vnc: read challenge: %w", err)
+	}
+
+	response, err := EncryptChallenge(challenge, password.Reveal())
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.conn.Write(response); err != nil {
+		return fmt.Errorf("vnc: write challenge response: %w", err)
+	}
+	return nil
+}
+
+// readReason reads a length-prefixed failure reason, returning a placeholder
+// when it cannot be read.
+func (c *Client) readReason() string {
+	var length uint32
+	if err := binary.Read(c.reader, binary.BigEndian, &length); err != nil || length > maxReasonBytes {
+		return "no reason given"
+	}
+
+	reason := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, reason); err != nil {
+		return "no reason given"
+	}
+	return string(reason)
+}
+
+func (c *Client) readServerInit() error {
+	var header struct {
+		Width       uint16
+		Height      uint16
+		PixelFormat [16]byte
+		NameLength  uint32
+	}
+	if err := binary.Read(c.reader, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("vnc: read server init: %w", err)
+	}
+	if header.NameLength > maxReasonBytes {
+		return fmt.Errorf("vnc: desktop name too long (%d bytes)", header.NameLength)
+	}
+
+	name := make([]byte, header.NameLength)
+	if _, err := io.ReadFull(c.reader, name); err != nil {
+		return fmt.Errorf("vnc: read desktop name: %w", err)
+	}
+
+	c.name = string(name)
+	c.fb = image.NewRGBA(image.Rect(0, 0, int(header.Width), int(header.Height)))
+	return nil
+}
+
+// setPixelFormat asks for 32-bit little-endian true colour (blue, green, red,
+// padding) with raw encoding, which every server supports.
+func (c *Client) setPixelFormat() error {
+	pixelFormat := []byte{
+		msgSetPixelFormat, 0, 0, 0,
+		32, 24, 0, 1, // bits per pixel, depth, big endian, true colour
+		0, 255, 0, 255, 0, 255, // red, green, blue max
+		16, 8, 0, // red, green, blue shift
+		0, 0, 0,
+	}
+	if _, err := c.conn.Write(pixelFormat); err != nil {
+		return fmt.Errorf("vnc: set pixel format: %w", err)
+	}
+
+	encodings := []byte{msgSetEncodings, 0, 0, 1, 0, 0, 0, encodingRaw}
+	if _, err := c.conn.Write(encodings); err != nil {
+		return fmt.Errorf("vnc: set encodings: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) requestUpdate() error {
+	bounds := c.fb.Rect
+	request := make([]byte, 10)
+	request[0] = msgFramebufferUpdateRequest
+	request[1] = 0 // full, not incremental
+	binary.BigEndian.PutUint16(request[6:], uint16(bounds.Dx()))
+	binary.BigEndian.PutUint16(request[8:], uint16(bounds.Dy()))
+
+	if _, err := c.conn.Write(request); err != nil {
+		return fmt.Errorf("vnc: request update: %w", err)
+	}
+	return nil
+}
+
+// awaitUpdate reads server messages until a framebuffer update has been applied.
+func (c *Client) awaitUpdate() error {
+	for {
+		msgType, err := c.reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("vnc: read message: %w", err)
+		}
+
+		switch msgType {
+		case msgFramebufferUpdate:
+			return c.readUpdate()
+		case msgSetColourMapEntries:
+			err = c.skipColourMap()
+		case msgBell:
+		case msgServerCutText:
+			err = c.skipCutText()
+		default:
+			return fmt.Errorf("vnc: unexpected message type %d", msgType)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) readUpdate() error {
+	var header struct {
+		Padding uint8
+		Rects   uint16
+	}
+	if err := binary.Read(c.reader, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("vnc: read update: %w", err)
+	}
+
+	for range header.Rects {
+		if err := c.readRect(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) readRect() error {
+	var rect struct {
+		X, Y, Width, Height uint16
+		Encoding            int32
+	}
+	if err := binary.Read(c.reader, binary.BigEndian, &rect); err != nil {
+		return fmt.Errorf("vnc: read rectangle: %w", err)
+	}
+
+	if rect.Encoding != encodingRaw {
+		return fmt.Errorf("vnc: unsupported encoding %d", rect.Encoding)
+	}
+
+	area := image.Rect(int(rect.X), int(rect.Y), int(rect.X)+int(rect.Width), int(rect.Y)+int(rect.Height))
+	if !area.In(c.fb.Rect) {
+		return fmt.Errorf("vnc: rectangle %v outside framebuffer %v", area, c.fb.Rect)
+	}
+
+	row := make([]byte, area.Dx()*bytesPerPixel)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		if _, err := io.ReadFull(c.reader, row); err != nil {
+			return fmt.Errorf("vnc: read pixels: %w", err)
+		}
+
+		offset := c.fb.PixOffset(area.Min.X, y)
+		for x := 0; x < len(row); x += bytesPerPixel {
+			pixel := c.fb.Pix[offset+x : offset+x+bytesPerPixel]
+			pixel[0], pixel[1], pixel[2], pixel[3] = row[x+2], row[x+1], row[x], 0xff
+		}
+	}
+	return nil
+}
+
+func (c *Client) skipColourMap() error {
+	var header struct {
+		Padding    uint8
+		FirstColor uint16
+		Colors     uint16
+	}
+	if err := binary.Read(c.reader, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("vnc: read colour map: %w", err)
+	}
+
+	const bytesPerColor = 6
+	if _, err := c.reader.Discard(int(header.Colors) * bytesPerColor); err != nil {
+		return fmt.Errorf("vnc: skip colour map: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) skipCutText() error {
+	var header struct {
+		Padding [3]uint8
+		Length  uint32
+	}
+	if err := binary.Read(c.reader, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("vnc: read cut text: %w", err)
+	}
+
+	if _, err := io.CopyN(io.Discard, c.reader, int64(header.Length)); err != nil {
+		return fmt.Errorf("vnc: skip cut text: %w", err)
+	}
+	return nil
+}
+
+// originOf derives the websocket Origin header from the endpoint URL.
+func originOf(rawURL string) (string, error) {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("vnc: parse url: %w", err)
+	}
+
+	scheme := "http"
+	if endpoint.Scheme == "wss" {
+		scheme = "https"
+	}
+	return scheme + "://" + endpoint.Host, nil
+}
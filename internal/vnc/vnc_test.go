@@ -0,0 +1,107 @@
+package vnc_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/secret"
+	"github.com/omarluq/hetzner-blackbsd/internal/vnc"
+	"github.com/omarluq/hetzner-blackbsd/internal/vnc/vnctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testScreen() *image.RGBA {
+	screen := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for y := range 3 {
+		for x := range 4 {
+			screen.Set(x, y, color.RGBA{R: uint8(x * 60), G: uint8(y * 80), B: 200, A: 255})
+		}
+	}
+	return screen
+}
+
+func TestScreenshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("captures framebuffer with password", func(t *testing.T) {
+		t.Parallel()
+
+		screen := testScreen()
+		server := vnctest.NewServer(screen, "s3cret")
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		client, err := vnc.DialWebSocket(ctx, server.URL, secret.New("s3cret"))
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, client.Close()) }()
+
+		assert.Equal(t, "vnctest", client.Name())
+
+		for range 2 {
+			shot, shotErr := client.Screenshot(ctx)
+			require.NoError(t, shotErr)
+			assert.Equal(t, screen.Rect, shot.Rect)
+			assert.Equal(t, screen.Pix, shot.Pix)
+		}
+	})
+
+	t.Run("captures framebuffer without authentication", func(t *testing.T) {
+		t.Parallel()
+
+		screen := testScreen()
+		server := vnctest.NewServer(screen, "")
+		defer server.Close()
+
+		client, err := vnc.DialWebSocket(context.Background(), server.URL, secret.Secret{})
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, client.Close()) }()
+
+		shot, err := client.Screenshot(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, screen.Pix, shot.Pix)
+	})
+
+	t.Run("rejects wrong password", func(t *testing.T) {
+		t.Parallel()
+
+		server := vnctest.NewServer(testScreen(), "s3cret")
+		defer server.Close()
+
+		_, err := vnc.DialWebSocket(context.Background(), server.URL, secret.New("wrong"))
+		require.ErrorIs(t, err, vnc.ErrAuthFailed)
+		assert.Contains(t, err.Error(), "password incorrect")
+	})
+
+	t.Run("requires password when server asks for one", func(t *testing.T) {
+		t.Parallel()
+
+		server := vnctest.NewServer(testScreen(), "s3cret")
+		defer server.Close()
+
+		_, err := vnc.DialWebSocket(context.Background(), server.URL, secret.Secret{})
+		require.ErrorIs(t, err, vnc.ErrAuthFailed)
+	})
+}
+
+func TestEncryptChallenge(t *testing.T) {
+	t.Parallel()
+
+	challenge := []byte("0123456789abcdef")
+
+	first, err := vnc.EncryptChallenge(challenge, "password")
+	require.NoError(t, err)
+	truncated, err := vnc.EncryptChallenge(challenge, "passwordIGNORED")
+	require.NoError(t, err)
+	other, err := vnc.EncryptChallenge(challenge, "other")
+	require.NoError(t, err)
+
+	assert.Len(t, first, len(challenge))
+	assert.Equal(t, first, truncated, "only the first eight password bytes are used")
+	assert.NotEqual(t, first, other)
+}
@@ -0,0 +1,212 @@
+// Package vnctest provides a websocket VNC server for tests, in the spirit of
+// net/http/httptest.
+package vnctest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/omarluq/hetzner-blackbsd/internal/vnc"
+)
+
+const (
+	securityNone    = 1
+	securityVNCAuth = 2
+	challengeSize   = 16
+)
+
+// Server is a websocket VNC server that always shows the same framebuffer.
+type Server struct {
+	httpServer *httptest.Server
+	screen     image.Image
+	password   string
+
+	// URL is the ws:// endpoint to pass to vnc.DialWebSocket.
+	URL string
+}
+
+// NewServer starts a Server showing screen. A non-empty password enables VNC
+// authentication; otherwise no authentication is offered.
+func NewServer(screen image.Image, password string) *Server {
+	server := &Server{
+		httpServer: nil,
+		screen:     screen,
+		password:   password,
+		URL:        "",
+	}
+
+	var wsServer websocket.Server
+	wsServer.Handshake = func(*websocket.Config, *http.Request) error { return nil }
+	wsServer.Handler = server.serve
+
+	server.httpServer = httptest.NewServer(wsServer)
+	server.URL = "ws" + strings.TrimPrefix(server.httpServer.URL, "http")
+	return server
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+func (s *Server) serve(conn *websocket.Conn) {
+	conn.PayloadType = websocket.BinaryFrame
+	reader := bufio.NewReader(conn)
+
+	if err := s.handshake(conn, reader); err != nil {
+		return
+	}
+
+	for {
+		if err := s.handleMessage(conn, reader); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handshake(conn io.Writer, reader *bufio.Reader) error {
+	if _, err := io.WriteString(conn, "RFB 003.008\n"); err != nil {
+		return err
+	}
+
+	version := make([]byte, len("RFB 003.008\n"))
+	if _, err := io.ReadFull(reader, version); err != nil {
+		return err
+	}
+
+	securityType := byte(securityNone)
+	if s.password != "" {
+		securityType = securityVNCAuth
+	}
+	if _, err := conn.Write([]byte{1, securityType}); err != nil {
+		return err
+	}
+
+	chosen, err := reader.ReadByte()
+	if err != nil || chosen != securityType {
+		return errors.New("unexpected security type")
+	}
+
+	if err = s.authenticate(conn, reader, securityType); err != nil {
+		return err
+	}
+
+	// ClientInit
+	if _, err = reader.ReadByte(); err != nil {
+		return err
+	}
+
+	return s.writeServerInit(conn)
+}
+
+func (s *Server) authenticate(conn io.Writer, reader io.Reader, securityType byte) error {
+	ok := true
+	if securityType == securityVNCAuth {
+		challenge := make([]byte, challengeSize)
+		if _, err := rand.Read(challenge); err != nil {
+			return err
+		}
+		if _, err := conn.Write(challenge); err != nil {
+			return err
+		}
+
+		response := make([]byte, challengeSize)
+		if _, err := io.ReadFull(reader, response); err != nil {
+			return err
+		}
+
+		expected, err := vnc.EncryptChallenge(challenge, s.password)
+		if err != nil {
+			return err
+		}
+		ok = bytes.Equal(response, expected)
+	}
+
+	if ok {
+		_, err := conn.Write([]byte{0, 0, 0, 0})
+		return err
+	}
+
+	reason := "password incorrect"
+	var result bytes.Buffer
+	_ = binary.Write(&result, binary.BigEndian, uint32(1))
+	_ = binary.Write(&result, binary.BigEndian, uint32(len(reason)))
+	result.WriteString(reason)
+	if _, err := conn.Write(result.Bytes()); err != nil {
+		return err
+	}
+	return errors.New(reason)
+}
+
+func (s *Server) writeServerInit(conn io.Writer) error {
+	const name = "vnctest"
+	bounds := s.screen.Bounds()
+
+	var init bytes.Buffer
+	_ = binary.Write(&init, binary.BigEndian, uint16(bounds.Dx()))
+	_ = binary.Write(&init, binary.BigEndian, uint16(bounds.Dy()))
+	init.Write([]byte{32, 24, 0, 1, 0, 255, 0, 255, 0, 255, 16, 8, 0, 0, 0, 0})
+	_ = binary.Write(&init, binary.BigEndian, uint32(len(name)))
+	init.WriteString(name)
+
+	_, err := conn.Write(init.Bytes())
+	return err
+}
+
+// handleMessage reads one client message, answering update requests with the
+// whole screen in raw encoding.
+func (s *Server) handleMessage(conn io.Writer, reader *bufio.Reader) error {
+	msgType, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	switch msgType {
+	case 0: // SetPixelFormat
+		_, err = reader.Discard(3 + 16)
+	case 2: // SetEncodings
+		var header struct {
+			Padding   uint8
+			Encodings uint16
+		}
+		if err = binary.Read(reader, binary.BigEndian, &header); err == nil {
+			_, err = reader.Discard(int(header.Encodings) * 4)
+		}
+	case 3: // FramebufferUpdateRequest
+		if _, err = reader.Discard(9); err == nil {
+			err = s.writeUpdate(conn)
+		}
+	default:
+		err = errors.New("unsupported client message")
+	}
+	return err
+}
+
+func (s *Server) writeUpdate(conn io.Writer) error {
+	bounds := s.screen.Bounds()
+
+	var update bytes.Buffer
+	update.Write([]byte{0, 0, 0, 1})
+	_ = binary.Write(&update, binary.BigEndian, [4]uint16{0, 0, uint16(bounds.Dx()), uint16(bounds.Dy())})
+	_ = binary.Write(&update, binary.BigEndian, int32(0))
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			red, green, blue, _ := s.screen.At(x, y).RGBA()
+			update.Write([]byte{byte(blue >> 8), byte(green >> 8), byte(red >> 8), 0})
+		}
+	}
+
+	_, err := conn.Write(update.Bytes())
+	return err
+}